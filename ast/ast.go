@@ -3,12 +3,15 @@ package ast
 import (
 	"bytes"
 	"cogen/token"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Span() Span
 }
 
 type Statement interface {
@@ -21,18 +24,49 @@ type Expression interface {
 	expressionNode()
 }
 
+// Trivia holds the comments attached to a node. Leading comments are printed
+// on their own lines before the node, trailing comments after it on the same
+// line.
+type Trivia struct {
+	Leading  []token.Token
+	Trailing []token.Token
+}
+
+// Commented is implemented by every node that keeps comment trivia.
+type Commented interface {
+	Node
+	Comments() *Trivia
+}
+
+func (t *Trivia) Comments() *Trivia { return t }
+
+func (t *Trivia) writeLeading(out *bytes.Buffer, indent string) {
+	for _, c := range t.Leading {
+		out.WriteString(indent + c.Literal + "\n")
+	}
+}
+
+func (t *Trivia) writeTrailing(out *bytes.Buffer) {
+	for _, c := range t.Trailing {
+		out.WriteString(" " + c.Literal)
+	}
+}
+
 type Input struct {
 	Ident *Identifier
 	Value string
 }
 
 type Program struct {
+	Trivia     // comments before the header and after the last label
 	Name       string
 	Variables  []Input
 	Statements []*LabelStatement
+	Dialect    token.Dialect // the syntax String prints in
 }
 
 type LabelStatement struct {
+	Trivia
 	Token      token.Token // label token, updated in parser
 	Label      Label
 	Statements []Statement
@@ -44,16 +78,19 @@ type Label struct {
 }
 
 type GotoStatement struct {
+	Trivia
 	Token token.Token // goto token
 	Label Label
 }
 
 type ReturnStatement struct {
+	Trivia
 	Token       token.Token // return token
 	ReturnValue Expression
 }
 
 type IfStatement struct {
+	Trivia
 	Token      token.Token // if
 	Cond       Expression  // expression
 	LabelTrue  Label
@@ -61,11 +98,13 @@ type IfStatement struct {
 }
 
 type ExpressionStatement struct {
+	Trivia
 	Token      token.Token // initial token
 	Expression Expression
 }
 
 type AssignmentStatement struct {
+	Trivia
 	Left  *Identifier
 	Token token.Token // :=
 	Right Expression  // Some value type
@@ -77,13 +116,14 @@ type Identifier struct {
 }
 
 type CallExpression struct {
-	Token     token.Token // call
-	Label     Label
+	Token token.Token // call
+	Label Label
 }
 
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // the value, if it does not fit in Value
 }
 
 type BooleanLiteral struct {
@@ -91,10 +131,16 @@ type BooleanLiteral struct {
 	Value bool
 }
 
+type StringLiteral struct {
+	Token token.Token // the literal as written, quotes included
+	Value string      // the decoded value
+}
+
 type PrimitiveCall struct {
 	Token     token.Token // "(" Identifier token
 	Primitive Expression  // Identifier
 	Arguments []Expression
+	Rparen    token.Token // closing ), zero for synthesized calls
 }
 
 type PrefixExpression struct {
@@ -111,8 +157,9 @@ type InfixExpression struct {
 }
 
 type List struct {
-	Token token.Token // (
-	Value []Expression
+	Token  token.Token // (
+	Value  []Expression
+	Rparen token.Token // closing ), zero for synthesized lists
 }
 
 type SymbolExpression struct {
@@ -135,18 +182,26 @@ func (p *Program) TokenLiteral() string {
 
 func (p *Program) String() string {
 	var out bytes.Buffer
-	if p.Name != "" {
-		out.WriteString(p.Name)
-		args := []string{}
-		for _, a := range p.Variables {
-			args = append(args, a.Ident.String())
+	p.writeLeading(&out, "")
+	args := []string{}
+	for _, a := range p.Variables {
+		args = append(args, a.Ident.String())
+	}
+	if p.Dialect == token.BookDialect && p.Name == "" {
+		if len(args) > 0 {
+			out.WriteString("read " + strings.Join(args, ", ") + ";\n")
 		}
+	} else if p.Name != "" {
+		out.WriteString(p.Name)
 		out.WriteString("(")
 		out.WriteString(strings.Join(args, ", "))
 		out.WriteString("):\n")
 	}
 	for _, s := range p.Statements {
-		out.WriteString(s.String())
+		s.write(&out, p.Dialect)
+	}
+	for _, c := range p.Trailing {
+		out.WriteString(c.Literal + "\n")
 	}
 	return out.String()
 }
@@ -231,6 +286,10 @@ func (b *BooleanLiteral) expressionNode()      {}
 func (b *BooleanLiteral) TokenLiteral() string { return b.Token.Literal }
 func (b *BooleanLiteral) String() string       { return b.Token.Literal }
 
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return strconv.Quote(sl.Value) }
+
 func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
@@ -250,16 +309,44 @@ func (ls *LabelStatement) TokenLiteral() string {
 
 func (ls *LabelStatement) String() string {
 	var out bytes.Buffer
+	ls.write(&out, token.DefaultDialect)
+	return out.String()
+}
 
-	out.WriteString(ls.Label.String() + ": ")
+func (ls *LabelStatement) write(out *bytes.Buffer, d token.Dialect) {
+	ls.writeLeading(out, "")
+	out.WriteString(ls.Label.String() + ":")
+	// Statements start on the label line unless a comment is in the way.
+	inline := len(ls.Trailing) == 0
+	if len(ls.Statements) > 0 {
+		if c, ok := ls.Statements[0].(Commented); ok && len(c.Comments().Leading) > 0 {
+			inline = false
+		}
+	}
+	ls.writeTrailing(out)
+	if inline {
+		out.WriteString(" ")
+	} else {
+		out.WriteString("\n")
+	}
 	for i, stmt := range ls.Statements {
-		if i == len(ls.Statements)-1 {
-			out.WriteString(stmt.String() + ";\n")
+		c, commented := stmt.(Commented)
+		if commented {
+			c.Comments().writeLeading(out, "\t")
+		}
+		if i > 0 || !inline {
+			out.WriteString("\t")
+		}
+		if is, ok := stmt.(*IfStatement); ok {
+			out.WriteString(is.format(d) + ";")
 		} else {
-			out.WriteString(stmt.String() + ";\n\t")
+			out.WriteString(stmt.String() + ";")
+		}
+		if commented {
+			c.Comments().writeTrailing(out)
 		}
+		out.WriteString("\n")
 	}
-	return out.String()
 }
 
 func (as *AssignmentStatement) statementNode() {}
@@ -311,10 +398,19 @@ func (is *IfStatement) TokenLiteral() string {
 }
 
 func (is *IfStatement) String() string {
+	return is.format(token.DefaultDialect)
+}
+
+// format prints the statement, with the book's goto before the true label
+// in the book dialect.
+func (is *IfStatement) format(d token.Dialect) string {
 	var out bytes.Buffer
 	out.WriteString(is.TokenLiteral() + " ")
 	out.WriteString(is.Cond.String())
 	out.WriteString(" ")
+	if d == token.BookDialect {
+		out.WriteString("goto ")
+	}
 	out.WriteString(is.LabelTrue.String() + " ")
 	out.WriteString("else ")
 	out.WriteString(is.LabelFalse.String())
@@ -0,0 +1,48 @@
+package ast
+
+import (
+	"math/big"
+	"slices"
+)
+
+// Clone returns a deep copy of node: no node, slice or comment list of the
+// copy is shared with node, so either can be changed without affecting the
+// other. A nil node gives nil.
+func Clone[N Node](node N) N {
+	var zero N
+	if Node(node) == nil {
+		return zero
+	}
+	return Rewrite(node, cloneNode).(N)
+}
+
+// cloneNode finishes the copy Rewrite makes of every node with children:
+// it copies the leaves, which Rewrite passes as they are, and the comments.
+func cloneNode(n Node) Node {
+	switch n := n.(type) {
+	case *Identifier:
+		c := *n
+		return &c
+	case *IntegerLiteral:
+		c := *n
+		if n.Big != nil {
+			c.Big = new(big.Int).Set(n.Big)
+		}
+		return &c
+	case *BooleanLiteral:
+		c := *n
+		return &c
+	case *StringLiteral:
+		c := *n
+		return &c
+	case *SymbolExpression:
+		c := *n
+		return &c
+	}
+	if c, ok := n.(Commented); ok {
+		t := c.Comments()
+		t.Leading = slices.Clone(t.Leading)
+		t.Trailing = slices.Clone(t.Trailing)
+	}
+	return n
+}
@@ -0,0 +1,100 @@
+package ast_test
+
+import (
+	"cogen/ast"
+	"cogen/lexer"
+	"cogen/parser"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	program := parse(t, "// header\n"+walkInput+" // end")
+	clone := ast.Clone(program)
+
+	if !ast.Equal(program, clone) {
+		t.Fatalf("clone differs from the original:\n%s", clone)
+	}
+
+	ast.Inspect(clone, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			n.Value = "v"
+		case *ast.Label:
+			n.Value = "l"
+		case *ast.SymbolExpression:
+			n.Value = "s"
+		}
+		if c, ok := n.(ast.Commented); ok && len(c.Comments().Leading) > 0 {
+			c.Comments().Leading[0].Literal = "// changed"
+		}
+		return true
+	})
+
+	if got := program.String(); got != parse(t, "// header\n"+walkInput+" // end").String() {
+		t.Errorf("changing the clone changed the original:\n%s", got)
+	}
+	if ast.Equal(program, clone) {
+		t.Errorf("changed clone still equals the original")
+	}
+}
+
+func TestCloneBigInteger(t *testing.T) {
+	program := parse(t, "1: return 99999999999999999999;")
+	clone := ast.Clone(program)
+	lit := func(p *ast.Program) *ast.IntegerLiteral {
+		return p.Statements[0].Statements[0].(*ast.ReturnStatement).ReturnValue.(*ast.IntegerLiteral)
+	}
+	lit(clone).Big.SetInt64(1)
+	if got := lit(program).Big.String(); got != "99999999999999999999" {
+		t.Errorf("changing the clone changed the original to %s", got)
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	var e ast.Expression
+	if ast.Clone(e) != nil {
+		t.Errorf("Clone(nil) is not nil")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool // with positions ignored
+	}{
+		{"f(x): a: return x + 1;", "f(x):\na:\n  return x+1;", true},
+		{"f(x): a: return x + 1;", "f(x): a: return x - 1;", false},
+		{"f(x): a: return x + 1;", "f(x): a: return 1 + x;", false},
+		{"f(x): a: goto b; b: return 'a;", "f(x): a: goto b; b: return 'b;", false},
+		{"f(x): a: goto b; b: return x;", "f(y): a: goto b; b: return x;", false},
+		{"f(x): a: return (x);", "f(x): a: return x;", true},
+		{"f(x): a: return x; // done", "f(x): a: return x;", false},
+	}
+
+	for _, tt := range tests {
+		a := parse(t, tt.a)
+		b := parse(t, tt.b)
+		if got := ast.Equal(a, b, ast.IgnorePositions); got != tt.want {
+			t.Errorf("Equal(%q, %q, IgnorePositions) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+		if tt.a != tt.b && ast.Equal(a, b) {
+			t.Errorf("Equal(%q, %q) compared no positions", tt.a, tt.b)
+		}
+	}
+}
+
+func TestEqualFiles(t *testing.T) {
+	input := "f(x): a: return x;"
+	a := parser.New(lexer.NewFile("a.fcl", input)).ParseProgram()
+	b := parser.New(lexer.NewFile("b.fcl", input)).ParseProgram()
+
+	if ast.Equal(a, b) {
+		t.Errorf("programs from different files are equal")
+	}
+	if !ast.Equal(a, b, ast.IgnorePositions) {
+		t.Errorf("programs from different files differ with positions ignored")
+	}
+	if !ast.Equal(a, ast.Clone(a)) {
+		t.Errorf("clone differs")
+	}
+}
@@ -0,0 +1,135 @@
+package ast
+
+import (
+	"cogen/token"
+	"fmt"
+	"strings"
+)
+
+// mainName names a book program printed in the default dialect, which
+// needs a name in its header.
+const mainName = "main"
+
+// SetDialect makes p print in dialect d. Converting to the default dialect
+// renames, in place, the book names it cannot lex: 1-init-m becomes
+// 1_init_m and done? becomes done_p. A name spelled like another variable
+// or label once renamed gets a suffix instead, so a-b next to a_b becomes
+// a_b_2. Tokens keep the spelling of the source
+// so spans still match it. Converting to the book dialect drops the name,
+// so the header is printed as read m, n;.
+func (p *Program) SetDialect(d token.Dialect) {
+	if d == p.Dialect {
+		return
+	}
+	switch d {
+	case token.DefaultDialect:
+		if p.Name == "" && len(p.Variables) > 0 {
+			p.Name = mainName
+		}
+		p.Name = DefaultName(p.Name)
+		renameBookNames(p)
+	case token.BookDialect:
+		p.Name = ""
+	}
+	p.Dialect = d
+}
+
+// DefaultName spells a book dialect name in the default dialect.
+func DefaultName(name string) string {
+	if !strings.ContainsAny(name, "-?") {
+		return name
+	}
+	var out strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch {
+		case strings.HasPrefix(name[i:], "->"):
+			out.WriteString("->")
+			i++
+		case name[i] == '-':
+			out.WriteByte('_')
+		case name[i] == '?':
+			out.WriteString("_p")
+		default:
+			out.WriteByte(name[i])
+		}
+	}
+	return out.String()
+}
+
+// renameBookNames respells every identifier and label below node. Quoted
+// data is left alone, it holds symbols rather than names. Variables and
+// labels are named apart, so that no two of either kind merge.
+func renameBookNames(node Node) {
+	vars, labels := &renamer{to: map[string]string{}}, &renamer{to: map[string]string{}}
+	prims := map[*Identifier]bool{}
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *PrimitiveCall:
+			if id, ok := n.Primitive.(*Identifier); ok {
+				prims[id] = true
+			}
+		case *Identifier:
+			if !prims[n] {
+				vars.add(n.Value)
+			}
+		case *Label:
+			labels.add(n.Value)
+		case *Constant:
+			return false
+		}
+		return true
+	})
+	vars.assign()
+	labels.assign()
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *Identifier:
+			if prims[n] {
+				n.Value = DefaultName(n.Value)
+			} else {
+				n.Value = vars.to[n.Value]
+			}
+		case *Label:
+			n.Value = labels.to[n.Value]
+		case *Constant:
+			return false
+		}
+		return true
+	})
+}
+
+// A renamer gives the names of one kind default dialect spellings that
+// differ whenever the book names do.
+type renamer struct {
+	names []string // in order of first use
+	to    map[string]string
+}
+
+func (r *renamer) add(name string) {
+	if _, ok := r.to[name]; !ok {
+		r.to[name] = ""
+		r.names = append(r.names, name)
+	}
+}
+
+// assign keeps the names the default dialect can lex, then spells each
+// other one with DefaultName, adding _2, _3 and so on if that is taken.
+func (r *renamer) assign() {
+	taken := map[string]bool{}
+	for _, name := range r.names {
+		if DefaultName(name) == name {
+			r.to[name], taken[name] = name, true
+		}
+	}
+	for _, name := range r.names {
+		if r.to[name] != "" {
+			continue
+		}
+		base := DefaultName(name)
+		to := base
+		for n := 2; taken[to]; n++ {
+			to = fmt.Sprintf("%s_%d", base, n)
+		}
+		r.to[name], taken[to] = to, true
+	}
+}
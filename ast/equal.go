@@ -0,0 +1,152 @@
+package ast
+
+import (
+	"cogen/token"
+	"slices"
+)
+
+// An EqualOption relaxes what Equal compares.
+type EqualOption int
+
+const (
+	// IgnorePositions compares tokens by type and literal only, so a
+	// parsed program equals the same program synthesized or re-parsed
+	// from another file.
+	IgnorePositions EqualOption = iota + 1
+)
+
+// Equal reports whether a and b are the same tree: nodes of the same types
+// holding the same values, tokens and comments. Nil children only equal
+// nil children, while nil and empty lists are equal.
+func Equal(a, b Node, opts ...EqualOption) bool {
+	var e equaler
+	for _, o := range opts {
+		if o == IgnorePositions {
+			e.ignorePositions = true
+		}
+	}
+	return e.node(a, b)
+}
+
+type equaler struct {
+	ignorePositions bool
+}
+
+func (e *equaler) node(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch x := a.(type) {
+	case *Program:
+		y, ok := b.(*Program)
+		return ok && e.trivia(&x.Trivia, &y.Trivia) &&
+			x.Name == y.Name && x.Dialect == y.Dialect &&
+			slices.EqualFunc(x.Variables, y.Variables, func(a, b Input) bool {
+				return a.Value == b.Value && e.ident(a.Ident, b.Ident)
+			}) &&
+			slices.EqualFunc(x.Statements, y.Statements, e.labelStatement)
+	case *LabelStatement:
+		y, ok := b.(*LabelStatement)
+		return ok && e.labelStatement(x, y)
+	case *Label:
+		y, ok := b.(*Label)
+		return ok && e.label(x, y)
+	case *GotoStatement:
+		y, ok := b.(*GotoStatement)
+		return ok && e.trivia(&x.Trivia, &y.Trivia) && e.token(x.Token, y.Token) &&
+			e.label(&x.Label, &y.Label)
+	case *ReturnStatement:
+		y, ok := b.(*ReturnStatement)
+		return ok && e.trivia(&x.Trivia, &y.Trivia) && e.token(x.Token, y.Token) &&
+			e.node(x.ReturnValue, y.ReturnValue)
+	case *IfStatement:
+		y, ok := b.(*IfStatement)
+		return ok && e.trivia(&x.Trivia, &y.Trivia) && e.token(x.Token, y.Token) &&
+			e.node(x.Cond, y.Cond) &&
+			e.label(&x.LabelTrue, &y.LabelTrue) && e.label(&x.LabelFalse, &y.LabelFalse)
+	case *ExpressionStatement:
+		y, ok := b.(*ExpressionStatement)
+		return ok && e.trivia(&x.Trivia, &y.Trivia) && e.token(x.Token, y.Token) &&
+			e.node(x.Expression, y.Expression)
+	case *AssignmentStatement:
+		y, ok := b.(*AssignmentStatement)
+		return ok && e.trivia(&x.Trivia, &y.Trivia) && e.token(x.Token, y.Token) &&
+			e.ident(x.Left, y.Left) && e.node(x.Right, y.Right)
+	case *Identifier:
+		y, ok := b.(*Identifier)
+		return ok && e.ident(x, y)
+	case *CallExpression:
+		y, ok := b.(*CallExpression)
+		return ok && e.token(x.Token, y.Token) && e.label(&x.Label, &y.Label)
+	case *IntegerLiteral:
+		y, ok := b.(*IntegerLiteral)
+		return ok && e.token(x.Token, y.Token) && x.Value == y.Value &&
+			(x.Big == nil) == (y.Big == nil) && (x.Big == nil || x.Big.Cmp(y.Big) == 0)
+	case *BooleanLiteral:
+		y, ok := b.(*BooleanLiteral)
+		return ok && e.token(x.Token, y.Token) && x.Value == y.Value
+	case *StringLiteral:
+		y, ok := b.(*StringLiteral)
+		return ok && e.token(x.Token, y.Token) && x.Value == y.Value
+	case *PrimitiveCall:
+		y, ok := b.(*PrimitiveCall)
+		return ok && e.token(x.Token, y.Token) && e.token(x.Rparen, y.Rparen) &&
+			e.node(x.Primitive, y.Primitive) && e.nodes(x.Arguments, y.Arguments)
+	case *PrefixExpression:
+		y, ok := b.(*PrefixExpression)
+		return ok && e.token(x.Token, y.Token) && x.Operator == y.Operator &&
+			e.node(x.Right, y.Right)
+	case *InfixExpression:
+		y, ok := b.(*InfixExpression)
+		return ok && e.token(x.Token, y.Token) && x.Operator == y.Operator &&
+			e.node(x.Left, y.Left) && e.node(x.Right, y.Right)
+	case *List:
+		y, ok := b.(*List)
+		return ok && e.token(x.Token, y.Token) && e.token(x.Rparen, y.Rparen) &&
+			e.nodes(x.Value, y.Value)
+	case *SymbolExpression:
+		y, ok := b.(*SymbolExpression)
+		return ok && e.token(x.Token, y.Token) && x.Value == y.Value
+	case *Constant:
+		y, ok := b.(*Constant)
+		return ok && e.token(x.Token, y.Token) && e.node(x.Value, y.Value)
+	}
+	return false
+}
+
+func (e *equaler) nodes(a, b []Expression) bool {
+	return slices.EqualFunc(a, b, func(x, y Expression) bool { return e.node(x, y) })
+}
+
+func (e *equaler) labelStatement(x, y *LabelStatement) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return e.trivia(&x.Trivia, &y.Trivia) && e.token(x.Token, y.Token) &&
+		e.label(&x.Label, &y.Label) &&
+		slices.EqualFunc(x.Statements, y.Statements, func(a, b Statement) bool { return e.node(a, b) })
+}
+
+func (e *equaler) label(x, y *Label) bool {
+	return e.token(x.Token, y.Token) && x.Value == y.Value
+}
+
+func (e *equaler) ident(x, y *Identifier) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return e.token(x.Token, y.Token) && x.Value == y.Value
+}
+
+func (e *equaler) trivia(x, y *Trivia) bool {
+	return slices.EqualFunc(x.Leading, y.Leading, e.token) &&
+		slices.EqualFunc(x.Trailing, y.Trailing, e.token)
+}
+
+func (e *equaler) token(x, y token.Token) bool {
+	if x.Type != y.Type || x.Literal != y.Literal {
+		return false
+	}
+	return e.ignorePositions || x.Pos() == y.Pos() && x.File == y.File
+}
@@ -0,0 +1,468 @@
+package ast
+
+import (
+	"bytes"
+	"cogen/token"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JSONVersion is the version of the JSON encoding written by EncodeJSON.
+// It changes whenever a node is encoded differently, so stored trees can be
+// told apart from current ones.
+const JSONVersion = 1
+
+// EncodeJSON encodes node, and every node below it, as JSON:
+//
+//	{"version": 1, "node": {"kind": "Program", ...}}
+//
+// Every node is an object with a "kind" naming its Go type, the tokens it
+// holds with their positions, and its fields in lower camel case. Labels are
+// nodes of kind "Label" wherever they appear. A node with comments has them
+// under "comments", split into "leading" and "trailing". Zero tokens, nil
+// children and empty comment lists are left out.
+func EncodeJSON(node Node) ([]byte, error) {
+	return json.Marshal(jsonFile{Version: JSONVersion, Node: jsonNode{node}})
+}
+
+// DecodeJSON decodes a tree written by EncodeJSON.
+func DecodeJSON(data []byte) (Node, error) {
+	var f struct {
+		Version int             `json:"version"`
+		Node    json.RawMessage `json:"node"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Version != JSONVersion {
+		return nil, fmt.Errorf("ast: unsupported JSON version %d, expected %d", f.Version, JSONVersion)
+	}
+	var n jsonNode
+	if err := json.Unmarshal(f.Node, &n); err != nil {
+		return nil, err
+	}
+	return n.Node, nil
+}
+
+// MarshalJSON encodes p with EncodeJSON.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return EncodeJSON(p)
+}
+
+// UnmarshalJSON decodes a program written by EncodeJSON into p.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	n, err := DecodeJSON(data)
+	if err != nil {
+		return err
+	}
+	prog, ok := n.(*Program)
+	if !ok {
+		return fmt.Errorf("ast: expected a Program, got %s", kindOf(n))
+	}
+	*p = *prog
+	return nil
+}
+
+type jsonFile struct {
+	Version int      `json:"version"`
+	Node    jsonNode `json:"node"`
+}
+
+// jsonNode encodes the node it wraps as an object tagged with its kind, and
+// decodes such an object back into a node. A nil node is null.
+type jsonNode struct{ Node }
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Line    int             `json:"line"`
+	Column  int             `json:"column"`
+	Offset  int             `json:"offset"`
+	File    string          `json:"file,omitempty"`
+}
+
+type jsonTrivia struct {
+	Leading  []*jsonToken `json:"leading,omitempty"`
+	Trailing []*jsonToken `json:"trailing,omitempty"`
+}
+
+type jsonInput struct {
+	Ident jsonNode `json:"ident"`
+	Value string   `json:"value,omitempty"`
+}
+
+// jsonFields holds the fields of every kind of node. Each kind uses the
+// ones named like the fields of its Go type and leaves the others empty.
+type jsonFields struct {
+	Kind        string          `json:"kind"`
+	Comments    *jsonTrivia     `json:"comments,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	Dialect     string          `json:"dialect,omitempty"`
+	Variables   []jsonInput     `json:"variables,omitempty"`
+	Token       *jsonToken      `json:"token,omitempty"`
+	Label       *jsonNode       `json:"label,omitempty"`
+	LabelTrue   *jsonNode       `json:"labelTrue,omitempty"`
+	LabelFalse  *jsonNode       `json:"labelFalse,omitempty"`
+	Statements  []jsonNode      `json:"statements,omitempty"`
+	Left        *jsonNode       `json:"left,omitempty"`
+	Operator    string          `json:"operator,omitempty"`
+	Right       *jsonNode       `json:"right,omitempty"`
+	Cond        *jsonNode       `json:"cond,omitempty"`
+	ReturnValue *jsonNode       `json:"returnValue,omitempty"`
+	Expression  *jsonNode       `json:"expression,omitempty"`
+	Primitive   *jsonNode       `json:"primitive,omitempty"`
+	Arguments   []jsonNode      `json:"arguments,omitempty"`
+	Elements    []jsonNode      `json:"elements,omitempty"`
+	Datum       *jsonNode       `json:"datum,omitempty"`
+	Value       json.RawMessage `json:"value,omitempty"`
+	Rparen      *jsonToken      `json:"rparen,omitempty"`
+}
+
+func kindOf(n Node) string {
+	if n == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%T", n)[len("*ast."):]
+}
+
+func (n jsonNode) MarshalJSON() ([]byte, error) {
+	if n.Node == nil {
+		return []byte("null"), nil
+	}
+	f := jsonFields{Kind: kindOf(n.Node)}
+	if c, ok := n.Node.(Commented); ok {
+		f.Comments = encodeTrivia(c.Comments())
+	}
+
+	var err error
+	switch v := n.Node.(type) {
+	case *Program:
+		f.Name = v.Name
+		f.Dialect = v.Dialect.String()
+		for _, in := range v.Variables {
+			ident := jsonNode{}
+			if in.Ident != nil {
+				ident.Node = in.Ident
+			}
+			f.Variables = append(f.Variables, jsonInput{Ident: ident, Value: in.Value})
+		}
+		for _, s := range v.Statements {
+			if s != nil {
+				f.Statements = append(f.Statements, jsonNode{s})
+			}
+		}
+	case *LabelStatement:
+		f.Token = encodeToken(v.Token)
+		f.Label = wrapLabel(v.Label)
+		f.Statements = wrapList(v.Statements)
+	case *Label:
+		f.Token = encodeToken(v.Token)
+		f.Value, err = json.Marshal(v.Value)
+	case *GotoStatement:
+		f.Token = encodeToken(v.Token)
+		f.Label = wrapLabel(v.Label)
+	case *ReturnStatement:
+		f.Token = encodeToken(v.Token)
+		f.ReturnValue = wrapPtr(v.ReturnValue)
+	case *IfStatement:
+		f.Token = encodeToken(v.Token)
+		f.Cond = wrapPtr(v.Cond)
+		f.LabelTrue = wrapLabel(v.LabelTrue)
+		f.LabelFalse = wrapLabel(v.LabelFalse)
+	case *ExpressionStatement:
+		f.Token = encodeToken(v.Token)
+		f.Expression = wrapPtr(v.Expression)
+	case *AssignmentStatement:
+		f.Token = encodeToken(v.Token)
+		if v.Left != nil {
+			f.Left = wrapPtr(v.Left)
+		}
+		f.Right = wrapPtr(v.Right)
+	case *Identifier:
+		f.Token = encodeToken(v.Token)
+		f.Value, err = json.Marshal(v.Value)
+	case *CallExpression:
+		f.Token = encodeToken(v.Token)
+		f.Label = wrapLabel(v.Label)
+	case *IntegerLiteral:
+		f.Token = encodeToken(v.Token)
+		if v.Big != nil {
+			f.Value, err = json.Marshal(v.Big)
+		} else {
+			f.Value, err = json.Marshal(v.Value)
+		}
+	case *BooleanLiteral:
+		f.Token = encodeToken(v.Token)
+		f.Value, err = json.Marshal(v.Value)
+	case *StringLiteral:
+		f.Token = encodeToken(v.Token)
+		f.Value, err = json.Marshal(v.Value)
+	case *PrimitiveCall:
+		f.Token = encodeToken(v.Token)
+		f.Primitive = wrapPtr(v.Primitive)
+		f.Arguments = wrapList(v.Arguments)
+		f.Rparen = encodeToken(v.Rparen)
+	case *PrefixExpression:
+		f.Token = encodeToken(v.Token)
+		f.Operator = v.Operator
+		f.Right = wrapPtr(v.Right)
+	case *InfixExpression:
+		f.Token = encodeToken(v.Token)
+		f.Left = wrapPtr(v.Left)
+		f.Operator = v.Operator
+		f.Right = wrapPtr(v.Right)
+	case *List:
+		f.Token = encodeToken(v.Token)
+		f.Elements = wrapList(v.Value)
+		f.Rparen = encodeToken(v.Rparen)
+	case *SymbolExpression:
+		f.Token = encodeToken(v.Token)
+		f.Value, err = json.Marshal(v.Value)
+	case *Constant:
+		f.Token = encodeToken(v.Token)
+		f.Datum = wrapPtr(v.Value)
+	default:
+		return nil, fmt.Errorf("ast: cannot encode node of type %T", v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(f)
+}
+
+func (n *jsonNode) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		n.Node = nil
+		return nil
+	}
+	var f jsonFields
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	d := decoder{kind: f.Kind}
+	tok := decodeToken(f.Token)
+
+	switch f.Kind {
+	case "Program":
+		p := &Program{Name: f.Name}
+		if f.Dialect != "" {
+			p.Dialect, d.err = token.ParseDialect(f.Dialect)
+		}
+		for _, in := range f.Variables {
+			p.Variables = append(p.Variables, Input{Ident: as[*Identifier](&d, "ident", &in.Ident), Value: in.Value})
+		}
+		for i := range f.Statements {
+			p.Statements = append(p.Statements, as[*LabelStatement](&d, "statements", &f.Statements[i]))
+		}
+		p.Trivia = decodeTrivia(f.Comments)
+		n.Node = p
+	case "LabelStatement":
+		n.Node = &LabelStatement{
+			Trivia:     decodeTrivia(f.Comments),
+			Token:      tok,
+			Label:      d.label("label", f.Label),
+			Statements: asList[Statement](&d, "statements", f.Statements),
+		}
+	case "Label":
+		l := &Label{Token: tok}
+		d.value(f.Value, &l.Value)
+		n.Node = l
+	case "GotoStatement":
+		n.Node = &GotoStatement{Trivia: decodeTrivia(f.Comments), Token: tok, Label: d.label("label", f.Label)}
+	case "ReturnStatement":
+		n.Node = &ReturnStatement{
+			Trivia:      decodeTrivia(f.Comments),
+			Token:       tok,
+			ReturnValue: as[Expression](&d, "returnValue", f.ReturnValue),
+		}
+	case "IfStatement":
+		n.Node = &IfStatement{
+			Trivia:     decodeTrivia(f.Comments),
+			Token:      tok,
+			Cond:       as[Expression](&d, "cond", f.Cond),
+			LabelTrue:  d.label("labelTrue", f.LabelTrue),
+			LabelFalse: d.label("labelFalse", f.LabelFalse),
+		}
+	case "ExpressionStatement":
+		n.Node = &ExpressionStatement{
+			Trivia:     decodeTrivia(f.Comments),
+			Token:      tok,
+			Expression: as[Expression](&d, "expression", f.Expression),
+		}
+	case "AssignmentStatement":
+		n.Node = &AssignmentStatement{
+			Trivia: decodeTrivia(f.Comments),
+			Left:   as[*Identifier](&d, "left", f.Left),
+			Token:  tok,
+			Right:  as[Expression](&d, "right", f.Right),
+		}
+	case "Identifier":
+		id := &Identifier{Token: tok}
+		d.value(f.Value, &id.Value)
+		n.Node = id
+	case "CallExpression":
+		n.Node = &CallExpression{Token: tok, Label: d.label("label", f.Label)}
+	case "IntegerLiteral":
+		lit := &IntegerLiteral{Token: tok}
+		var v big.Int
+		d.value(f.Value, &v)
+		if v.IsInt64() {
+			lit.Value = v.Int64()
+		} else {
+			lit.Big = &v
+		}
+		n.Node = lit
+	case "BooleanLiteral":
+		lit := &BooleanLiteral{Token: tok}
+		d.value(f.Value, &lit.Value)
+		n.Node = lit
+	case "StringLiteral":
+		lit := &StringLiteral{Token: tok}
+		d.value(f.Value, &lit.Value)
+		n.Node = lit
+	case "PrimitiveCall":
+		n.Node = &PrimitiveCall{
+			Token:     tok,
+			Primitive: as[Expression](&d, "primitive", f.Primitive),
+			Arguments: asList[Expression](&d, "arguments", f.Arguments),
+			Rparen:    decodeToken(f.Rparen),
+		}
+	case "PrefixExpression":
+		n.Node = &PrefixExpression{Token: tok, Operator: f.Operator, Right: as[Expression](&d, "right", f.Right)}
+	case "InfixExpression":
+		n.Node = &InfixExpression{
+			Token:    tok,
+			Left:     as[Expression](&d, "left", f.Left),
+			Operator: f.Operator,
+			Right:    as[Expression](&d, "right", f.Right),
+		}
+	case "List":
+		n.Node = &List{Token: tok, Value: asList[Expression](&d, "elements", f.Elements), Rparen: decodeToken(f.Rparen)}
+	case "SymbolExpression":
+		sym := &SymbolExpression{Token: tok}
+		d.value(f.Value, &sym.Value)
+		n.Node = sym
+	case "Constant":
+		n.Node = &Constant{Token: tok, Value: as[Expression](&d, "datum", f.Datum)}
+	default:
+		return fmt.Errorf("ast: unknown node kind %q", f.Kind)
+	}
+	return d.err
+}
+
+// decoder keeps the first error met while decoding the fields of a node.
+type decoder struct {
+	kind string
+	err  error
+}
+
+func (d *decoder) value(raw json.RawMessage, v any) {
+	if d.err == nil && raw != nil {
+		if err := json.Unmarshal(raw, v); err != nil {
+			d.err = fmt.Errorf("ast: %s value: %w", d.kind, err)
+		}
+	}
+}
+
+func (d *decoder) label(field string, n *jsonNode) Label {
+	if l := as[*Label](d, field, n); l != nil {
+		return *l
+	}
+	return Label{}
+}
+
+// as returns the node decoded for field, which must be an N.
+func as[N Node](d *decoder, field string, n *jsonNode) N {
+	var zero N
+	if n == nil || n.Node == nil {
+		return zero
+	}
+	v, ok := n.Node.(N)
+	if !ok && d.err == nil {
+		d.err = fmt.Errorf("ast: %s %s cannot be a %s", d.kind, field, kindOf(n.Node))
+	}
+	return v
+}
+
+func asList[N Node](d *decoder, field string, list []jsonNode) []N {
+	if list == nil {
+		return nil
+	}
+	out := make([]N, len(list))
+	for i := range list {
+		out[i] = as[N](d, field, &list[i])
+	}
+	return out
+}
+
+func wrap[N Node](n N) jsonNode {
+	if Node(n) == nil {
+		return jsonNode{}
+	}
+	return jsonNode{n}
+}
+
+func wrapPtr[N Node](n N) *jsonNode {
+	if Node(n) == nil {
+		return nil
+	}
+	return &jsonNode{n}
+}
+
+func wrapLabel(l Label) *jsonNode {
+	return &jsonNode{&l}
+}
+
+func wrapList[N Node](list []N) []jsonNode {
+	if list == nil {
+		return nil
+	}
+	out := make([]jsonNode, len(list))
+	for i, n := range list {
+		out[i] = wrap(n)
+	}
+	return out
+}
+
+func encodeToken(t token.Token) *jsonToken {
+	if t == (token.Token{}) {
+		return nil
+	}
+	return &jsonToken{Type: t.Type, Literal: t.Literal, Line: t.Line, Column: t.Column, Offset: t.Offset, File: t.File}
+}
+
+func decodeToken(t *jsonToken) token.Token {
+	if t == nil {
+		return token.Token{}
+	}
+	return token.Token{Type: t.Type, Literal: t.Literal, Line: t.Line, Column: t.Column, Offset: t.Offset, File: t.File}
+}
+
+func encodeTrivia(t *Trivia) *jsonTrivia {
+	if len(t.Leading) == 0 && len(t.Trailing) == 0 {
+		return nil
+	}
+	out := &jsonTrivia{}
+	for _, c := range t.Leading {
+		out.Leading = append(out.Leading, encodeToken(c))
+	}
+	for _, c := range t.Trailing {
+		out.Trailing = append(out.Trailing, encodeToken(c))
+	}
+	return out
+}
+
+func decodeTrivia(t *jsonTrivia) Trivia {
+	var out Trivia
+	if t == nil {
+		return out
+	}
+	for _, c := range t.Leading {
+		out.Leading = append(out.Leading, decodeToken(c))
+	}
+	for _, c := range t.Trailing {
+		out.Trailing = append(out.Trailing, decodeToken(c))
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package ast_test
+
+import (
+	"cogen/ast"
+	"cogen/lexer"
+	"cogen/parser"
+	"cogen/token"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		walkInput,
+		"// pow\npow(m, n); // header\ninit: result := 1; goto test;\n" +
+			"test: if n < 1 goto end else loop;\nloop: result := result * m; n := n - 1; goto test;\n" +
+			"end: return result; // done",
+		`f(x): a: y := not (x <= -3) and true; z := '(a "s" (b 1) 'c false); return concat("\n", hd(z));`,
+		"f(x): a: return x * 123456789012345678901234567890 + '(99999999999999999999);",
+	}
+
+	for _, input := range inputs {
+		p := parser.New(lexer.NewFile("in.fcl", input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+
+		data, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("EncodeJSON: %v", err)
+		}
+		decoded, err := ast.DecodeJSON(data)
+		if err != nil {
+			t.Fatalf("DecodeJSON: %v\n%s", err, data)
+		}
+		if !ast.Equal(program, decoded) {
+			t.Errorf("round trip changed the program.\nwant=%s\ngot =%s", program, decoded)
+		}
+	}
+}
+
+func TestJSONBookDialect(t *testing.T) {
+	program := parser.New(lexer.New("read n;\n1-init: goto done?;\ndone?: return n;", token.BookDialect)).ParseProgram()
+
+	var decoded ast.Program
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !ast.Equal(program, &decoded) {
+		t.Errorf("round trip changed the program.\nwant=%s\ngot =%s", program, &decoded)
+	}
+	if decoded.Dialect != token.BookDialect {
+		t.Errorf("dialect not kept, got %s", decoded.Dialect)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	program := parser.New(lexer.New("f(x): a: goto a;")).ParseProgram()
+	data, err := ast.EncodeJSON(program.Statements[0].Statements[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"version":1,"node":{"kind":"GotoStatement",` +
+		`"token":{"type":"goto","literal":"goto","line":1,"column":9,"offset":9},` +
+		`"label":{"kind":"Label","token":{"type":"LABEL","literal":"a","line":1,"column":14,"offset":14},"value":"a"}}}`
+	if string(data) != want {
+		t.Errorf("wrong encoding.\nwant=%s\ngot =%s", want, data)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{"version":2,"node":null}`, "unsupported JSON version 2"},
+		{`{"version":1,"node":{"kind":"Loop"}}`, `unknown node kind "Loop"`},
+		{`{"version":1,"node":{"kind":"ReturnStatement","returnValue":{"kind":"GotoStatement"}}}`,
+			"ReturnStatement returnValue cannot be a GotoStatement"},
+		{`{"version":1,"node":{"kind":"Identifier","value":1}}`, "Identifier value"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("DecodeJSON(%s): expected error containing %q, got %v", tt.input, tt.want, err)
+		}
+	}
+}
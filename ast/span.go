@@ -0,0 +1,201 @@
+package ast
+
+import (
+	"cogen/token"
+	"fmt"
+)
+
+// Span is the source range [Start, End) a node was parsed from. Nodes
+// synthesized by the generator inherit the start of the node they were
+// derived from, all other synthesized nodes have the zero Span.
+type Span struct {
+	File  string
+	Start token.Pos
+	End   token.Pos
+}
+
+func (s Span) IsValid() bool { return s.Start.IsValid() }
+
+func (s Span) String() string {
+	if !s.IsValid() {
+		return "-"
+	}
+	pos := fmt.Sprintf("%d:%d-%d:%d", s.Start.Line, s.Start.Column, s.End.Line, s.End.Column)
+	if s.File != "" {
+		return s.File + ":" + pos
+	}
+	return pos
+}
+
+// TokenSpan returns the span of a single token.
+func TokenSpan(tok token.Token) Span {
+	if !tok.Pos().IsValid() {
+		return Span{}
+	}
+	return Span{File: tok.File, Start: tok.Pos(), End: tok.End()}
+}
+
+// joinSpans returns the smallest span covering all valid spans.
+func joinSpans(spans ...Span) Span {
+	var res Span
+	for _, s := range spans {
+		if !s.IsValid() {
+			continue
+		}
+		if !res.IsValid() {
+			res = s
+			continue
+		}
+		if s.Start.Offset < res.Start.Offset {
+			res.Start = s.Start
+		}
+		if s.End.Offset > res.End.Offset {
+			res.End = s.End
+		}
+	}
+	return res
+}
+
+func nodeSpan(n Node) Span {
+	if n == nil {
+		return Span{}
+	}
+	return n.Span()
+}
+
+func (p *Program) Span() Span {
+	spans := []Span{}
+	for _, v := range p.Variables {
+		spans = append(spans, nodeSpan(v.Ident))
+	}
+	for _, s := range p.Statements {
+		spans = append(spans, s.Span())
+	}
+	return joinSpans(spans...)
+}
+
+func (ls *LabelStatement) Span() Span {
+	spans := []Span{ls.Label.Span()}
+	for _, s := range ls.Statements {
+		spans = append(spans, nodeSpan(s))
+	}
+	return joinSpans(spans...)
+}
+
+func (ll *Label) Span() Span { return TokenSpan(ll.Token) }
+
+func (gt *GotoStatement) Span() Span {
+	return joinSpans(TokenSpan(gt.Token), gt.Label.Span())
+}
+
+func (rs *ReturnStatement) Span() Span {
+	return joinSpans(TokenSpan(rs.Token), nodeSpan(rs.ReturnValue))
+}
+
+func (is *IfStatement) Span() Span {
+	return joinSpans(TokenSpan(is.Token), nodeSpan(is.Cond), is.LabelTrue.Span(), is.LabelFalse.Span())
+}
+
+func (es *ExpressionStatement) Span() Span {
+	return joinSpans(TokenSpan(es.Token), nodeSpan(es.Expression))
+}
+
+func (as *AssignmentStatement) Span() Span {
+	return joinSpans(nodeSpan(as.Left), TokenSpan(as.Token), nodeSpan(as.Right))
+}
+
+func (i *Identifier) Span() Span { return TokenSpan(i.Token) }
+
+func (ce *CallExpression) Span() Span {
+	return joinSpans(TokenSpan(ce.Token), ce.Label.Span())
+}
+
+func (il *IntegerLiteral) Span() Span { return TokenSpan(il.Token) }
+
+func (b *BooleanLiteral) Span() Span { return TokenSpan(b.Token) }
+
+func (sl *StringLiteral) Span() Span { return TokenSpan(sl.Token) }
+
+func (fc *PrimitiveCall) Span() Span {
+	spans := []Span{nodeSpan(fc.Primitive), TokenSpan(fc.Token), TokenSpan(fc.Rparen)}
+	for _, a := range fc.Arguments {
+		spans = append(spans, nodeSpan(a))
+	}
+	return joinSpans(spans...)
+}
+
+func (pe *PrefixExpression) Span() Span {
+	return joinSpans(TokenSpan(pe.Token), nodeSpan(pe.Right))
+}
+
+func (ie *InfixExpression) Span() Span {
+	return joinSpans(nodeSpan(ie.Left), TokenSpan(ie.Token), nodeSpan(ie.Right))
+}
+
+func (ll *List) Span() Span {
+	spans := []Span{TokenSpan(ll.Token), TokenSpan(ll.Rparen)}
+	for _, e := range ll.Value {
+		spans = append(spans, nodeSpan(e))
+	}
+	return joinSpans(spans...)
+}
+
+func (se *SymbolExpression) Span() Span { return TokenSpan(se.Token) }
+
+func (cs *Constant) Span() Span {
+	return joinSpans(TokenSpan(cs.Token), nodeSpan(cs.Value))
+}
+
+// Inherit gives every token in node that has no position the start position
+// of from, so nodes synthesized from from point back at it.
+func Inherit(node Node, from token.Token) {
+	if !from.Pos().IsValid() {
+		return
+	}
+	stamp := func(tok *token.Token) {
+		if !tok.Pos().IsValid() {
+			tok.Offset, tok.Line, tok.Column, tok.File = from.Offset, from.Line, from.Column, from.File
+		}
+	}
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *LabelStatement:
+			stamp(&n.Token)
+		case *Label:
+			stamp(&n.Token)
+		case *GotoStatement:
+			stamp(&n.Token)
+		case *ReturnStatement:
+			stamp(&n.Token)
+		case *IfStatement:
+			stamp(&n.Token)
+		case *ExpressionStatement:
+			stamp(&n.Token)
+		case *AssignmentStatement:
+			stamp(&n.Token)
+		case *Identifier:
+			stamp(&n.Token)
+		case *CallExpression:
+			stamp(&n.Token)
+		case *IntegerLiteral:
+			stamp(&n.Token)
+		case *BooleanLiteral:
+			stamp(&n.Token)
+		case *StringLiteral:
+			stamp(&n.Token)
+		case *PrimitiveCall:
+			stamp(&n.Token)
+		case *PrefixExpression:
+			stamp(&n.Token)
+		case *InfixExpression:
+			stamp(&n.Token)
+		case *List:
+			stamp(&n.Token)
+		case *SymbolExpression:
+			stamp(&n.Token)
+		case *Constant:
+			stamp(&n.Token)
+		}
+		return true
+	})
+}
@@ -0,0 +1,235 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called by Walk for every node it reaches. If
+// the returned visitor w is not nil, Walk visits each child of node with w
+// and then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order, children
+// left to right as they are printed. Labels are visited as *Label nodes,
+// both where they are defined and where they are jumped to or called, and
+// point into their parent so a visitor may change them in place.
+func Walk(v Visitor, node Node) {
+	if node == nil {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, in := range n.Variables {
+			walkIdent(v, in.Ident)
+		}
+		for _, s := range n.Statements {
+			if s != nil {
+				Walk(v, s)
+			}
+		}
+	case *LabelStatement:
+		Walk(v, &n.Label)
+		walkList(v, n.Statements)
+	case *GotoStatement:
+		Walk(v, &n.Label)
+	case *ReturnStatement:
+		Walk(v, n.ReturnValue)
+	case *IfStatement:
+		Walk(v, n.Cond)
+		Walk(v, &n.LabelTrue)
+		Walk(v, &n.LabelFalse)
+	case *ExpressionStatement:
+		Walk(v, n.Expression)
+	case *AssignmentStatement:
+		walkIdent(v, n.Left)
+		Walk(v, n.Right)
+	case *CallExpression:
+		Walk(v, &n.Label)
+	case *PrimitiveCall:
+		Walk(v, n.Primitive)
+		walkList(v, n.Arguments)
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *List:
+		walkList(v, n.Value)
+	case *Constant:
+		Walk(v, n.Value)
+	case *Label, *Identifier, *IntegerLiteral, *BooleanLiteral, *StringLiteral, *SymbolExpression:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// walkIdent keeps a nil *Identifier from reaching Walk as a non-nil Node.
+func walkIdent(v Visitor, id *Identifier) {
+	if id != nil {
+		Walk(v, id)
+	}
+}
+
+func walkList[N Node](v Visitor, list []N) {
+	for _, n := range list {
+		Walk(v, n)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in the order of Walk, calling
+// f for every node. If f returns true, Inspect goes on into the children of
+// the node and calls f(nil) once they are done.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite rebuilds the tree rooted at node bottom-up: the children of a
+// node are rewritten first, then fn is called with a copy of the node that
+// holds the new children, and its result takes the place of the node.
+// Returning the argument keeps the node. node itself is never modified;
+// leaves fn keeps are shared between the two trees.
+//
+// fn must return a node that fits where the old one was: an Expression
+// for an expression, a Statement for a statement, a *LabelStatement,
+// *Identifier or *Label for those nodes. Rewrite panics otherwise.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	if node == nil {
+		return nil
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		c := *n
+		c.Variables = make([]Input, len(n.Variables))
+		for i, in := range n.Variables {
+			c.Variables[i] = Input{Ident: rewriteIdent(in.Ident, fn), Value: in.Value}
+		}
+		c.Statements = make([]*LabelStatement, len(n.Statements))
+		for i, s := range n.Statements {
+			if s != nil {
+				c.Statements[i] = rewriteAs[*LabelStatement](s, fn)
+			}
+		}
+		return fn(&c)
+	case *LabelStatement:
+		c := *n
+		c.Label = rewriteLabel(n.Label, fn)
+		c.Statements = rewriteList(n.Statements, fn)
+		return fn(&c)
+	case *Label:
+		c := *n
+		return fn(&c)
+	case *GotoStatement:
+		c := *n
+		c.Label = rewriteLabel(n.Label, fn)
+		return fn(&c)
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValue = rewriteAs[Expression](n.ReturnValue, fn)
+		return fn(&c)
+	case *IfStatement:
+		c := *n
+		c.Cond = rewriteAs[Expression](n.Cond, fn)
+		c.LabelTrue = rewriteLabel(n.LabelTrue, fn)
+		c.LabelFalse = rewriteLabel(n.LabelFalse, fn)
+		return fn(&c)
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = rewriteAs[Expression](n.Expression, fn)
+		return fn(&c)
+	case *AssignmentStatement:
+		c := *n
+		c.Left = rewriteIdent(n.Left, fn)
+		c.Right = rewriteAs[Expression](n.Right, fn)
+		return fn(&c)
+	case *CallExpression:
+		c := *n
+		c.Label = rewriteLabel(n.Label, fn)
+		return fn(&c)
+	case *PrimitiveCall:
+		c := *n
+		c.Primitive = rewriteAs[Expression](n.Primitive, fn)
+		c.Arguments = rewriteList(n.Arguments, fn)
+		return fn(&c)
+	case *PrefixExpression:
+		c := *n
+		c.Right = rewriteAs[Expression](n.Right, fn)
+		return fn(&c)
+	case *InfixExpression:
+		c := *n
+		c.Left = rewriteAs[Expression](n.Left, fn)
+		c.Right = rewriteAs[Expression](n.Right, fn)
+		return fn(&c)
+	case *List:
+		c := *n
+		c.Value = rewriteList(n.Value, fn)
+		return fn(&c)
+	case *Constant:
+		c := *n
+		c.Value = rewriteAs[Expression](n.Value, fn)
+		return fn(&c)
+	case *Identifier, *IntegerLiteral, *BooleanLiteral, *StringLiteral, *SymbolExpression:
+		return fn(n)
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+}
+
+// rewriteAs rewrites node and checks that the result still has type N. A
+// nil node, or a nil result, gives the zero N.
+func rewriteAs[N Node](node N, fn func(Node) Node) N {
+	var zero N
+	if Node(node) == nil {
+		return zero
+	}
+	r := Rewrite(node, fn)
+	if r == nil {
+		return zero
+	}
+	out, ok := r.(N)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T cannot replace %T", r, node))
+	}
+	return out
+}
+
+func rewriteIdent(id *Identifier, fn func(Node) Node) *Identifier {
+	if id == nil {
+		return nil
+	}
+	return rewriteAs[*Identifier](id, fn)
+}
+
+func rewriteLabel(l Label, fn func(Node) Node) Label {
+	if r := rewriteAs[*Label](&l, fn); r != nil {
+		return *r
+	}
+	return Label{}
+}
+
+func rewriteList[N Node](list []N, fn func(Node) Node) []N {
+	if list == nil {
+		return nil
+	}
+	out := make([]N, len(list))
+	for i, n := range list {
+		out[i] = rewriteAs[N](n, fn)
+	}
+	return out
+}
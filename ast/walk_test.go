@@ -0,0 +1,149 @@
+package ast_test
+
+import (
+	"cogen/ast"
+	"cogen/lexer"
+	"cogen/parser"
+	"cogen/token"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+const walkInput = `f(x):
+init: y := x + 1; if y < 3 goto done else loop;
+loop: z := call done; goto done;
+done: return cons('a, y);`
+
+func TestInspectOrder(t *testing.T) {
+	program := parse(t, walkInput)
+
+	var got []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			got = append(got, "id "+n.Value)
+		case *ast.Label:
+			got = append(got, "label "+n.Value)
+		case *ast.SymbolExpression:
+			got = append(got, "sym "+n.Value)
+		}
+		return true
+	})
+
+	want := []string{
+		"id x",
+		"label init", "id y", "id x", "id y", "label done", "label loop",
+		"label loop", "id z", "label done", "label done",
+		"label done", "id cons", "sym a", "id y",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("wrong order.\nwant=%v\ngot =%v", want, got)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	program := parse(t, walkInput)
+
+	depth, maxDepth := 0, 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		if _, ok := n.(*ast.Constant); ok {
+			t.Errorf("pruned below statements, but reached %s", n)
+		}
+		if _, ok := n.(*ast.LabelStatement); !ok {
+			if _, ok := n.(ast.Statement); ok {
+				return false
+			}
+		}
+		depth++
+		maxDepth = max(maxDepth, depth)
+		return true
+	})
+
+	if depth != 0 {
+		t.Errorf("Visit(nil) calls do not balance, depth=%d", depth)
+	}
+	// program, label statement, label
+	if maxDepth != 3 {
+		t.Errorf("maxDepth wrong. want=3, got=%d", maxDepth)
+	}
+}
+
+func TestWalkMutatesLabels(t *testing.T) {
+	program := parse(t, walkInput)
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		if l, ok := n.(*ast.Label); ok && l.Value == "done" {
+			l.Value = "exit"
+		}
+		return true
+	})
+
+	if s := program.String(); strings.Contains(s, "done") || strings.Count(s, "exit") != 4 {
+		t.Errorf("labels not renamed in place:\n%s", s)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := parse(t, walkInput)
+	before := program.String()
+
+	out := ast.Rewrite(program, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if n.Value == "y" {
+				return &ast.Identifier{Token: n.Token, Value: "w"}
+			}
+		case *ast.Label:
+			n.Value = strings.ToUpper(n.Value)
+		case *ast.InfixExpression:
+			// Children are rewritten first.
+			if left, ok := n.Left.(*ast.Identifier); ok && left.Value == "w" {
+				return &ast.BooleanLiteral{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+			}
+		}
+		return n
+	})
+
+	if program.String() != before {
+		t.Errorf("Rewrite modified its input:\n%s", program.String())
+	}
+
+	got := out.(*ast.Program).String()
+	for _, want := range []string{"INIT:", "w := (x + 1)", "if true DONE else LOOP", "cons('a, w)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rewritten program missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRewriteWrongType(t *testing.T) {
+	program := parse(t, walkInput)
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "cannot replace") {
+			t.Errorf("expected a panic about the replacement, got %v", r)
+		}
+	}()
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.Identifier); ok {
+			return &ast.GotoStatement{}
+		}
+		return n
+	})
+}
@@ -0,0 +1,187 @@
+// Package cfg builds the control flow graph of an FCL program. Every label
+// statement is a basic block: its statements run in order up to the first
+// goto, if or return, which ends the block. Edges follow the jumps, and a
+// call adds an edge to the called block whose control comes back to the
+// statement after the call.
+package cfg
+
+import (
+	"cogen/ast"
+	"fmt"
+)
+
+// EdgeKind says how control moves along an edge.
+type EdgeKind int
+
+const (
+	Goto   EdgeKind = iota // goto L
+	True                   // if c L1 else L2, taken when c holds
+	False                  // the else of an if
+	Call                   // x := call L, which comes back after the call
+	Return                 // return e, to the exit
+	End                    // a block without a jump, which ends the program
+)
+
+func (k EdgeKind) String() string {
+	names := [...]string{"goto", "true", "false", "call", "return", "end"}
+	if int(k) < 0 || int(k) >= len(names) {
+		return fmt.Sprintf("EdgeKind(%d)", int(k))
+	}
+	return names[k]
+}
+
+// An Edge leads from the block holding Stmt to the block control goes to.
+type Edge struct {
+	Kind     EdgeKind
+	From, To *Block
+	Stmt     ast.Statement // the jump, call or return; the last statement for End
+}
+
+// A Block is a label statement of the program, or the exit.
+type Block struct {
+	Index int                 // position in Graph.Blocks
+	Name  string              // the label, or "exit"
+	Node  *ast.LabelStatement // nil for the exit
+	Stmts []ast.Statement     // the statements that run, up to the first jump
+	Succs []*Edge             // in the order of the statements
+	Preds []*Edge
+
+	idom *Block
+}
+
+// Dead returns the statements of b after its first jump, which never run.
+func (b *Block) Dead() []ast.Statement {
+	if b.Node == nil {
+		return nil
+	}
+	return b.Node.Statements[len(b.Stmts):]
+}
+
+// IsExit reports whether b is the exit of its graph.
+func (b *Block) IsExit() bool { return b.Node == nil }
+
+func (b *Block) String() string { return b.Name }
+
+// Graph is the control flow graph of a program.
+type Graph struct {
+	Program *ast.Program
+	Blocks  []*Block     // one per label statement in program order, then Exit
+	Entry   *Block       // the first block, or Exit if the program has none
+	Exit    *Block       // where returns and blocks without a jump go
+	Missing []*ast.Label // jump and call targets that name no block
+
+	labels map[string]*Block
+}
+
+// New builds the graph of program. A label defined twice names its first
+// block, as in the evaluator, so later blocks of the name are never reached.
+func New(program *ast.Program) *Graph {
+	g := &Graph{Program: program, labels: map[string]*Block{}}
+	for _, stmt := range program.Statements {
+		b := &Block{Index: len(g.Blocks), Name: stmt.Label.Value, Node: stmt, Stmts: live(stmt.Statements)}
+		g.Blocks = append(g.Blocks, b)
+		if _, ok := g.labels[b.Name]; !ok {
+			g.labels[b.Name] = b
+		}
+	}
+	g.Exit = &Block{Index: len(g.Blocks), Name: "exit"}
+	g.Blocks = append(g.Blocks, g.Exit)
+	g.Entry = g.Blocks[0]
+
+	for _, b := range g.Blocks[:len(g.Blocks)-1] {
+		g.addEdges(b)
+	}
+	g.computeDominators()
+	return g
+}
+
+// live returns the statements up to and including the first jump.
+func live(stmts []ast.Statement) []ast.Statement {
+	for i, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.GotoStatement, *ast.IfStatement, *ast.ReturnStatement:
+			return stmts[:i+1]
+		}
+	}
+	return stmts
+}
+
+func (g *Graph) addEdges(b *Block) {
+	for _, stmt := range b.Stmts {
+		switch s := stmt.(type) {
+		case *ast.GotoStatement:
+			g.addEdge(Goto, b, &s.Label, stmt)
+			return
+		case *ast.IfStatement:
+			g.addEdge(True, b, &s.LabelTrue, stmt)
+			g.addEdge(False, b, &s.LabelFalse, stmt)
+			return
+		case *ast.ReturnStatement:
+			g.link(Return, b, g.Exit, stmt)
+			return
+		default:
+			ast.Inspect(stmt, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpression); ok {
+					g.addEdge(Call, b, &call.Label, stmt)
+				}
+				return true
+			})
+		}
+	}
+	var last ast.Statement
+	if len(b.Stmts) > 0 {
+		last = b.Stmts[len(b.Stmts)-1]
+	}
+	g.link(End, b, g.Exit, last)
+}
+
+func (g *Graph) addEdge(kind EdgeKind, from *Block, target *ast.Label, stmt ast.Statement) {
+	to := g.labels[target.Value]
+	if to == nil {
+		g.Missing = append(g.Missing, target)
+		return
+	}
+	g.link(kind, from, to, stmt)
+}
+
+func (g *Graph) link(kind EdgeKind, from, to *Block, stmt ast.Statement) {
+	e := &Edge{Kind: kind, From: from, To: to, Stmt: stmt}
+	from.Succs = append(from.Succs, e)
+	to.Preds = append(to.Preds, e)
+}
+
+// Block returns the block a jump to label goes to, or nil.
+func (g *Graph) Block(label string) *Block {
+	return g.labels[label]
+}
+
+// Reachable returns the blocks control can reach from the given blocks,
+// those included, in program order.
+func (g *Graph) Reachable(from ...*Block) []*Block {
+	seen := make([]bool, len(g.Blocks))
+	work := []*Block{}
+	for _, b := range from {
+		if !seen[b.Index] {
+			seen[b.Index] = true
+			work = append(work, b)
+		}
+	}
+	for len(work) > 0 {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, e := range b.Succs {
+			if !seen[e.To.Index] {
+				seen[e.To.Index] = true
+				work = append(work, e.To)
+			}
+		}
+	}
+
+	var out []*Block
+	for _, b := range g.Blocks {
+		if seen[b.Index] {
+			out = append(out, b)
+		}
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package cfg_test
+
+import (
+	"cogen/cfg"
+	"cogen/lexer"
+	"cogen/parser"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func build(t *testing.T, input string) *cfg.Graph {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	return cfg.New(program)
+}
+
+func edges(list []*cfg.Edge) string {
+	var out []string
+	for _, e := range list {
+		out = append(out, fmt.Sprintf("%s-%s->%s", e.From, e.Kind, e.To))
+	}
+	return strings.Join(out, " ")
+}
+
+const pow = `pow(m, n);
+init: result := 1; goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m; n := n - 1; goto test;
+end: return result;`
+
+func TestEdges(t *testing.T) {
+	g := build(t, pow)
+
+	tests := []struct {
+		block, succs, preds string
+	}{
+		{"init", "init-goto->test", ""},
+		{"test", "test-true->end test-false->loop", "init-goto->test loop-goto->test"},
+		{"loop", "loop-goto->test", "test-false->loop"},
+		{"end", "end-return->exit", "test-true->end"},
+	}
+	for _, tt := range tests {
+		b := g.Block(tt.block)
+		if got := edges(b.Succs); got != tt.succs {
+			t.Errorf("%s successors wrong. want=%q, got=%q", tt.block, tt.succs, got)
+		}
+		if got := edges(b.Preds); got != tt.preds {
+			t.Errorf("%s predecessors wrong. want=%q, got=%q", tt.block, tt.preds, got)
+		}
+	}
+	if g.Entry != g.Block("init") || !g.Exit.IsExit() || len(g.Blocks) != 5 {
+		t.Errorf("wrong entry, exit or blocks: %v %v %v", g.Entry, g.Exit, g.Blocks)
+	}
+}
+
+func TestCallsAndEnds(t *testing.T) {
+	g := build(t, `f(n);
+a: x := call b; y := call nope; return x; n := 1;
+b: n := n + 1;
+c: goto a;`)
+
+	if got := edges(g.Block("a").Succs); got != "a-call->b a-return->exit" {
+		t.Errorf("a successors wrong, got %q", got)
+	}
+	if got := edges(g.Block("b").Succs); got != "b-end->exit" {
+		t.Errorf("b successors wrong, got %q", got)
+	}
+	if len(g.Missing) != 1 || g.Missing[0].Value != "nope" {
+		t.Errorf("expected nope to be missing, got %v", g.Missing)
+	}
+	if a := g.Block("a"); len(a.Stmts) != 3 || len(a.Dead()) != 1 {
+		t.Errorf("expected 3 live and 1 dead statement, got %d and %d", len(a.Stmts), len(a.Dead()))
+	}
+
+	var reached []string
+	for _, b := range g.Reachable(g.Entry) {
+		reached = append(reached, b.Name)
+	}
+	if got := strings.Join(reached, " "); got != "a b exit" {
+		t.Errorf("wrong reachable blocks, got %q", got)
+	}
+	if c := g.Block("c"); c.Idom() != nil || g.Entry.Dominates(c) {
+		t.Errorf("unreachable block has a dominator")
+	}
+}
+
+func TestDominators(t *testing.T) {
+	g := build(t, `f(n);
+a: if n goto b else c;
+b: goto d;
+c: goto d;
+d: if n goto a else e;
+e: return n;`)
+
+	idoms := map[string]string{"a": "", "b": "a", "c": "a", "d": "a", "e": "d", "exit": "e"}
+	for name, want := range idoms {
+		b := g.Block(name)
+		if name == "exit" {
+			b = g.Exit
+		}
+		got := ""
+		if b.Idom() != nil {
+			got = b.Idom().Name
+		}
+		if got != want {
+			t.Errorf("idom(%s) wrong. want=%q, got=%q", name, want, got)
+		}
+	}
+
+	if !g.Block("a").Dominates(g.Block("e")) || g.Block("b").Dominates(g.Block("d")) {
+		t.Errorf("wrong dominance between blocks")
+	}
+	if !g.Block("d").Dominates(g.Block("d")) {
+		t.Errorf("a block must dominate itself")
+	}
+}
+
+func TestLoops(t *testing.T) {
+	g := build(t, pow)
+	loops := g.Loops()
+	if len(loops) != 1 {
+		t.Fatalf("expected one loop, got %d", len(loops))
+	}
+	l := loops[0]
+	var body []string
+	for _, b := range l.Blocks {
+		body = append(body, b.Name)
+	}
+	if l.Header.Name != "test" || strings.Join(body, " ") != "test loop" || edges(l.BackEdges) != "loop-goto->test" {
+		t.Errorf("wrong loop: header %s, blocks %v, back edges %s", l.Header, body, edges(l.BackEdges))
+	}
+	if !l.Contains(g.Block("loop")) || l.Contains(g.Block("init")) {
+		t.Errorf("wrong loop membership")
+	}
+
+	// Jumping into the middle of a cycle makes it irreducible: no block of
+	// it dominates the others, so it is no natural loop.
+	g = build(t, `f(n);
+a: if n goto b else c;
+b: goto c;
+c: if n goto b else d;
+d: return n;`)
+	if loops := g.Loops(); len(loops) != 0 {
+		t.Errorf("expected no natural loop, got header %s", loops[0].Header)
+	}
+}
@@ -0,0 +1,165 @@
+package cfg
+
+// computeDominators finds the immediate dominator of every block reachable
+// from the entry with the iterative algorithm of Cooper, Harvey and
+// Kennedy, over all edges calls included.
+func (g *Graph) computeDominators() {
+	order := g.postorder()
+	if len(order) == 0 {
+		return
+	}
+	post := make([]int, len(g.Blocks))
+	for i := range post {
+		post[i] = -1
+	}
+	for i, b := range order {
+		post[b.Index] = i
+	}
+
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for post[a.Index] < post[b.Index] {
+				a = a.idom
+			}
+			for post[b.Index] < post[a.Index] {
+				b = b.idom
+			}
+		}
+		return a
+	}
+
+	g.Entry.idom = g.Entry
+	for changed := true; changed; {
+		changed = false
+		for i := len(order) - 1; i >= 0; i-- {
+			b := order[i]
+			if b == g.Entry {
+				continue
+			}
+			var idom *Block
+			for _, e := range b.Preds {
+				p := e.From
+				if p.idom == nil {
+					continue
+				}
+				if idom == nil {
+					idom = p
+				} else {
+					idom = intersect(p, idom)
+				}
+			}
+			if b.idom != idom {
+				b.idom = idom
+				changed = true
+			}
+		}
+	}
+}
+
+// postorder returns the blocks reachable from the entry in depth-first
+// postorder.
+func (g *Graph) postorder() []*Block {
+	var order []*Block
+	seen := make([]bool, len(g.Blocks))
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		seen[b.Index] = true
+		for _, e := range b.Succs {
+			if !seen[e.To.Index] {
+				visit(e.To)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(g.Entry)
+	return order
+}
+
+// Idom returns the immediate dominator of b: the last block before b on
+// every path from the entry. It is nil for the entry and for blocks the
+// entry does not reach.
+func (b *Block) Idom() *Block {
+	if b.idom == b {
+		return nil
+	}
+	return b.idom
+}
+
+// Dominates reports whether every path from the entry to b passes through
+// a. A block dominates itself; a block the entry does not reach is
+// dominated by none.
+func (a *Block) Dominates(b *Block) bool {
+	if b.idom == nil {
+		return false
+	}
+	for ; b != a; b = b.idom {
+		if b.idom == b {
+			return false
+		}
+	}
+	return true
+}
+
+// A Loop is a natural loop: the blocks that can reach one of its back
+// edges without passing through Header, which dominates them all.
+type Loop struct {
+	Header    *Block
+	Blocks    []*Block // in program order, the header included
+	BackEdges []*Edge  // edges from the body to the header
+}
+
+// Contains reports whether b is part of the loop.
+func (l *Loop) Contains(b *Block) bool {
+	for _, x := range l.Blocks {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Loops returns the natural loops of g, one per header, in program order
+// of the headers. Back edges with the same header share a loop.
+func (g *Graph) Loops() []*Loop {
+	var loops []*Loop
+	for _, h := range g.Blocks {
+		var back []*Edge
+		for _, e := range h.Preds {
+			if h.Dominates(e.From) {
+				back = append(back, e)
+			}
+		}
+		if len(back) == 0 {
+			continue
+		}
+
+		in := make([]bool, len(g.Blocks))
+		in[h.Index] = true
+		var work []*Block
+		for _, e := range back {
+			if !in[e.From.Index] {
+				in[e.From.Index] = true
+				work = append(work, e.From)
+			}
+		}
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, e := range b.Preds {
+				if !in[e.From.Index] && e.From.idom != nil {
+					in[e.From.Index] = true
+					work = append(work, e.From)
+				}
+			}
+		}
+
+		l := &Loop{Header: h, BackEdges: back}
+		for _, b := range g.Blocks {
+			if in[b.Index] {
+				l.Blocks = append(l.Blocks, b)
+			}
+		}
+		loops = append(loops, l)
+	}
+	return loops
+}
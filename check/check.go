@@ -0,0 +1,172 @@
+// Package check finds mistakes in FCL programs without running them: jumps
+// to labels that are not defined, blocks that never jump, variables read
+// before they are assigned and code that can never run. Each kind of
+// mistake is a Rule, and rules can be enabled one by one.
+package check
+
+import (
+	"cogen/ast"
+	"cogen/cfg"
+	"cogen/diagnostics"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Rule is one kind of mistake the checker looks for.
+type Rule struct {
+	Name string // how the rule is enabled and disabled, e.g. undefined-label
+	Code diagnostics.Code
+	Doc  string // what the rule reports, in a few words
+	run  func(p *pass)
+}
+
+var (
+	UndefinedLabel = &Rule{
+		Name: "undefined-label",
+		Code: diagnostics.UndefinedLabel,
+		Doc:  "goto, if and call targets that are not defined",
+		run:  undefinedLabel,
+	}
+	MissingJump = &Rule{
+		Name: "missing-jump",
+		Code: diagnostics.MissingJump,
+		Doc:  "blocks without a goto, if or return",
+		run:  missingJump,
+	}
+	DuplicateLabel = &Rule{
+		Name: "duplicate-label",
+		Code: diagnostics.DuplicateLabel,
+		Doc:  "labels defined more than once",
+		run:  duplicateLabel,
+	}
+	UnreachableBlock = &Rule{
+		Name: "unreachable-block",
+		Code: diagnostics.UnreachableBlock,
+		Doc:  "blocks no jump or call from the first block reaches",
+		run:  unreachableBlock,
+	}
+	UnassignedVariable = &Rule{
+		Name: "unassigned-variable",
+		Code: diagnostics.UnassignedVariable,
+		Doc:  "variables read before they are assigned on some path",
+		run:  unassignedVariable,
+	}
+	UnreachableStatement = &Rule{
+		Name: "unreachable-statement",
+		Code: diagnostics.UnreachableStatement,
+		Doc:  "statements after the goto, if or return of their block",
+		run:  unreachableStatement,
+	}
+)
+
+// Rules holds every rule, in the order Run applies them.
+var Rules = []*Rule{
+	UndefinedLabel,
+	MissingJump,
+	DuplicateLabel,
+	UnreachableBlock,
+	UnassignedVariable,
+	UnreachableStatement,
+}
+
+// Lookup returns the rule with the given name, or nil.
+func Lookup(name string) *Rule {
+	for _, r := range Rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Select returns the rules named in enable, or all rules if enable is
+// empty, without those named in disable.
+func Select(enable, disable []string) ([]*Rule, error) {
+	selected := Rules
+	if len(enable) > 0 {
+		selected = nil
+		for _, name := range enable {
+			r := Lookup(name)
+			if r == nil {
+				return nil, unknownRule(name)
+			}
+			selected = append(selected, r)
+		}
+	}
+
+	off := map[*Rule]bool{}
+	for _, name := range disable {
+		r := Lookup(name)
+		if r == nil {
+			return nil, unknownRule(name)
+		}
+		off[r] = true
+	}
+	var out []*Rule
+	for _, r := range selected {
+		if !off[r] {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func unknownRule(name string) error {
+	names := make([]string, len(Rules))
+	for i, r := range Rules {
+		names[i] = r.Name
+	}
+	return fmt.Errorf("unknown rule %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Run applies rules to program and returns what they found, in source
+// order.
+func Run(program *ast.Program, rules []*Rule) []diagnostics.Diagnostic {
+	p := &pass{program: program, graph: cfg.New(program)}
+	for _, r := range rules {
+		p.rule = r
+		r.run(p)
+	}
+
+	sort.SliceStable(p.diags, func(i, j int) bool {
+		a, b := p.diags[i].Range.Start, p.diags[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return p.diags
+}
+
+// pass holds what the rules share while checking one program.
+type pass struct {
+	program *ast.Program
+	graph   *cfg.Graph
+	rule    *Rule
+	diags   []diagnostics.Diagnostic
+}
+
+// report adds a diagnostic of the running rule about node. The result
+// stays valid until the next report, for adding notes and fixes.
+func (p *pass) report(severity diagnostics.Severity, node ast.Node, format string, a ...any) *diagnostics.Diagnostic {
+	p.diags = append(p.diags, diagnostics.Diagnostic{
+		Severity: severity,
+		Code:     p.rule.Code,
+		Message:  fmt.Sprintf(format, a...),
+		Range:    diagnostics.FromNode(node),
+	})
+	return &p.diags[len(p.diags)-1]
+}
+
+// targets returns the labels stmt jumps to or calls.
+func targets(stmt ast.Statement) []*ast.Label {
+	var labels []*ast.Label
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if l, ok := n.(*ast.Label); ok {
+			labels = append(labels, l)
+		}
+		return true
+	})
+	return labels
+}
@@ -0,0 +1,147 @@
+package check_test
+
+import (
+	"cogen/check"
+	"cogen/diagnostics"
+	"cogen/lexer"
+	"cogen/parser"
+	"fmt"
+	"testing"
+)
+
+type found struct {
+	code    diagnostics.Code
+	line    int
+	message string
+}
+
+func run(t *testing.T, input string, rules ...*check.Rule) []found {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	if rules == nil {
+		rules = check.Rules
+	}
+	var out []found
+	for _, d := range check.Run(program, rules) {
+		out = append(out, found{d.Code, d.Range.Start.Line, d.Message})
+	}
+	return out
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []found
+	}{
+		{"clean", `pow(m, n);
+init: result := 1; goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m; n := n - 1; goto test;
+end: return result;`, nil},
+		{"undefined label", `f(n);
+a: if n < 1 goto b else c;
+b: x := call d; return x;`, []found{
+			{diagnostics.UndefinedLabel, 2, "label c is not defined"},
+			{diagnostics.UndefinedLabel, 3, "label d is not defined"},
+		}},
+		{"missing jump", `f(n);
+a: goto b;
+b: n := 1;`, []found{
+			{diagnostics.MissingJump, 3, "block b does not end in a goto, if or return"},
+		}},
+		{"duplicate label", `f(n);
+a: goto b;
+b: return 1;
+b: return 2;`, []found{
+			{diagnostics.DuplicateLabel, 4, "label b is already defined"},
+		}},
+		{"unreachable block", `f(n);
+a: return n;
+b: goto a;`, []found{
+			{diagnostics.UnreachableBlock, 3, "block b is never reached"},
+		}},
+		{"unreachable statement", `f(n);
+a: return n; n := 1; goto a;`, []found{
+			{diagnostics.UnreachableStatement, 2, "statement after return is never run"},
+		}},
+		{"unassigned on one path", `f(n);
+a: if n goto b else c;
+b: x := 1; goto c;
+c: return x;`, []found{
+			{diagnostics.UnassignedVariable, 4, "x may be read before it is assigned"},
+		}},
+		{"never assigned", `f(n);
+a: return hd(y);`, []found{
+			{diagnostics.UnassignedVariable, 2, "y is never assigned"},
+		}},
+		{"assigned in loop before read", `f(n);
+a: x := 0; goto b;
+b: x := x + 1; if x < n goto b else c;
+c: return x;`, nil},
+		{"called block sees the caller", `f(n);
+a: x := 1; y := call b; return y;
+b: return x + n;`, nil},
+		{"call result is assigned after the call", `f(n);
+a: y := call b; return y;
+b: return y;`, []found{
+			{diagnostics.UnassignedVariable, 3, "y may be read before it is assigned"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := run(t, tt.input)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("wrong diagnostics.\nwant=%v\ngot =%v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUndefinedLabelSuggestion(t *testing.T) {
+	p := parser.New(lexer.New("f(n);\nloop: goto lop;"))
+	diags := check.Run(p.ParseProgram(), []*check.Rule{check.UndefinedLabel})
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", diags)
+	}
+	d := diags[0]
+	if d.Fix == nil || d.Fix.Replacement != "loop" || len(d.Related) != 1 || d.Related[0].Range.Start.Line != 2 {
+		t.Errorf("expected a suggestion of loop, got %+v", d)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	input := `f(n);
+a: return n; n := 1;
+b: x := y;`
+
+	if got := run(t, input, check.UnreachableStatement); len(got) != 1 || got[0].code != diagnostics.UnreachableStatement {
+		t.Errorf("expected only the unreachable statement, got %v", got)
+	}
+
+	rules, err := check.Select(nil, []string{"unreachable-block", "missing-jump"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != len(check.Rules)-2 {
+		t.Errorf("expected %d rules, got %d", len(check.Rules)-2, len(rules))
+	}
+	for _, d := range run(t, input, rules...) {
+		if d.code == diagnostics.UnreachableBlock || d.code == diagnostics.MissingJump {
+			t.Errorf("disabled rule reported %v", d)
+		}
+	}
+
+	rules, err = check.Select([]string{"duplicate-label"}, nil)
+	if err != nil || len(rules) != 1 || rules[0] != check.DuplicateLabel {
+		t.Errorf("expected duplicate-label alone, got %v, %v", rules, err)
+	}
+	if _, err := check.Select([]string{"no-such-rule"}, nil); err == nil {
+		t.Errorf("expected an error for an unknown rule")
+	}
+}
@@ -0,0 +1,148 @@
+package check
+
+import (
+	"cogen/ast"
+	"cogen/cfg"
+	"cogen/dataflow"
+	"cogen/diagnostics"
+)
+
+func undefinedLabel(p *pass) {
+	for _, block := range p.program.Statements {
+		for _, stmt := range block.Statements {
+			for _, l := range targets(stmt) {
+				if p.graph.Block(l.Value) != nil {
+					continue
+				}
+				d := p.report(diagnostics.Error, l, "label %s is not defined", l.Value)
+				if near := p.nearestLabel(l.Value); near != nil {
+					d.Related = []diagnostics.Note{{
+						Message: "did you mean " + near.Label.Value + "?",
+						Range:   diagnostics.FromNode(&near.Label),
+					}}
+					d.Fix = &diagnostics.Fix{
+						Message:     "rename the target",
+						Range:       d.Range,
+						Replacement: near.Label.Value,
+					}
+				}
+			}
+		}
+	}
+}
+
+// nearestLabel returns the block whose label is the closest misspelling
+// of name, or nil if no label is close.
+func (p *pass) nearestLabel(name string) *ast.LabelStatement {
+	var best *ast.LabelStatement
+	bestDist := min(2, len(name)-1)
+	for _, block := range p.program.Statements {
+		if d := editDistance(name, block.Label.Value); d <= bestDist && (best == nil || d < bestDist) {
+			best, bestDist = block, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func missingJump(p *pass) {
+	for _, b := range p.graph.Blocks {
+		for _, e := range b.Succs {
+			if e.Kind == cfg.End {
+				p.report(diagnostics.Error, &b.Node.Label, "block %s does not end in a goto, if or return", b.Name)
+			}
+		}
+	}
+}
+
+func duplicateLabel(p *pass) {
+	for _, b := range p.graph.Blocks {
+		first := p.graph.Block(b.Name)
+		if b.IsExit() || first == b {
+			continue
+		}
+		d := p.report(diagnostics.Error, &b.Node.Label, "label %s is already defined", b.Name)
+		d.Related = []diagnostics.Note{{
+			Message: "first defined here",
+			Range:   diagnostics.FromNode(&first.Node.Label),
+		}}
+	}
+}
+
+func unreachableBlock(p *pass) {
+	reached := map[*cfg.Block]bool{}
+	for _, b := range p.graph.Reachable(p.graph.Entry) {
+		reached[b] = true
+	}
+
+	for _, b := range p.graph.Blocks {
+		// A second block of the same name is reported as a duplicate.
+		if !b.IsExit() && !reached[b] && p.graph.Block(b.Name) == b {
+			p.report(diagnostics.Warning, &b.Node.Label, "block %s is never reached", b.Name)
+		}
+	}
+}
+
+func unreachableStatement(p *pass) {
+	for _, b := range p.graph.Blocks {
+		if dead := b.Dead(); len(dead) > 0 {
+			jump := b.Stmts[len(b.Stmts)-1]
+			p.report(diagnostics.Warning, dead[0], "statement after %s is never run", jump.TokenLiteral())
+		}
+	}
+}
+
+// unassignedVariable reports the reads of variables that are not assigned
+// on every path from the inputs. A call enters its block with the
+// variables of the caller, which the called block can read.
+func unassignedVariable(p *pass) {
+	everAssigned := map[string]bool{}
+	for _, in := range p.program.Variables {
+		everAssigned[in.Ident.Value] = true
+	}
+	for _, block := range p.program.Statements {
+		for _, stmt := range block.Statements {
+			if d := dataflow.Def(stmt); d != nil {
+				everAssigned[d.Value] = true
+			}
+		}
+	}
+
+	// Blocks the entry does not reach have every variable assigned.
+	r := dataflow.DefiniteAssignment(p.graph)
+	for _, b := range p.graph.Blocks {
+		for i, stmt := range b.Stmts {
+			assigned := r.Before(b, i)
+			for _, id := range dataflow.Uses(stmt) {
+				if assigned.Has(id.Value) {
+					continue
+				}
+				if everAssigned[id.Value] {
+					p.report(diagnostics.Warning, id, "%s may be read before it is assigned", id.Value)
+				} else {
+					p.report(diagnostics.Error, id, "%s is never assigned", id.Value)
+				}
+			}
+		}
+	}
+}
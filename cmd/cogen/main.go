@@ -44,7 +44,7 @@ func main() {
 	}
 
 	prog := string(data)
-	l := lexer.New(prog)
+	l := lexer.NewFile(os.Args[1], prog)
 	p := parser.New(l)
 	c := generator.New(p)
 	got, err := c.Gen(delta)
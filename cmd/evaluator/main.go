@@ -5,6 +5,10 @@ import (
 	"cogen/lexer"
 	"cogen/object"
 	"cogen/parser"
+	"cogen/profile"
+	"cogen/token"
+	"cogen/vm"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -15,35 +19,48 @@ func fail(err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "got error: %v", err)
 	}
-	fmt.Fprintf(os.Stderr, "usage: %s [inputfile] [delta]", os.Args[0])
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] [inputfile] [args]\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
-func parseCLIArgument(arg string) object.Object {
-	l := lexer.New(arg)
-	p := parser.New(l)
-	parse_result := p.ParseExpression(parser.LOWEST)
-	env := object.NewEnvironment()
-	e := evaluator.Evaluator{Program: nil}
-	evaluated := e.Eval(parse_result, env)
-	return evaluated
-}
-
 func main() {
-	argc := len(os.Args)
-	if argc < 2 {
+	var opts evaluator.Options
+	flag.IntVar(&opts.MaxSteps, "max-steps", 0, "stop after this many statements (0: no limit)")
+	flag.IntVar(&opts.MaxCallDepth, "max-depth", 0, "stop when calls nest deeper than this (0: no limit)")
+	flag.IntVar(&opts.MaxListLength, "max-list", 0, "stop when a primitive builds a longer list (0: no limit)")
+	flag.DurationVar(&opts.Timeout, "timeout", 0, "stop after this much time, e.g. 5s (0: no limit)")
+	profileFormat := flag.String("profile", "", "write a profile to stderr: table or folded")
+	engine := flag.String("engine", "eval", "run the program on: eval, the tree-walking evaluator, or vm, the bytecode VM")
+	disasm := flag.Bool("disasm", false, "print the bytecode of the program instead of running it")
+	dialectName := flag.String("dialect", "default", "syntax of the input: default or book")
+	flag.Parse()
+	if *profileFormat != "" && *profileFormat != "table" && *profileFormat != "folded" {
+		fail(fmt.Errorf("unknown profile format %q\n", *profileFormat))
+	}
+	if *engine != "eval" && *engine != "vm" {
+		fail(fmt.Errorf("unknown engine %q\n", *engine))
+	}
+	if *engine == "vm" && *profileFormat != "" {
+		fail(fmt.Errorf("-profile needs -engine=eval\n"))
+	}
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fail(err)
+	}
+
+	args := flag.Args()
+	if len(args) < 1 {
 		fail(nil)
 	}
-	data, err := os.ReadFile(os.Args[1])
+	data, err := os.ReadFile(args[0])
 	if err != nil {
 		fail(err)
 	}
 
 	prog := string(data)
-	l := lexer.New(prog)
+	l := lexer.NewFile(args[0], prog, dialect)
 	p := parser.New(l)
-	env := object.NewEnvironment()
 
 	// Parse program and check for errors
 	parsed_program := p.ParseProgram()
@@ -53,24 +70,46 @@ func main() {
 		return
 	}
 
-	if len(parsed_program.Variables) > 0 {
-		expectedArgs := len(parsed_program.Variables)
-		if len(os.Args) < 2+expectedArgs {
-			fmt.Fprintf(os.Stderr, "Program expects %d arguments, got %d\n", expectedArgs, len(os.Args)-2)
+	var code *vm.Program
+	if *engine == "vm" || *disasm {
+		code, err = vm.Compile(parsed_program)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "got error: %v\n", err)
 			os.Exit(1)
 		}
+	}
+	if *disasm {
+		io.WriteString(os.Stdout, code.Disassemble())
+		return
+	}
 
-		for i, input := range parsed_program.Variables {
-			arg := os.Args[2+i]
-			val := parseCLIArgument(arg)
-			env.Set(input.Ident.Value, val)
-		}
+	env, err := evaluator.BindArguments(parsed_program, args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		os.Exit(1)
 	}
 
-	e := evaluator.New(parsed_program)
-	evaluated := e.Eval(parsed_program, env)
+	var evaluated object.Object
+	if *profileFormat != "" {
+		e := evaluator.New(parsed_program)
+		e.Options = opts
+		var prof *profile.Profile
+		prof, evaluated = profile.Run(context.Background(), e, env)
+		if *profileFormat == "folded" {
+			prof.WriteFolded(os.Stderr)
+		} else {
+			prof.WriteTable(os.Stderr)
+		}
+	} else if code != nil {
+		evaluated = vm.Run(context.Background(), code, env, opts)
+	} else {
+		evaluated = evaluator.Eval(context.Background(), parsed_program, env, opts)
+	}
 	if evaluated != nil {
 		io.WriteString(os.Stdout, fmt.Sprintf("Result: %s\n", evaluated.String()))
+		if errObj, ok := evaluated.(*object.Error); ok {
+			io.WriteString(os.Stderr, errObj.StackTrace())
+		}
 	} else {
 		io.WriteString(os.Stdout, "evaluated is nil\n")
 	}
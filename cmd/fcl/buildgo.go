@@ -0,0 +1,74 @@
+package main
+
+import (
+	"cogen/gogen"
+	"cogen/token"
+	"flag"
+	"fmt"
+	goToken "go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runBuildGo(args []string) int {
+	flags := flag.NewFlagSet("build-go", flag.ExitOnError)
+	dir := flags.String("o", ".", "directory to write the package to")
+	pkg := flags.String("pkg", "", "name of the package (default: the name of the directory)")
+	fn := flags.String("func", "", "name of the function (default: the program name, capitalized)")
+	dialectName := flags.String("dialect", "default", "syntax of the input: default or book")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s build-go [flags] <inputfile>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+	if *pkg == "" {
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+			return 1
+		}
+		// A main package would need a main function.
+		*pkg = strings.ToLower(strings.NewReplacer("-", "", ".", "").Replace(filepath.Base(abs)))
+		if !goToken.IsIdentifier(*pkg) || *pkg == "main" {
+			*pkg = "fcl"
+		}
+	}
+
+	file := flags.Arg(0)
+	program, _ := parseFile(file, dialect)
+	if program == nil {
+		return 1
+	}
+	src, err := gogen.Generate(program, gogen.Options{Package: *pkg, Func: *fn})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 1
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + ".go"
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 1
+	}
+	for path, data := range map[string][]byte{
+		filepath.Join(*dir, name):             src,
+		filepath.Join(*dir, "fcl_runtime.go"): gogen.Runtime(*pkg),
+	} {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"cogen/check"
+	"cogen/diagnostics"
+	"cogen/token"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	enable := flags.String("enable", "", "comma-separated rules to run (default: all)")
+	disable := flags.String("disable", "", "comma-separated rules not to run")
+	format := flags.String("format", "text", "output format: text or json")
+	dialectName := flags.String("dialect", "default", "syntax of the input: default or book")
+	list := flags.Bool("list", false, "list the rules and exit")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s check [flags] <inputfile>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *list {
+		for _, r := range check.Rules {
+			fmt.Printf("%s  %-22s %s\n", r.Code, r.Name, r.Doc)
+		}
+		return 0
+	}
+	if flags.NArg() != 1 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		return 2
+	}
+	rules, err := check.Select(splitList(*enable), splitList(*disable))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+
+	program, source := parseFile(flags.Arg(0), dialect)
+	if program == nil {
+		return 1
+	}
+	diags := check.Run(program, rules)
+
+	if *format == "json" {
+		out, err := diagnostics.RenderJSON(diags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(out))
+	} else if len(diags) > 0 {
+		fmt.Println(diagnostics.RenderText(source, diags))
+	}
+	if diagnostics.HasErrors(diags) {
+		return 1
+	}
+	return 0
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"cogen/debugger"
+	"cogen/evaluator"
+	"cogen/object"
+	"cogen/token"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const debugHelp = `commands:
+  b LABEL|LINE   set a breakpoint, or list them with no argument
+  c              continue to the next breakpoint
+  s              step one statement, into calls
+  n              step one statement, over calls
+  o              step out of the running call
+  p EXPR         print the value of an expression
+  w EXPR         watch an expression, or list watches with no argument
+  unwatch N      remove watch N
+  vars           show the variables of the running frame and its callers
+  bt             show the call stack
+  q              quit
+`
+
+func runDebug(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	dap := flags.Bool("dap", false, "serve the Debug Adapter Protocol on stdin and stdout")
+	dialectName := flags.String("dialect", "default", "syntax of the input: default or book")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s debug [flags] <inputfile> [args...]\n       %s debug -dap\n", os.Args[0], os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *dap {
+		if err := debugger.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+	program, _ := parseFile(flags.Arg(0), dialect)
+	if program == nil {
+		return 1
+	}
+	env, err := evaluator.BindArguments(program, flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+
+	t := &terminal{d: debugger.New(program, env), out: os.Stdout}
+	t.loop(os.Stdin)
+	return 0
+}
+
+// terminal is the command-line front-end of the debugger.
+type terminal struct {
+	d      *debugger.Debugger
+	out    io.Writer
+	lines  []int
+	labels []string
+}
+
+func (t *terminal) loop(in io.Reader) {
+	t.stopped(debugger.Entry)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(t.out, "(fcl) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(t.out)
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "":
+		case "b":
+			t.breakpoint(arg)
+		case "c", "s", "n", "o":
+			if t.d.Done() {
+				fmt.Fprintln(t.out, "the program has finished")
+				continue
+			}
+			step := map[string]func() debugger.StopReason{
+				"c": t.d.Continue, "s": t.d.StepIn, "n": t.d.StepOver, "o": t.d.StepOut,
+			}[cmd]
+			t.stopped(step())
+		case "p":
+			val, err := t.d.Eval(arg, 0)
+			if err != nil {
+				fmt.Fprintf(t.out, "error: %v\n", err)
+			} else {
+				fmt.Fprintln(t.out, val)
+			}
+		case "w":
+			if arg != "" {
+				t.d.Watch(arg)
+			}
+			t.watches()
+		case "unwatch":
+			n, err := strconv.Atoi(arg)
+			if err != nil || !t.d.Unwatch(n) {
+				fmt.Fprintf(t.out, "no watch %q\n", arg)
+			}
+		case "vars":
+			t.vars()
+		case "bt":
+			for i, f := range t.d.Frames() {
+				fmt.Fprintf(t.out, "#%d %s line %d\n", i, f.Block.Label.Value, t.d.FrameLine(i))
+			}
+		case "q":
+			return
+		case "h", "help":
+			fmt.Fprint(t.out, debugHelp)
+		default:
+			fmt.Fprintf(t.out, "unknown command %q, h for help\n", cmd)
+		}
+	}
+}
+
+// breakpoint adds a breakpoint on a line, given by number, or a label.
+func (t *terminal) breakpoint(arg string) {
+	if arg == "" {
+		for _, l := range t.lines {
+			fmt.Fprintf(t.out, "line %d\n", l)
+		}
+		for _, l := range t.labels {
+			fmt.Fprintf(t.out, "label %s\n", l)
+		}
+		return
+	}
+	if n, err := strconv.Atoi(arg); err == nil {
+		verified := t.d.SetLineBreakpoints(append(t.lines, n))
+		if !verified[len(verified)-1] {
+			fmt.Fprintf(t.out, "no statement starts on line %d\n", n)
+			t.d.SetLineBreakpoints(t.lines)
+			return
+		}
+		t.lines = append(t.lines, n)
+		return
+	}
+	verified := t.d.SetLabelBreakpoints(append(t.labels, arg))
+	if !verified[len(verified)-1] {
+		fmt.Fprintf(t.out, "no label %s\n", arg)
+		t.d.SetLabelBreakpoints(t.labels)
+		return
+	}
+	t.labels = append(t.labels, arg)
+}
+
+// stopped shows where the program stopped and the watched values.
+func (t *terminal) stopped(reason debugger.StopReason) {
+	if reason == debugger.Exited {
+		fmt.Fprintf(t.out, "Result: %s\n", t.d.Result())
+		if err, ok := t.d.Result().(*object.Error); ok {
+			fmt.Fprint(t.out, err.StackTrace())
+		}
+		return
+	}
+	f := t.d.Frames()[0]
+	fmt.Fprintf(t.out, "%s at %s, line %d: %s\n", reason, f.Block.Label.Value, t.d.Line(), t.d.Next())
+	if len(t.d.Watches(0)) != 0 {
+		t.watches()
+	}
+}
+
+func (t *terminal) watches() {
+	for n, w := range t.d.Watches(0) {
+		if w.Err != nil {
+			fmt.Fprintf(t.out, "%d: %s = error: %v\n", n, w.Expr, w.Err)
+		} else {
+			fmt.Fprintf(t.out, "%d: %s = %s\n", n, w.Expr, w.Value)
+		}
+	}
+}
+
+func (t *terminal) vars() {
+	for _, scope := range t.d.Scopes(0) {
+		fmt.Fprintf(t.out, "%s:\n", scope.Name)
+		for _, v := range debugger.Vars(scope.Env) {
+			fmt.Fprintf(t.out, "  %s = %s\n", v.Name, v.Value)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"cogen/cfg"
+	"cogen/flowchart"
+	"cogen/generator"
+	"cogen/token"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runGraph(args []string) int {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := flags.String("format", "dot", "output format: dot or mermaid")
+	dialectName := flags.String("dialect", "default", "syntax of the input: default or book")
+	bt := flags.Bool("bt", false, "colour blocks by binding time, for generating extensions and residual programs")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s graph [flags] <inputfile>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || (*format != "dot" && *format != "mermaid") {
+		flags.Usage()
+		return 2
+	}
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+
+	program, _ := parseFile(flags.Arg(0), dialect)
+	if program == nil {
+		return 1
+	}
+	var opts flowchart.Options
+	if *bt {
+		opts.BindingTimes = generator.BindingTimes(program)
+	}
+
+	g := cfg.New(program)
+	if *format == "mermaid" {
+		fmt.Print(flowchart.Mermaid(g, opts))
+	} else {
+		fmt.Print(flowchart.DOT(g, opts))
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+// Command fcl bundles the tools that work on FCL programs. Each is a
+// subcommand with its own flags:
+//
+//	fcl build-go [flags] <inputfile>
+//	fcl check [flags] <inputfile>
+//	fcl debug [flags] <inputfile> [args...]
+//	fcl graph [flags] <inputfile>
+//	fcl profile [flags] <inputfile> [args...]
+//	fcl trace [flags] <inputfile> [args...]
+package main
+
+import (
+	"cogen/ast"
+	"cogen/lexer"
+	"cogen/parser"
+	"cogen/token"
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{"build-go", "translate a program to a Go package", runBuildGo},
+	{"check", "report mistakes in a program without running it", runCheck},
+	{"debug", "run a program under a debugger, or serve DAP with -dap", runDebug},
+	{"graph", "draw the flowchart of a program as DOT or Mermaid", runGraph},
+	{"profile", "run a program and count where it spends its steps and time", runProfile},
+	{"trace", "run a program and show what each statement does", runTrace},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags] <inputfile>\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+	usage()
+}
+
+// parseFile parses the program in file. On syntax errors it prints them and
+// returns nil.
+func parseFile(file string, dialect token.Dialect) (*ast.Program, string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return nil, ""
+	}
+	source := string(data)
+	p := parser.New(lexer.NewFile(file, source, dialect))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Println(p.GetErrorMessage())
+		return nil, source
+	}
+	return program, source
+}
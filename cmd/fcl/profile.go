@@ -0,0 +1,64 @@
+package main
+
+import (
+	"cogen/evaluator"
+	"cogen/object"
+	"cogen/profile"
+	"cogen/token"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runProfile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	format := flags.String("format", "table", "output format: table or folded (stacks for flame graphs)")
+	dialectName := flags.String("dialect", "default", "syntax of the input: default or book")
+	var opts evaluator.Options
+	flags.IntVar(&opts.MaxSteps, "max-steps", 0, "stop after this many statements (0: no limit)")
+	flags.DurationVar(&opts.Timeout, "timeout", 0, "stop after this much time, e.g. 5s (0: no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s profile [flags] <inputfile> [args...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || (*format != "table" && *format != "folded") {
+		flags.Usage()
+		return 2
+	}
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+
+	program, _ := parseFile(flags.Arg(0), dialect)
+	if program == nil {
+		return 1
+	}
+	env, err := evaluator.BindArguments(program, flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+
+	e := evaluator.New(program)
+	e.Options = opts
+	p, result := profile.Run(context.Background(), e, env)
+	if *format == "folded" {
+		err = p.WriteFolded(os.Stdout)
+	} else {
+		fmt.Printf("Result: %s\n\n", result)
+		err = p.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 1
+	}
+	if _, ok := result.(*object.Error); ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"cogen/evaluator"
+	"cogen/object"
+	"cogen/token"
+	"cogen/trace"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runTrace(args []string) int {
+	flags := flag.NewFlagSet("trace", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text or json (one object per line)")
+	dialectName := flags.String("dialect", "default", "syntax of the input: default or book")
+	var opts evaluator.Options
+	flags.IntVar(&opts.MaxSteps, "max-steps", 0, "stop after this many statements (0: no limit)")
+	flags.DurationVar(&opts.Timeout, "timeout", 0, "stop after this much time, e.g. 5s (0: no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s trace [flags] <inputfile> [args...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		return 2
+	}
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+
+	program, _ := parseFile(flags.Arg(0), dialect)
+	if program == nil {
+		return 1
+	}
+	env, err := evaluator.BindArguments(program, flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 2
+	}
+
+	emit := trace.WriteText(os.Stdout)
+	if *format == "json" {
+		emit = trace.WriteJSON(os.Stdout)
+	}
+	e := evaluator.New(program)
+	e.Options = opts
+	result, err := trace.Run(context.Background(), e, env, emit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
+		return 1
+	}
+	if *format == "text" {
+		fmt.Printf("Result: %s\n", result)
+	}
+	if _, ok := result.(*object.Error); ok {
+		return 1
+	}
+	return 0
+}
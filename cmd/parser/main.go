@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"cogen/ast"
+	"cogen/diagnostics"
 	"cogen/lexer"
 	"cogen/parser"
+	"cogen/token"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -10,32 +15,66 @@ import (
 
 func fail(err error) {
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "got error: %v", err)
+		fmt.Fprintf(os.Stderr, "got error: %v\n", err)
 	}
-	fmt.Fprintf(os.Stderr, "usage: %s [inputfile] [delta]", os.Args[0])
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] [inputfile]\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
 func main() {
-	argc := len(os.Args)
-	if argc < 2 {
+	dialectName := flag.String("dialect", "default", "syntax of the input: default or book")
+	toName := flag.String("to", "", "syntax to print the program in: default or book (default: same as the input)")
+	format := flag.String("format", "text", "output format: text prints FCL, json the syntax tree with positions")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		fail(nil)
 	}
-	data, err := os.ReadFile(os.Args[1])
+	dialect, err := token.ParseDialect(*dialectName)
+	if err != nil {
+		fail(err)
+	}
+	if *format != "text" && *format != "json" {
+		fail(fmt.Errorf("unknown format %q, expected text or json", *format))
+	}
+	to := dialect
+	if *toName != "" {
+		if to, err = token.ParseDialect(*toName); err != nil {
+			fail(err)
+		}
+	}
+	data, err := os.ReadFile(flag.Arg(0))
 	if err != nil {
 		fail(err)
 	}
 
 	prog := string(data)
-	l := lexer.New(prog)
+	l := lexer.NewFile(flag.Arg(0), prog, dialect)
 	p := parser.New(l)
 
 	// Parse program and check for errors
 	parsed_program := p.ParseProgram()
 
 	if len(p.Errors()) != 0 {
-		fmt.Println(p.GetErrorMessage())
+		if *format == "json" {
+			out, _ := diagnostics.RenderJSON(p.Errors())
+			fmt.Println(string(out))
+		} else {
+			fmt.Println(p.GetErrorMessage())
+		}
+		return
+	}
+
+	parsed_program.SetDialect(to)
+	if *format == "json" {
+		out, err := ast.EncodeJSON(parsed_program)
+		if err != nil {
+			fail(err)
+		}
+		var indented bytes.Buffer
+		json.Indent(&indented, out, "", "  ")
+		fmt.Println(indented.String())
 	} else {
 		fmt.Println(parsed_program.String())
 	}
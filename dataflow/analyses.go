@@ -0,0 +1,241 @@
+package dataflow
+
+import (
+	"cogen/ast"
+	"cogen/cfg"
+	"sort"
+)
+
+// A VarSet is a set of variable names. The analyses never change a set
+// once it is a fact.
+type VarSet map[string]bool
+
+// Has reports whether name is in s.
+func (s VarSet) Has(name string) bool { return s[name] }
+
+// Sorted returns the names in s in alphabetical order.
+func (s VarSet) Sorted() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s VarSet) copy() VarSet {
+	c := make(VarSet, len(s))
+	for name := range s {
+		c[name] = true
+	}
+	return c
+}
+
+func unionVars(a, b VarSet) VarSet {
+	c := a.copy()
+	for name := range b {
+		c[name] = true
+	}
+	return c
+}
+
+func intersectVars(a, b VarSet) VarSet {
+	c := VarSet{}
+	for name := range a {
+		if b[name] {
+			c[name] = true
+		}
+	}
+	return c
+}
+
+func equalVars(a, b VarSet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name := range a {
+		if !b[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// Uses returns the variables stmt reads, in the order it reads them. The
+// identifier naming a primitive is not a variable, and neither is quoted
+// data.
+func Uses(stmt ast.Statement) []*ast.Identifier {
+	var ids []*ast.Identifier
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignmentStatement:
+			ast.Inspect(n.Right, visit)
+			return false
+		case *ast.PrimitiveCall:
+			for _, arg := range n.Arguments {
+				ast.Inspect(arg, visit)
+			}
+			return false
+		case *ast.Identifier:
+			ids = append(ids, n)
+		}
+		return true
+	}
+	ast.Inspect(stmt, visit)
+	return ids
+}
+
+// Def returns the variable stmt assigns, or nil.
+func Def(stmt ast.Statement) *ast.Identifier {
+	if as, ok := stmt.(*ast.AssignmentStatement); ok {
+		return as.Left
+	}
+	return nil
+}
+
+func params(g *cfg.Graph) VarSet {
+	s := VarSet{}
+	for _, in := range g.Program.Variables {
+		s[in.Ident.Value] = true
+	}
+	return s
+}
+
+// Liveness finds the variables live at each point: those some path from
+// it reads before assigning them. The variables a called block reads
+// before assigning them are live at the call.
+func Liveness(g *cfg.Graph) *Result[VarSet] {
+	return Solve(g, &Analysis[VarSet]{
+		Direction: Backward,
+		Boundary:  VarSet{},
+		Initial:   VarSet{},
+		Meet:      unionVars,
+		Equal:     equalVars,
+		Transfer: func(stmt ast.Statement, after VarSet) VarSet {
+			before := after.copy()
+			if d := Def(stmt); d != nil {
+				delete(before, d.Value)
+			}
+			for _, id := range Uses(stmt) {
+				before[id.Value] = true
+			}
+			return before
+		},
+	})
+}
+
+// DefiniteAssignment finds the variables assigned on every path from the
+// entry to each point, parameters included. Points the entry does not
+// reach have every variable of the program.
+func DefiniteAssignment(g *cfg.Graph) *Result[VarSet] {
+	all := params(g)
+	for _, b := range g.Blocks {
+		for _, stmt := range b.Stmts {
+			if d := Def(stmt); d != nil {
+				all[d.Value] = true
+			}
+			for _, id := range Uses(stmt) {
+				all[id.Value] = true
+			}
+		}
+	}
+
+	return Solve(g, &Analysis[VarSet]{
+		Direction: Forward,
+		Boundary:  params(g),
+		Initial:   all,
+		Meet:      intersectVars,
+		Equal:     equalVars,
+		Transfer: func(stmt ast.Statement, before VarSet) VarSet {
+			d := Def(stmt)
+			if d == nil || before[d.Value] {
+				return before
+			}
+			after := before.copy()
+			after[d.Value] = true
+			return after
+		},
+	})
+}
+
+// A Definition is an assignment to a variable, or a parameter.
+type Definition struct {
+	Var   string
+	Ident *ast.Identifier          // the assigned identifier or the parameter
+	Stmt  *ast.AssignmentStatement // nil for a parameter
+	Block *cfg.Block               // nil for a parameter
+	index int                      // program order
+}
+
+// A DefSet is a set of definitions.
+type DefSet map[*Definition]bool
+
+// Of returns the definitions of name in s, in program order.
+func (s DefSet) Of(name string) []*Definition {
+	var defs []*Definition
+	for d := range s {
+		if d.Var == name {
+			defs = append(defs, d)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].index < defs[j].index })
+	return defs
+}
+
+// ReachingDefinitions finds the definitions that reach each point: those
+// with a path to it on which their variable is not assigned again.
+func ReachingDefinitions(g *cfg.Graph) *Result[DefSet] {
+	boundary := DefSet{}
+	for _, in := range g.Program.Variables {
+		boundary[&Definition{Var: in.Ident.Value, Ident: in.Ident, index: len(boundary)}] = true
+	}
+	defs := map[ast.Statement]*Definition{}
+	for _, b := range g.Blocks {
+		for _, stmt := range b.Stmts {
+			if as, ok := stmt.(*ast.AssignmentStatement); ok {
+				defs[stmt] = &Definition{Var: as.Left.Value, Ident: as.Left, Stmt: as, Block: b, index: len(boundary) + len(defs)}
+			}
+		}
+	}
+
+	return Solve(g, &Analysis[DefSet]{
+		Direction: Forward,
+		Boundary:  boundary,
+		Initial:   DefSet{},
+		Meet: func(a, b DefSet) DefSet {
+			c := make(DefSet, len(a)+len(b))
+			for d := range a {
+				c[d] = true
+			}
+			for d := range b {
+				c[d] = true
+			}
+			return c
+		},
+		Equal: func(a, b DefSet) bool {
+			if len(a) != len(b) {
+				return false
+			}
+			for d := range a {
+				if !b[d] {
+					return false
+				}
+			}
+			return true
+		},
+		Transfer: func(stmt ast.Statement, before DefSet) DefSet {
+			def := defs[stmt]
+			if def == nil {
+				return before
+			}
+			after := DefSet{def: true}
+			for d := range before {
+				if d.Var != def.Var {
+					after[d] = true
+				}
+			}
+			return after
+		},
+	})
+}
@@ -0,0 +1,203 @@
+// Package dataflow solves dataflow problems over the control flow graph of
+// an FCL program with a worklist, and holds the standard analyses built on
+// it: liveness, reaching definitions and definite assignment.
+//
+// Facts are known at every program point: before each statement of a
+// block and after its last one. An edge carries the fact from just before
+// the statement that takes it, so a call x := call L enters L before x is
+// assigned, and the called block reads the variables of its caller.
+package dataflow
+
+import (
+	"cogen/ast"
+	"cogen/cfg"
+)
+
+// Direction is the way facts flow.
+type Direction int
+
+const (
+	Forward  Direction = iota // from the entry along the edges
+	Backward                  // from the exit against the edges
+)
+
+// An Analysis describes a dataflow problem over facts of type F. Transfer
+// and Meet must not change their arguments.
+type Analysis[F any] struct {
+	Direction Direction
+	// Boundary is the fact at the start of the entry for a forward
+	// analysis, and at the exit for a backward one.
+	Boundary F
+	// Initial is the fact every other point starts from. It must be the
+	// identity of Meet: the empty set for a may analysis, all for a must.
+	Initial F
+	Meet    func(a, b F) F
+	Equal   func(a, b F) bool
+	// Transfer returns the fact on the far side of stmt, after it for a
+	// forward analysis and before it for a backward one.
+	Transfer func(stmt ast.Statement, f F) F
+}
+
+// Result holds the solution of an analysis.
+type Result[F any] struct {
+	Graph    *cfg.Graph
+	analysis *Analysis[F]
+	points   [][]F // per block, the facts before each statement and at the end
+}
+
+// Solve runs a over g until no fact changes.
+func Solve[F any](g *cfg.Graph, a *Analysis[F]) *Result[F] {
+	r := &Result[F]{Graph: g, analysis: a, points: make([][]F, len(g.Blocks))}
+	for _, b := range g.Blocks {
+		r.points[b.Index] = make([]F, len(b.Stmts)+1)
+		for i := range r.points[b.Index] {
+			r.points[b.Index][i] = a.Initial
+		}
+	}
+	if a.Direction == Backward {
+		r.points[g.Exit.Index][0] = a.Boundary
+	}
+
+	queued := make([]bool, len(g.Blocks))
+	var work []*cfg.Block
+	push := func(b *cfg.Block) {
+		if !queued[b.Index] {
+			queued[b.Index] = true
+			work = append(work, b)
+		}
+	}
+	// Seeding in the order facts flow lets most blocks settle in one visit.
+	if a.Direction == Forward {
+		for i := len(g.Blocks) - 1; i >= 0; i-- {
+			push(g.Blocks[i])
+		}
+	} else {
+		for _, b := range g.Blocks {
+			push(b)
+		}
+	}
+
+	for len(work) > 0 {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		queued[b.Index] = false
+
+		if a.Direction == Forward {
+			if r.forward(b) {
+				for _, e := range b.Succs {
+					push(e.To)
+				}
+			}
+		} else if r.backward(b) {
+			for _, e := range b.Preds {
+				push(e.From)
+			}
+		}
+	}
+	return r
+}
+
+// edgeFact is the fact e carries: the one before its statement, or at the
+// end of the block for an edge that leaves by falling off it.
+func (r *Result[F]) edgeFact(e *cfg.Edge) F {
+	pts := r.points[e.From.Index]
+	if e.Kind == cfg.End {
+		return pts[len(pts)-1]
+	}
+	for i, stmt := range e.From.Stmts {
+		if stmt == e.Stmt {
+			return pts[i]
+		}
+	}
+	return r.analysis.Initial
+}
+
+// forward recomputes the facts of b from its predecessors and reports
+// whether the facts its edges carry changed.
+func (r *Result[F]) forward(b *cfg.Block) bool {
+	a := r.analysis
+	in := a.Initial
+	if b == r.Graph.Entry {
+		in = a.Boundary
+	}
+	for _, e := range b.Preds {
+		in = a.Meet(in, r.edgeFact(e))
+	}
+
+	pts := r.points[b.Index]
+	changed := !a.Equal(pts[0], in)
+	pts[0] = in
+	for i, stmt := range b.Stmts {
+		next := a.Transfer(stmt, pts[i])
+		if !a.Equal(pts[i+1], next) {
+			pts[i+1] = next
+			changed = true
+		}
+	}
+	return changed
+}
+
+// backward recomputes the facts of b from its successors and reports
+// whether the fact at its start changed.
+func (r *Result[F]) backward(b *cfg.Block) bool {
+	a := r.analysis
+	pts := r.points[b.Index]
+	if b.IsExit() {
+		pts[0] = a.Boundary
+		return false
+	}
+
+	after := a.Initial
+	for _, e := range b.Succs {
+		if e.Kind == cfg.End {
+			after = a.Meet(after, r.points[e.To.Index][0])
+		}
+	}
+	old := pts[0]
+	pts[len(pts)-1] = after
+	for i := len(b.Stmts) - 1; i >= 0; i-- {
+		stmt := b.Stmts[i]
+		before := a.Transfer(stmt, pts[i+1])
+		for _, e := range b.Succs {
+			if e.Stmt == stmt && e.Kind != cfg.End {
+				before = a.Meet(before, r.points[e.To.Index][0])
+			}
+		}
+		pts[i] = before
+	}
+	return !a.Equal(old, pts[0])
+}
+
+// Entry returns the fact at the start of b.
+func (r *Result[F]) Entry(b *cfg.Block) F {
+	return r.points[b.Index][0]
+}
+
+// End returns the fact at the end of b, after its last statement.
+func (r *Result[F]) End(b *cfg.Block) F {
+	pts := r.points[b.Index]
+	return pts[len(pts)-1]
+}
+
+// Before returns the fact just before statement i of b.
+func (r *Result[F]) Before(b *cfg.Block, i int) F {
+	return r.points[b.Index][i]
+}
+
+// After returns the fact just after statement i of b. For a backward
+// analysis it is the fact flowing in from the statements that follow, not
+// from the blocks the statement jumps to.
+func (r *Result[F]) After(b *cfg.Block, i int) F {
+	return r.points[b.Index][i+1]
+}
+
+// AtLabel returns the fact at the start of the block label names, and
+// false if there is none.
+func (r *Result[F]) AtLabel(label string) (F, bool) {
+	b := r.Graph.Block(label)
+	if b == nil {
+		var zero F
+		return zero, false
+	}
+	return r.Entry(b), true
+}
@@ -0,0 +1,145 @@
+package dataflow_test
+
+import (
+	"cogen/cfg"
+	"cogen/dataflow"
+	"cogen/lexer"
+	"cogen/parser"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func build(t *testing.T, input string) *cfg.Graph {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	return cfg.New(program)
+}
+
+func vars(s dataflow.VarSet) string {
+	return strings.Join(s.Sorted(), " ")
+}
+
+const pow = `pow(m, n);
+init: result := 1; goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m; n := n - 1; goto test;
+end: return result;`
+
+func TestLiveness(t *testing.T) {
+	g := build(t, pow)
+	live := dataflow.Liveness(g)
+
+	tests := []struct {
+		label, want string
+	}{
+		{"init", "m n"},
+		{"test", "m n result"},
+		{"loop", "m n result"},
+		{"end", "result"},
+	}
+	for _, tt := range tests {
+		got, ok := live.AtLabel(tt.label)
+		if !ok {
+			t.Fatalf("no facts for %s", tt.label)
+		}
+		if vars(got) != tt.want {
+			t.Errorf("live at %s wrong. want=%q, got=%q", tt.label, tt.want, vars(got))
+		}
+	}
+
+	loop := g.Block("loop")
+	if got := vars(live.Before(loop, 1)); got != "m n result" {
+		t.Errorf("live before n := n - 1 wrong, got %q", got)
+	}
+	if got := vars(live.End(g.Block("end"))); got != "" {
+		t.Errorf("nothing should be live after a return, got %q", got)
+	}
+	if _, ok := live.AtLabel("nope"); ok {
+		t.Errorf("expected no facts for an undefined label")
+	}
+}
+
+func TestLivenessKills(t *testing.T) {
+	g := build(t, `f(xs, y);
+start: n := call len; r := cons(n, y); return r;
+len: k := 0; y := hd(xs); goto out;
+out: return k;`)
+	live := dataflow.Liveness(g)
+
+	// len assigns k and y before reading them, and the primitives it
+	// calls are not variables.
+	if got, _ := live.AtLabel("len"); vars(got) != "xs" {
+		t.Errorf("live at len wrong, got %q", vars(got))
+	}
+	// The call reads the variables live in len; n is assigned by it.
+	if got, _ := live.AtLabel("start"); vars(got) != "xs y" {
+		t.Errorf("live at start wrong, got %q", vars(got))
+	}
+}
+
+func TestDefiniteAssignment(t *testing.T) {
+	g := build(t, `f(a);
+start: if a goto both else one;
+both: x := 1; y := 2; goto join;
+one: x := 3; goto join;
+join: return x + y;
+lost: return z;`)
+	assigned := dataflow.DefiniteAssignment(g)
+
+	tests := []struct {
+		label, want string
+	}{
+		{"start", "a"},
+		{"both", "a"},
+		{"join", "a x"},
+		// Nothing reaches lost, so everything is assigned there.
+		{"lost", "a x y z"},
+	}
+	for _, tt := range tests {
+		got, _ := assigned.AtLabel(tt.label)
+		if vars(got) != tt.want {
+			t.Errorf("assigned at %s wrong. want=%q, got=%q", tt.label, tt.want, vars(got))
+		}
+	}
+	if got := vars(assigned.After(g.Block("both"), 1)); got != "a x y" {
+		t.Errorf("assigned after y := 2 wrong, got %q", got)
+	}
+}
+
+func TestReachingDefinitions(t *testing.T) {
+	g := build(t, pow)
+	reaching := dataflow.ReachingDefinitions(g)
+
+	describe := func(defs []*dataflow.Definition) string {
+		var out []string
+		for _, d := range defs {
+			if d.Stmt == nil {
+				out = append(out, d.Var+"@input")
+			} else {
+				out = append(out, fmt.Sprintf("%s@%s", d.Stmt, d.Block))
+			}
+		}
+		return strings.Join(out, ", ")
+	}
+
+	test, _ := reaching.AtLabel("test")
+	if got := describe(test.Of("n")); got != "n@input, n := (n - 1)@loop" {
+		t.Errorf("definitions of n at test wrong, got %q", got)
+	}
+	if got := describe(test.Of("result")); got != "result := 1@init, result := (result * m)@loop" {
+		t.Errorf("definitions of result at test wrong, got %q", got)
+	}
+
+	loop := g.Block("loop")
+	if got := describe(reaching.After(loop, 1).Of("n")); got != "n := (n - 1)@loop" {
+		t.Errorf("definitions of n after n := n - 1 wrong, got %q", got)
+	}
+	if got := describe(reaching.Before(loop, 0).Of("m")); got != "m@input" {
+		t.Errorf("definitions of m in loop wrong, got %q", got)
+	}
+}
@@ -0,0 +1,457 @@
+package debugger
+
+import (
+	"bufio"
+	"cogen/evaluator"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"cogen/token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Serve speaks the Debug Adapter Protocol on r and w, as an editor starts a
+// debug adapter on its standard input and output. It returns when the
+// client disconnects or r ends.
+//
+// The program is given by the launch request, with the arguments
+//
+//	{"program": "pow.fcl", "args": ["2", "3"], "stopOnEntry": true}
+//
+// and an optional "dialect" of "book".
+// Breakpoints can be set on lines and, as function breakpoints, on labels.
+// There is one thread, and the variables of a frame come in one scope for
+// its own environment and one for each environment it encloses.
+func Serve(r io.Reader, w io.Writer) error {
+	s := &server{in: bufio.NewReader(r), out: w}
+	return s.serve()
+}
+
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type source struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// errDisconnect ends serve after the response to disconnect is sent.
+var errDisconnect = errors.New("disconnect")
+
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	wmu sync.Mutex // guards out and seq
+	seq int
+
+	mu          sync.Mutex // held while the program runs
+	d           *Debugger
+	path        string
+	stopOnEntry bool
+	refs        []*object.Environment // variablesReference n is refs[n-1]
+}
+
+func (s *server) serve() error {
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		body, err := s.handle(req)
+		if err == errDisconnect {
+			s.respond(req, nil, nil)
+			return nil
+		}
+		s.respond(req, body, err)
+		if req.Command == "launch" && err == nil {
+			s.send(&event{Type: "event", Event: "initialized"})
+		}
+		if req.Command == "configurationDone" && err == nil {
+			s.start()
+		}
+	}
+}
+
+// read reads one message: headers, a blank line, then Content-Length
+// bytes of JSON.
+func (s *server) read() (*request, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("bad Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.in, data); err != nil {
+		return nil, err
+	}
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *server) send(msg any) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	data, _ := json.Marshal(msg)
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *server) respond(req *request, body any, err error) {
+	resp := &response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	s.send(resp)
+}
+
+func (s *server) handle(req *request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsEvaluateForHovers":        true,
+		}, nil
+	case "launch":
+		return nil, s.launch(req.Arguments)
+	case "disconnect", "terminate":
+		s.pause()
+		return nil, errDisconnect
+	case "pause":
+		s.pause()
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": 1, "name": "main"}}}, nil
+	case "setExceptionBreakpoints", "configurationDone":
+		return nil, nil
+	}
+
+	// The rest need the program, and wait for it to stop.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.d == nil {
+		return nil, fmt.Errorf("%s before launch", req.Command)
+	}
+	switch req.Command {
+	case "setBreakpoints":
+		return s.setBreakpoints(req.Arguments)
+	case "setFunctionBreakpoints":
+		return s.setFunctionBreakpoints(req.Arguments)
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		return s.scopes(req.Arguments)
+	case "variables":
+		return s.variables(req.Arguments)
+	case "evaluate":
+		return s.evaluate(req.Arguments)
+	case "continue":
+		go s.resume(s.d.Continue)
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next":
+		go s.resume(s.d.StepOver)
+		return nil, nil
+	case "stepIn":
+		go s.resume(s.d.StepIn)
+		return nil, nil
+	case "stepOut":
+		go s.resume(s.d.StepOut)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %s", req.Command)
+}
+
+func (s *server) pause() {
+	// Pause must not wait for the lock the running program holds.
+	if d := s.debugger(); d != nil {
+		d.Pause()
+	}
+}
+
+func (s *server) debugger() *Debugger {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.d
+}
+
+func (s *server) launch(raw json.RawMessage) error {
+	var args struct {
+		Program     string   `json:"program"`
+		Args        []string `json:"args"`
+		StopOnEntry bool     `json:"stopOnEntry"`
+		Dialect     string   `json:"dialect"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return err
+	}
+	if args.Dialect == "" {
+		args.Dialect = "default"
+	}
+	dialect, err := token.ParseDialect(args.Dialect)
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p := parser.New(lexer.NewFile(path, string(data), dialect))
+	program := p.ParseProgram()
+	if err := p.Err(); err != nil {
+		return err
+	}
+	env, err := evaluator.BindArguments(program, args.Args)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wmu.Lock()
+	s.d = New(program, env)
+	s.wmu.Unlock()
+	s.path, s.stopOnEntry = path, args.StopOnEntry
+	return nil
+}
+
+// start runs the program once the client has set its breakpoints.
+func (s *server) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.d == nil {
+		return
+	}
+	switch {
+	case s.stopOnEntry:
+		s.stopped(Entry)
+	case s.d.AtBreakpoint():
+		s.stopped(Breakpoint)
+	default:
+		go s.resume(s.d.Continue)
+	}
+}
+
+// resume runs the program with step and tells the client where it
+// stopped.
+func (s *server) resume(step func() StopReason) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs = nil
+	s.stopped(step())
+}
+
+func (s *server) stopped(reason StopReason) {
+	if reason != Exited {
+		s.send(&event{Type: "event", Event: "stopped", Body: map[string]any{
+			"reason":            reason.String(),
+			"threadId":          1,
+			"allThreadsStopped": true,
+		}})
+		return
+	}
+
+	result := s.d.Result()
+	code := 0
+	output := fmt.Sprintf("Result: %s\n", show(result))
+	if err, ok := result.(*object.Error); ok {
+		code = 1
+		output += err.StackTrace()
+	}
+	s.send(&event{Type: "event", Event: "output", Body: map[string]any{
+		"category": "console",
+		"output":   output,
+	}})
+	s.send(&event{Type: "event", Event: "exited", Body: map[string]any{"exitCode": code}})
+	s.send(&event{Type: "event", Event: "terminated"})
+}
+
+func show(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return obj.String()
+}
+
+func (s *server) setBreakpoints(raw json.RawMessage) (any, error) {
+	var args struct {
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	lines := make([]int, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		lines[i] = b.Line
+	}
+	verified := s.d.SetLineBreakpoints(lines)
+	out := make([]map[string]any, len(lines))
+	for i, l := range lines {
+		out[i] = map[string]any{"verified": verified[i], "line": l}
+	}
+	return map[string]any{"breakpoints": out}, nil
+}
+
+func (s *server) setFunctionBreakpoints(raw json.RawMessage) (any, error) {
+	var args struct {
+		Breakpoints []struct {
+			Name string `json:"name"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	labels := make([]string, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		labels[i] = b.Name
+	}
+	verified := s.d.SetLabelBreakpoints(labels)
+	out := make([]map[string]any, len(labels))
+	for i := range labels {
+		out[i] = map[string]any{"verified": verified[i]}
+	}
+	return map[string]any{"breakpoints": out}, nil
+}
+
+func (s *server) stackTrace() (any, error) {
+	frames := s.d.Frames()
+	out := make([]map[string]any, len(frames))
+	for i, f := range frames {
+		out[i] = map[string]any{
+			"id":     i,
+			"name":   f.Block.Label.Value,
+			"line":   s.d.FrameLine(i),
+			"column": 1,
+			"source": source{Name: filepath.Base(s.path), Path: s.path},
+		}
+	}
+	return map[string]any{"stackFrames": out, "totalFrames": len(out)}, nil
+}
+
+func (s *server) scopes(raw json.RawMessage) (any, error) {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	var out []map[string]any
+	for _, scope := range s.d.Scopes(args.FrameID) {
+		s.refs = append(s.refs, scope.Env)
+		name := "Locals"
+		if scope.Name != "locals" {
+			name = "Caller " + scope.Name
+		}
+		out = append(out, map[string]any{"name": name, "variablesReference": len(s.refs), "expensive": false})
+	}
+	return map[string]any{"scopes": out}, nil
+}
+
+func (s *server) variables(raw json.RawMessage) (any, error) {
+	var args struct {
+		Ref int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Ref < 1 || args.Ref > len(s.refs) {
+		return nil, fmt.Errorf("unknown variablesReference %d", args.Ref)
+	}
+	out := []map[string]any{}
+	for _, v := range Vars(s.refs[args.Ref-1]) {
+		out = append(out, map[string]any{
+			"name":               v.Name,
+			"value":              show(v.Value),
+			"type":               typeName(v.Value),
+			"variablesReference": 0,
+		})
+	}
+	return map[string]any{"variables": out}, nil
+}
+
+func typeName(obj object.Object) string {
+	if obj == nil {
+		return ""
+	}
+	return obj.Type().String()
+}
+
+func (s *server) evaluate(raw json.RawMessage) (any, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	val, err := s.d.Eval(args.Expression, args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"result": show(val), "type": typeName(val), "variablesReference": 0}, nil
+}
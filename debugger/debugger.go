@@ -0,0 +1,314 @@
+// Package debugger runs an FCL program under control: it stops at
+// breakpoints on labels and lines, steps over, into and out of calls, and
+// shows the variables of every frame and the values of watch expressions.
+// The DAP server in this package and the terminal front-end of fcl debug
+// drive it.
+package debugger
+
+import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/evaluator"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// StopReason says why the program stopped.
+type StopReason int
+
+const (
+	Entry      StopReason = iota // before the first statement
+	Breakpoint                   // at a breakpoint
+	Step                         // after a step
+	Pause                        // on request
+	Exited                       // the program finished
+)
+
+func (r StopReason) String() string {
+	names := [...]string{"entry", "breakpoint", "step", "pause", "exited"}
+	if int(r) < 0 || int(r) >= len(names) {
+		return fmt.Sprintf("StopReason(%d)", int(r))
+	}
+	return names[r]
+}
+
+// A Debugger holds a program stopped between two statements.
+type Debugger struct {
+	Program *ast.Program
+
+	m       *evaluator.Machine
+	labels  map[string]bool // label breakpoints
+	lines   map[int]bool    // line breakpoints
+	watches []string
+	pause   atomic.Bool
+}
+
+// New returns a debugger stopped before the first statement of program,
+// with the variables in env.
+func New(program *ast.Program, env *object.Environment) *Debugger {
+	return &Debugger{
+		Program: program,
+		m:       evaluator.New(program).Start(env),
+		labels:  map[string]bool{},
+		lines:   map[int]bool{},
+	}
+}
+
+// Done reports whether the program has finished.
+func (d *Debugger) Done() bool { return d.m.Done() }
+
+// Result returns the value of the finished program, see
+// evaluator.Machine.Result.
+func (d *Debugger) Result() object.Object { return d.m.Result() }
+
+// Next returns the statement the program stopped before, or nil when done.
+func (d *Debugger) Next() ast.Statement { return d.m.Next() }
+
+// Line returns the line the program stopped at, or 0.
+func (d *Debugger) Line() int {
+	if d.Done() {
+		return 0
+	}
+	return line(d.Next())
+}
+
+func line(stmt ast.Statement) int {
+	r := diagnostics.FromNode(stmt)
+	if r.IsZero() {
+		return 0
+	}
+	return r.Start.Line
+}
+
+// SetLineBreakpoints replaces the line breakpoints. It returns, for each
+// line, whether a statement starts on it.
+func (d *Debugger) SetLineBreakpoints(lines []int) []bool {
+	starts := map[int]bool{}
+	for _, block := range d.Program.Statements {
+		for _, stmt := range block.Statements {
+			starts[line(stmt)] = true
+		}
+	}
+	d.lines = map[int]bool{}
+	verified := make([]bool, len(lines))
+	for i, l := range lines {
+		d.lines[l] = true
+		verified[i] = starts[l]
+	}
+	return verified
+}
+
+// SetLabelBreakpoints replaces the label breakpoints, which stop the
+// program before the first statement of the block. It returns, for each
+// label, whether the program defines it.
+func (d *Debugger) SetLabelBreakpoints(labels []string) []bool {
+	defined := map[string]bool{}
+	for _, block := range d.Program.Statements {
+		defined[block.Label.Value] = true
+	}
+	d.labels = map[string]bool{}
+	verified := make([]bool, len(labels))
+	for i, l := range labels {
+		d.labels[l] = true
+		verified[i] = defined[l]
+	}
+	return verified
+}
+
+// AtBreakpoint reports whether a breakpoint is set on the next statement.
+// A line breakpoint stops at the first statement of a block on the line,
+// not at each of them.
+func (d *Debugger) AtBreakpoint() bool {
+	if d.Done() {
+		return false
+	}
+	f := d.top()
+	if f.PC == 0 {
+		return d.labels[f.Block.Label.Value] || d.lines[line(d.Next())]
+	}
+	l := line(d.Next())
+	return d.lines[l] && line(f.Block.Statements[f.PC-1]) != l
+}
+
+func (d *Debugger) top() *evaluator.Frame {
+	frames := d.m.Frames()
+	return frames[len(frames)-1]
+}
+
+// run steps at least once, then until done, a breakpoint, a pause, or
+// more reports false.
+func (d *Debugger) run(more func() bool) StopReason {
+	d.pause.Store(false)
+	for d.m.Step() {
+		switch {
+		case d.AtBreakpoint():
+			return Breakpoint
+		case d.pause.Load():
+			return Pause
+		case !more():
+			return Step
+		}
+	}
+	return Exited
+}
+
+// Continue runs until a breakpoint or the end.
+func (d *Debugger) Continue() StopReason {
+	return d.run(func() bool { return true })
+}
+
+// StepIn runs one statement. A call stops before the first statement of
+// the called block.
+func (d *Debugger) StepIn() StopReason {
+	return d.run(func() bool { return false })
+}
+
+// StepOver runs one statement, and all of a call it makes.
+func (d *Debugger) StepOver() StopReason {
+	depth := d.depth()
+	return d.run(func() bool { return d.top().Depth > depth })
+}
+
+// StepOut runs until the running call returns, or to the end if there is
+// none.
+func (d *Debugger) StepOut() StopReason {
+	depth := d.depth()
+	return d.run(func() bool { return d.top().Depth >= depth })
+}
+
+func (d *Debugger) depth() int {
+	if d.Done() {
+		return 0
+	}
+	return d.top().Depth
+}
+
+// Pause stops a Continue or step running in another goroutine after its
+// current statement.
+func (d *Debugger) Pause() { d.pause.Store(true) }
+
+// Frames returns the active frames, the running one first.
+func (d *Debugger) Frames() []*evaluator.Frame {
+	if d.Done() {
+		return nil
+	}
+	frames := d.m.Frames()
+	out := make([]*evaluator.Frame, len(frames))
+	for i, f := range frames {
+		out[len(frames)-1-i] = f
+	}
+	return out
+}
+
+// A Scope is the variables of one environment a frame sees.
+type Scope struct {
+	Name string // "locals", or the label of the frame the scope belongs to
+	Env  *object.Environment
+}
+
+// Scopes returns what frame i of Frames sees: its own variables, then
+// those of each frame it was called from, whose variables it can read.
+func (d *Debugger) Scopes(i int) []Scope {
+	frames := d.Frames()
+	if i < 0 || i >= len(frames) {
+		return nil
+	}
+	scopes := []Scope{{Name: "locals", Env: frames[i].Env}}
+	for j, env := i+1, frames[i].Env.Outer(); env != nil; j, env = j+1, env.Outer() {
+		name := "enclosing"
+		if j < len(frames) {
+			name = frames[j].Block.Label.Value
+		}
+		scopes = append(scopes, Scope{Name: name, Env: env})
+	}
+	return scopes
+}
+
+// A Var is a variable and its value.
+type Var struct {
+	Name  string
+	Value object.Object
+}
+
+// Vars returns the variables set in env itself, by name.
+func Vars(env *object.Environment) []Var {
+	vars := env.Vars()
+	out := make([]Var, 0, len(vars))
+	for name, value := range vars {
+		out = append(out, Var{Name: name, Value: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Eval evaluates the expression in source with the variables frame i of
+// Frames sees. An error of the program is returned as a Go error.
+func (d *Debugger) Eval(source string, i int) (object.Object, error) {
+	frames := d.Frames()
+	if i < 0 || i >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", i)
+	}
+	p := parser.New(lexer.New(source, d.Program.Dialect))
+	exp := p.ParseExpressionOnly()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("%s", errs[0].Message)
+	}
+	val := evaluator.New(d.Program).Eval(exp, frames[i].Env)
+	if err, ok := val.(*object.Error); ok {
+		return nil, fmt.Errorf("%s", err.Message)
+	}
+	if val == nil {
+		return nil, fmt.Errorf("%s is not an expression", source)
+	}
+	return val, nil
+}
+
+// Watch adds an expression whose value Watches shows.
+func (d *Debugger) Watch(source string) {
+	d.watches = append(d.watches, source)
+}
+
+// Unwatch removes watch expression n, counting from 0.
+func (d *Debugger) Unwatch(n int) bool {
+	if n < 0 || n >= len(d.watches) {
+		return false
+	}
+	d.watches = append(d.watches[:n], d.watches[n+1:]...)
+	return true
+}
+
+// A Watch is a watch expression and its value, or the error evaluating it
+// gave.
+type Watch struct {
+	Expr  string
+	Value object.Object
+	Err   error
+}
+
+// Watches evaluates the watch expressions in frame i of Frames.
+func (d *Debugger) Watches(i int) []Watch {
+	out := make([]Watch, len(d.watches))
+	for n, source := range d.watches {
+		val, err := d.Eval(source, i)
+		out[n] = Watch{Expr: source, Value: val, Err: err}
+	}
+	return out
+}
+
+// FrameLine returns the line frame i of Frames is at: the next statement
+// for the running frame, the call it waits on for the others.
+func (d *Debugger) FrameLine(i int) int {
+	frames := d.Frames()
+	if i < 0 || i >= len(frames) {
+		return 0
+	}
+	f := frames[i]
+	if i == 0 {
+		return line(f.Block.Statements[f.PC])
+	}
+	return line(f.Block.Statements[f.PC-1])
+}
@@ -0,0 +1,258 @@
+package debugger_test
+
+import (
+	"bufio"
+	"cogen/debugger"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"cogen/token"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const input = `f(n);
+a: x := call b;
+  if x > 2 goto c else a;
+b: y := n + 1;
+  return y;
+c: return cons(x, '());`
+
+func start(t *testing.T) *debugger.Debugger {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 2})
+	return debugger.New(program, env)
+}
+
+func where(d *debugger.Debugger) string {
+	if d.Done() {
+		return "done"
+	}
+	return fmt.Sprintf("%s:%d", d.Frames()[0].Block.Label.Value, d.Line())
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := start(t)
+	if v := d.SetLabelBreakpoints([]string{"c", "nope"}); !v[0] || v[1] {
+		t.Errorf("wrong verified label breakpoints %v", v)
+	}
+	if v := d.SetLineBreakpoints([]int{5, 7}); !v[0] || v[1] {
+		t.Errorf("wrong verified line breakpoints %v", v)
+	}
+
+	var stops []string
+	for !d.Done() {
+		reason := d.Continue()
+		stops = append(stops, reason.String()+" "+where(d))
+	}
+	want := []string{"breakpoint b:5", "breakpoint c:6", "exited done"}
+	if strings.Join(stops, ", ") != strings.Join(want, ", ") {
+		t.Errorf("wrong stops.\nwant: %v\ngot:  %v", want, stops)
+	}
+	if d.Result().String() != "'(3)" {
+		t.Errorf("wrong result, got %s", d.Result())
+	}
+}
+
+func TestSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps func(d *debugger.Debugger)
+		want  string
+	}{
+		{"in", func(d *debugger.Debugger) { d.StepIn() }, "b:4"},
+		{"over", func(d *debugger.Debugger) { d.StepOver() }, "a:3"},
+		{"in, over", func(d *debugger.Debugger) { d.StepIn(); d.StepOver() }, "b:5"},
+		{"in, out", func(d *debugger.Debugger) { d.StepIn(); d.StepOut() }, "a:3"},
+		{"out of the program", func(d *debugger.Debugger) { d.StepOut() }, "done"},
+	}
+	for _, tt := range tests {
+		d := start(t)
+		tt.steps(d)
+		if got := where(d); got != tt.want {
+			t.Errorf("%s: stopped at %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScopesAndWatches(t *testing.T) {
+	d := start(t)
+	d.StepIn()
+	d.StepIn()
+
+	scopes := d.Scopes(0)
+	var got []string
+	for _, s := range scopes {
+		var vars []string
+		for _, v := range debugger.Vars(s.Env) {
+			vars = append(vars, v.Name+"="+v.Value.String())
+		}
+		got = append(got, s.Name+"["+strings.Join(vars, " ")+"]")
+	}
+	if want := "locals[y=3] a[n=2]"; strings.Join(got, " ") != want {
+		t.Errorf("wrong scopes.\nwant: %s\ngot:  %s", want, strings.Join(got, " "))
+	}
+
+	d.Watch("y * n")
+	d.Watch("z")
+	watches := d.Watches(0)
+	if watches[0].Err != nil || watches[0].Value.String() != "6" {
+		t.Errorf("wrong watch %s: %v %v", watches[0].Expr, watches[0].Value, watches[0].Err)
+	}
+	if watches[1].Err == nil {
+		t.Errorf("watch of unset z gave %v, want an error", watches[1].Value)
+	}
+	if !d.Unwatch(1) || d.Unwatch(1) || len(d.Watches(0)) != 1 {
+		t.Errorf("wrong watches after unwatch: %v", d.Watches(0))
+	}
+	if _, err := d.Eval("y", 1); err == nil {
+		t.Errorf("caller frame sees the callee's y")
+	}
+}
+
+func TestEvalDialect(t *testing.T) {
+	p := parser.New(lexer.New("read n;\nstart: ok? := n + 1;\n  return ok?;", token.BookDialect))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 2})
+	d := debugger.New(program, env)
+	d.StepIn()
+	if val, err := d.Eval("ok? * 2", 0); err != nil || val.String() != "6" {
+		t.Errorf("got %v %v, want 6", val, err)
+	}
+	if val, err := d.Eval("n 1", 0); err == nil {
+		t.Errorf("got %v for an expression with tokens left after it, want an error", val)
+	}
+}
+
+// client talks to Serve over pipes.
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func (c *client) send(command string, args any) {
+	c.t.Helper()
+	c.seq++
+	data, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// wait reads messages until the response to command or the event name,
+// and returns its body.
+func (c *client) wait(name string) map[string]any {
+	c.t.Helper()
+	for {
+		length := 0
+		for {
+			line, err := c.r.ReadString('\n')
+			if err != nil {
+				c.t.Fatalf("waiting for %s: %v", name, err)
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+			length, _ = strconv.Atoi(strings.TrimPrefix(line, "Content-Length: "))
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			c.t.Fatal(err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.t.Fatal(err)
+		}
+		if msg["command"] == name || msg["event"] == name {
+			if msg["success"] == false {
+				c.t.Fatalf("%s failed: %v", name, msg["message"])
+			}
+			body, _ := msg["body"].(map[string]any)
+			return body
+		}
+	}
+}
+
+func TestDAP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.fcl")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error)
+	go func() { done <- debugger.Serve(inR, outW) }()
+	c := &client{t: t, w: inW, r: bufio.NewReader(outR)}
+
+	c.send("initialize", map[string]any{"adapterID": "fcl"})
+	if caps := c.wait("initialize"); caps["supportsFunctionBreakpoints"] != true {
+		t.Errorf("wrong capabilities %v", caps)
+	}
+	c.send("launch", map[string]any{"program": path, "args": []string{"2"}})
+	c.wait("initialized")
+	c.send("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{map[string]any{"line": 5}}})
+	if bps := c.wait("setBreakpoints")["breakpoints"].([]any); bps[0].(map[string]any)["verified"] != true {
+		t.Errorf("line 5 not verified: %v", bps)
+	}
+	c.send("configurationDone", nil)
+	if stop := c.wait("stopped"); stop["reason"] != "breakpoint" {
+		t.Errorf("stopped for %v, want breakpoint", stop["reason"])
+	}
+
+	c.send("stackTrace", map[string]any{"threadId": 1})
+	frames := c.wait("stackTrace")["stackFrames"].([]any)
+	var stack []string
+	for _, f := range frames {
+		f := f.(map[string]any)
+		stack = append(stack, fmt.Sprintf("%s:%v", f["name"], f["line"]))
+	}
+	if got := strings.Join(stack, " "); got != "b:5 a:2" {
+		t.Errorf("wrong stack %s", got)
+	}
+
+	c.send("scopes", map[string]any{"frameId": 0})
+	scopes := c.wait("scopes")["scopes"].([]any)
+	if len(scopes) != 2 {
+		t.Fatalf("got %d scopes, want 2", len(scopes))
+	}
+	c.send("variables", map[string]any{"variablesReference": scopes[0].(map[string]any)["variablesReference"]})
+	vars := c.wait("variables")["variables"].([]any)
+	if v := vars[0].(map[string]any); v["name"] != "y" || v["value"] != "3" {
+		t.Errorf("wrong locals %v", vars)
+	}
+
+	c.send("evaluate", map[string]any{"expression": "y + n", "frameId": 0})
+	if got := c.wait("evaluate")["result"]; got != "5" {
+		t.Errorf("y + n = %v, want 5", got)
+	}
+
+	c.send("continue", map[string]any{"threadId": 1})
+	if out := c.wait("output")["output"]; out != "Result: '(3)\n" {
+		t.Errorf("wrong output %q", out)
+	}
+	if exit := c.wait("exited"); exit["exitCode"] != 0.0 {
+		t.Errorf("exit code %v", exit["exitCode"])
+	}
+	c.send("disconnect", nil)
+	c.wait("disconnect")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
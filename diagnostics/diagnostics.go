@@ -0,0 +1,258 @@
+// Package diagnostics holds the structured errors and warnings reported by
+// the parser, the checker, the evaluator and the generator, and renders
+// them either in the human caret style or as JSON.
+package diagnostics
+
+import (
+	"cogen/ast"
+	"cogen/token"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Info
+	Hint
+)
+
+func (s Severity) String() string {
+	names := [...]string{"error", "warning", "info", "hint"}
+	if int(s) < 0 || int(s) >= len(names) {
+		return fmt.Sprintf("Severity(%d)", s)
+	}
+	return names[s]
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for i := Error; i <= Hint; i++ {
+		if i.String() == name {
+			*s = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", name)
+}
+
+// Code is a stable identifier for a kind of diagnostic. Codes are never
+// reused, so editors and tests can match on them instead of on messages.
+type Code string
+
+const (
+	// Parser
+	ExpectedToken     Code = "P001"
+	NoPrefixParse     Code = "P002"
+	ExpectedElse      Code = "P003"
+	ExpectedSemicolon Code = "P004"
+	InvalidInteger    Code = "P005"
+	InvalidList       Code = "P006"
+	InvalidString     Code = "P007"
+	InvalidConstant   Code = "P008"
+
+	// Evaluator
+	RuntimeError       Code = "R001"
+	TypeMismatch       Code = "R002"
+	UnknownOperator    Code = "R003"
+	IdentifierNotFound Code = "R004"
+	LabelNotFound      Code = "R005"
+	UndefinedPrimitive Code = "R006"
+	PrimitiveArity     Code = "R007"
+	LimitExceeded      Code = "R008"
+	DivisionByZero     Code = "R009"
+
+	// Generator
+	GeneratorError    Code = "G001"
+	MissingLabel      Code = "G002"
+	ExpectedJump      Code = "G003"
+	UnsupportedCall   Code = "G004"
+	InvalidStaticArgs Code = "G005"
+
+	// Checker
+	UndefinedLabel       Code = "C001"
+	MissingJump          Code = "C002"
+	DuplicateLabel       Code = "C003"
+	UnreachableBlock     Code = "C004"
+	UnassignedVariable   Code = "C005"
+	UnreachableStatement Code = "C006"
+)
+
+// Position is a point in the source. Lines start at 1, columns and byte
+// offsets at 0, as in token.Token.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// Range is the half-open span [Start, End) of source a diagnostic refers to.
+type Range struct {
+	File  string   `json:"file,omitempty"`
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// IsZero reports whether the range carries no position, e.g. for nodes
+// synthesized by the generator.
+func (r Range) IsZero() bool {
+	return r.Start.Line == 0
+}
+
+// FromToken returns the range covered by the token's literal.
+func FromToken(tok token.Token) Range {
+	return FromSpan(ast.TokenSpan(tok))
+}
+
+// FromNode returns the range covered by the node.
+func FromNode(node ast.Node) Range {
+	return FromSpan(node.Span())
+}
+
+func FromSpan(span ast.Span) Range {
+	if !span.IsValid() {
+		return Range{}
+	}
+	return Range{
+		File:  span.File,
+		Start: Position{Line: span.Start.Line, Column: span.Start.Column, Offset: span.Start.Offset},
+		End:   Position{Line: span.End.Line, Column: span.End.Column, Offset: span.End.Offset},
+	}
+}
+
+// Note points at source related to a diagnostic, e.g. the first definition
+// of a duplicated label.
+type Note struct {
+	Message string `json:"message"`
+	Range   Range  `json:"range"`
+}
+
+// Fix is a suggested edit replacing Range with Replacement.
+type Fix struct {
+	Message     string `json:"message"`
+	Range       Range  `json:"range"`
+	Replacement string `json:"replacement"`
+}
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     Code     `json:"code"`
+	Message  string   `json:"message"`
+	Range    Range    `json:"range"`
+	Related  []Note   `json:"related,omitempty"`
+	Fix      *Fix     `json:"fix,omitempty"`
+}
+
+// New returns an error diagnostic covering tok.
+func New(code Code, tok token.Token, format string, a ...any) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Range:    FromToken(tok),
+	}
+}
+
+func (d Diagnostic) Error() string {
+	if d.Range.IsZero() {
+		return fmt.Sprintf("%s[%s]: %s", d.Severity, d.Code, d.Message)
+	}
+	return fmt.Sprintf("%s[%s] at %d:%d: %s", d.Severity, d.Code, d.Range.Start.Line, d.Range.Start.Column, d.Message)
+}
+
+// HasErrors reports whether any diagnostic has severity Error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// List is an error made of diagnostics about one source text.
+type List struct {
+	Source      string
+	Diagnostics []Diagnostic
+}
+
+func (l *List) Error() string {
+	return RenderText(l.Source, l.Diagnostics)
+}
+
+// RenderText renders the diagnostics in caret style: the offending line of
+// source, the range underlined with ~, and the message.
+func RenderText(source string, diags []Diagnostic) string {
+	lines := strings.Split(source, "\n")
+	var out strings.Builder
+	counts := map[Severity]int{}
+	for _, d := range diags {
+		counts[d.Severity]++
+		writeExcerpt(&out, lines, d.Range)
+		out.WriteString(fmt.Sprintf("%s[%s] at line %d:%d: %s\n",
+			capitalize(d.Severity.String()), d.Code, d.Range.Start.Line, d.Range.Start.Column, d.Message))
+		for _, n := range d.Related {
+			out.WriteString(fmt.Sprintf("  note at line %d:%d: %s\n", n.Range.Start.Line, n.Range.Start.Column, n.Message))
+		}
+		if d.Fix != nil {
+			out.WriteString(fmt.Sprintf("  help: %s: %q\n", d.Fix.Message, d.Fix.Replacement))
+		}
+		out.WriteString("\n")
+	}
+
+	parts := []string{}
+	for s := Error; s <= Hint; s++ {
+		if counts[s] == 0 {
+			continue
+		}
+		name := s.String()
+		if counts[s] != 1 {
+			name += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", counts[s], name))
+	}
+	if len(parts) > 0 {
+		out.WriteString("Found " + strings.Join(parts, ", ") + ".")
+	}
+	return out.String()
+}
+
+func writeExcerpt(out *strings.Builder, lines []string, r Range) {
+	if r.Start.Line < 1 || r.Start.Line > len(lines) {
+		return
+	}
+	line := lines[r.Start.Line-1]
+	start := min(max(r.Start.Column, 0), len(line))
+	end := len(line)
+	if r.End.Line == r.Start.Line {
+		end = min(r.End.Column, len(line))
+	}
+	width := max(end-start, 1)
+	out.WriteString(line + "\n")
+	out.WriteString(strings.Repeat(" ", start) + strings.Repeat("~", width) + "\n")
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// RenderJSON renders the diagnostics as a JSON array.
+func RenderJSON(diags []Diagnostic) ([]byte, error) {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	return json.MarshalIndent(diags, "", "  ")
+}
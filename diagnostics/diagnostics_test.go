@@ -0,0 +1,68 @@
+package diagnostics
+
+import (
+	"cogen/token"
+	"encoding/json"
+	"testing"
+)
+
+func TestRenderText(t *testing.T) {
+	source := "init: x := 1;\n      goto lop;\n"
+	d := New(MissingLabel, token.Token{Type: token.LABEL, Literal: "lop", Line: 2, Column: 11, Offset: 25}, "label not found: %s", "lop")
+	d.Related = []Note{{Message: "did you mean loop?", Range: Range{Start: Position{Line: 1, Column: 0}}}}
+	d.Fix = &Fix{Message: "rename the target", Range: d.Range, Replacement: "loop"}
+	warning := Diagnostic{Severity: Warning, Code: GeneratorError, Message: "unused", Range: Range{Start: Position{Line: 1, Column: 6}, End: Position{Line: 1, Column: 7}}}
+
+	expected := `      goto lop;
+           ~~~
+Error[G002] at line 2:11: label not found: lop
+  note at line 1:0: did you mean loop?
+  help: rename the target: "loop"
+
+init: x := 1;
+      ~
+Warning[G001] at line 1:6: unused
+
+Found 1 error, 1 warning.`
+	got := RenderText(source, []Diagnostic{d, warning})
+	if got != expected {
+		t.Fatalf("wrong rendering.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestFromTokenMultiline(t *testing.T) {
+	r := FromToken(token.Token{Type: token.COMMENT, Literal: "/* a\n  b */", Line: 3, Column: 4, Offset: 20, File: "a.fcl"})
+	expected := Range{File: "a.fcl", Start: Position{Line: 3, Column: 4, Offset: 20}, End: Position{Line: 4, Column: 6, Offset: 31}}
+	if r != expected {
+		t.Fatalf("expected %+v, got %+v", expected, r)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	d := New(ExpectedElse, token.Token{Literal: "loop", Line: 4, Column: 24}, "expected else, got IDENT")
+	data, err := RenderJSON([]Diagnostic{d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded[0]["severity"] != "error" || decoded[0]["code"] != "P003" {
+		t.Fatalf("unexpected JSON: %s", data)
+	}
+
+	var roundTrip []Diagnostic
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+	if roundTrip[0].Range != d.Range || roundTrip[0].Severity != Error {
+		t.Fatalf("diagnostic did not round-trip, got %+v", roundTrip[0])
+	}
+
+	empty, _ := RenderJSON(nil)
+	if string(empty) != "[]" {
+		t.Fatalf("expected empty array, got %s", empty)
+	}
+}
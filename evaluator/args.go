@@ -0,0 +1,42 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"fmt"
+)
+
+// ParseArgument reads arg as an FCL expression, such as 3 or '(a b), and
+// returns its value.
+func ParseArgument(arg string) (object.Object, error) {
+	p := parser.New(lexer.New(arg))
+	exp := p.ParseExpressionOnly()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("%s", errs[0].Message)
+	}
+	e := Evaluator{Program: nil}
+	val := e.Eval(exp, object.NewEnvironment())
+	if err, ok := val.(*object.Error); ok {
+		return nil, fmt.Errorf("%s", err.Message)
+	}
+	return val, nil
+}
+
+// BindArguments returns an environment setting each parameter of program
+// to the argument at its position.
+func BindArguments(program *ast.Program, args []string) (*object.Environment, error) {
+	if len(args) != len(program.Variables) {
+		return nil, fmt.Errorf("program expects %d arguments, got %d", len(program.Variables), len(args))
+	}
+	env := object.NewEnvironment()
+	for i, input := range program.Variables {
+		val, err := ParseArgument(args[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %v", input.Ident.Value, err)
+		}
+		env.Set(input.Ident.Value, val)
+	}
+	return env, nil
+}
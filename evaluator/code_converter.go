@@ -2,14 +2,51 @@ package evaluator
 
 import (
 	"cogen/ast"
+	"cogen/lexer"
 	"cogen/object" // Assuming this is the path to your object package
+	"cogen/parser"
+	"cogen/primitives"
 	"cogen/token"
 	"fmt"
 	"strings"
 )
 
+// ResidualFile is the file name recorded in the spans of converted programs.
+const ResidualFile = "<residual>"
+
 // ConvertSExprToAST now takes the inner Value of an object.List
 func ConvertSExprToAST(input []object.Object) (*ast.Program, error) {
+	return ConvertSExprToASTWith(input, standard)
+}
+
+// ConvertSExprToASTWith is like ConvertSExprToAST, but lists headed by a
+// name in prims are the primitive calls. A nil prims means the standard
+// primitives.
+func ConvertSExprToASTWith(input []object.Object, prims *primitives.Registry) (*ast.Program, error) {
+	if prims == nil {
+		prims = standard
+	}
+	prog, err := convertSExpr(input, prims)
+	if err != nil {
+		return prog, err
+	}
+	return positioned(prog), nil
+}
+
+// positioned re-parses the printed program so every node gets a span into
+// the residual program text. The converted program is kept as is if the
+// printed form does not parse back to the same text.
+func positioned(prog *ast.Program) *ast.Program {
+	src := prog.String()
+	p := parser.New(lexer.NewFile(ResidualFile, src))
+	res := p.ParseProgram()
+	if len(p.Errors()) != 0 || res.String() != src {
+		return prog
+	}
+	return res
+}
+
+func convertSExpr(input []object.Object, prims *primitives.Registry) (*ast.Program, error) {
 	prog := &ast.Program{}
 	if len(input) == 0 {
 		return prog, nil
@@ -73,7 +110,7 @@ func ConvertSExprToAST(input []object.Object) (*ast.Program, error) {
 				return nil, fmt.Errorf("statement must be a list, got %s", labelBlock[j].Type())
 			}
 
-			stmt, err := parseStatement(stmtList.Value)
+			stmt, err := parseStatement(stmtList.Value, prims)
 			if err != nil {
 				return prog, err
 			}
@@ -87,7 +124,7 @@ func ConvertSExprToAST(input []object.Object) (*ast.Program, error) {
 	return prog, nil
 }
 
-func parseStatement(list []object.Object) (ast.Statement, error) {
+func parseStatement(list []object.Object, prims *primitives.Registry) (ast.Statement, error) {
 	if len(list) == 0 {
 		return nil, fmt.Errorf("empty statement list")
 	}
@@ -100,7 +137,7 @@ func parseStatement(list []object.Object) (ast.Statement, error) {
 
 	switch op {
 	case "return":
-		val, err := parseExpression(list[1])
+		val, err := parseExpression(list[1], prims)
 		if err != nil {
 			return nil, err
 		}
@@ -110,7 +147,7 @@ func parseStatement(list []object.Object) (ast.Statement, error) {
 		}, nil
 
 	case "if":
-		val, err := parseExpression(list[1])
+		val, err := parseExpression(list[1], prims)
 		if err != nil {
 			return nil, err
 		}
@@ -126,7 +163,7 @@ func parseStatement(list []object.Object) (ast.Statement, error) {
 		if len(list) >= 3 {
 			midSym, ok := list[1].(object.ValueString)
 			if ok && midSym.GetValue() == ":=" {
-				val, err := parseExpression(list[2])
+				val, err := parseExpression(list[2], prims)
 				if err != nil {
 					return nil, err
 				}
@@ -142,12 +179,29 @@ func parseStatement(list []object.Object) (ast.Statement, error) {
 	return nil, fmt.Errorf("unknown operator %s", op)
 }
 
-func parseExpression(expr object.Object) (ast.Expression, error) {
+func parseExpression(expr object.Object, prims *primitives.Registry) (ast.Expression, error) {
 	switch v := expr.(type) {
 	case *object.Integer:
-		sVal := fmt.Sprint(v.Value)
 		return &ast.IntegerLiteral{
-			Token: token.Token{Type: token.NUMBER, Literal: sVal},
+			Token: token.Token{Type: token.NUMBER, Literal: v.String()},
+			Value: v.Value,
+			Big:   v.Big,
+		}, nil
+
+	case *object.Boolean:
+		sVal := fmt.Sprint(v.Value)
+		tokType := token.TokenType(token.FALSE)
+		if v.Value {
+			tokType = token.TRUE
+		}
+		return &ast.BooleanLiteral{
+			Token: token.Token{Type: tokType, Literal: sVal},
+			Value: v.Value,
+		}, nil
+
+	case *object.String:
+		return &ast.StringLiteral{
+			Token: token.Token{Type: token.STRING, Literal: v.String()},
 			Value: v.Value,
 		}, nil
 
@@ -167,8 +221,12 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 			}, nil
 		}
 
-		// Helper to safely get the raw value of a symbol or string
+		// Helper to safely get the raw value of a symbol. Strings are data,
+		// so they never name an operator or a primitive.
 		getRaw := func(obj object.Object) string {
+			if _, ok := obj.(*object.String); ok {
+				return ""
+			}
 			if s, ok := obj.(object.ValueString); ok {
 				return s.GetValue()
 			}
@@ -182,24 +240,16 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 			if len(list) < 2 {
 				return nil, fmt.Errorf("quote expression needs at least 1 argument")
 			}
-			// If the item being quoted is already a Symbol (constant), don't wrap it again
-			// if sym, ok := list[1].(*object.Symbol); ok {
-			// 	return &ast.SymbolExpression{
-			// 		Token: token.Token{Type: token.IDENT, Literal: sym.Value},
-			// 		Value: sym.Value,
-			// 	}, nil
-			// }
-
-			// Handle (quote x) or (' x) where x could be a simple value or a list
-			val, err := parseExpression(list[1])
+			// Handle (quote x) or (' x) where x could be a simple value or a
+			// list. Whatever is quoted is data, not code.
+			val, err := parseDatum(list[1], prims)
 			if err != nil {
 				return nil, err
 			}
 
-			// If the item being quoted is already a constant, don't wrap it again
-			if lst, ok := val.(*ast.Constant); ok {
-				fmt.Printf("List[1]: %s, %T\n", list[1], list[1])
-				return lst, nil
+			// A string evaluates to itself, so it needs no quote
+			if str, ok := val.(*ast.StringLiteral); ok {
+				return str, nil
 			}
 			return &ast.Constant{
 				Token: token.Token{Type: token.QUOTE, Literal: "'"},
@@ -227,14 +277,14 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 			}
 		}
 
-		if first != "" && len(list) >= 2 && !isInfix && isPrimitiveName(first) {
+		if first != "" && len(list) >= 2 && !isInfix && isPrimitiveName(prims, first) {
 			prim := &ast.Identifier{
 				Token: token.Token{Type: token.IDENT, Literal: first},
 				Value: first,
 			}
 			arguments := make([]ast.Expression, len(list)-1)
 			for i := 1; i < len(list); i++ {
-				arg, err := parseExpression(list[i])
+				arg, err := parseExpression(list[i], prims)
 				if err != nil {
 					return nil, err
 				}
@@ -247,9 +297,22 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 			}, nil
 		}
 
+		// 2c. Handle prefix operators: (- n) or (not b)
+		if len(list) == 2 && isPrefixOperator(first) {
+			right, err := parseExpression(list[1], prims)
+			if err != nil {
+				return nil, err
+			}
+			return &ast.PrefixExpression{
+				Token:    token.Token{Type: prefixTokenTypes[first], Literal: first},
+				Operator: first,
+				Right:    right,
+			}, nil
+		}
+
 		// 3. Handle Infix: (n + 1) or (n = 0) -> Length 3
 		if len(list) == 3 {
-			left, err := parseExpression(list[0])
+			left, err := parseExpression(list[0], prims)
 			if err != nil {
 				return nil, err
 			}
@@ -266,7 +329,7 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 				return nil, fmt.Errorf("expected operator symbol at index 1, got %s", list[1].Type())
 			}
 
-			right, err := parseExpression(list[2])
+			right, err := parseExpression(list[2], prims)
 			if err != nil {
 				return nil, err
 			}
@@ -290,7 +353,7 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 		// 5. Fallback: Parse as a regular list expression for unknown constructs
 		elements := make([]ast.Expression, len(list))
 		for i := 0; i < len(list); i++ {
-			elem, err := parseExpression(list[i])
+			elem, err := parseExpression(list[i], prims)
 			if err != nil {
 				return nil, err
 			}
@@ -298,8 +361,8 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 		}
 
 		return &ast.Constant{
-			token.Token{Type: token.CONSTANT, Literal: "'"},
-			&ast.List{
+			Token: token.Token{Type: token.CONSTANT, Literal: "'"},
+			Value: &ast.List{
 				Token: token.Token{Type: token.LPAREN, Literal: "("},
 				Value: elements,
 			}}, nil
@@ -308,6 +371,47 @@ func parseExpression(expr object.Object) (ast.Expression, error) {
 	return nil, fmt.Errorf("unknown expression type %s for value: %s", expr.Type(), expr.String())
 }
 
+// parseDatum converts a value back into the quoted data that reads as it.
+func parseDatum(obj object.Object, prims *primitives.Registry) (ast.Expression, error) {
+	switch v := obj.(type) {
+	case *object.Symbol:
+		return &ast.SymbolExpression{
+			Token: token.Token{Type: token.SYMBOL, Literal: v.Value},
+			Value: v.Value,
+		}, nil
+	case *object.List:
+		// (quote x) reads back from 'x
+		if len(v.Value) == 2 {
+			if sym, ok := v.Value[0].(*object.Symbol); ok && sym.Value == "quote" {
+				val, err := parseDatum(v.Value[1], prims)
+				if err != nil {
+					return nil, err
+				}
+				return &ast.Constant{
+					Token: token.Token{Type: token.QUOTE, Literal: "'"},
+					Value: val,
+				}, nil
+			}
+		}
+		elements := make([]ast.Expression, len(v.Value))
+		for i, item := range v.Value {
+			elem, err := parseDatum(item, prims)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return &ast.List{
+			Token: token.Token{Type: token.LPAREN, Literal: "("},
+			Value: elements,
+		}, nil
+	case *object.Integer, *object.Boolean, *object.String:
+		return parseExpression(obj, prims)
+	default:
+		return nil, fmt.Errorf("cannot quote %s value %s", obj.Type(), obj.String())
+	}
+}
+
 func parseTargetLabel(input object.Object) ast.Label {
 	var fullLabel string
 
@@ -317,15 +421,7 @@ func parseTargetLabel(input object.Object) ast.Label {
 	case *object.List:
 		var parts []string
 		for _, item := range v.Value {
-			if s, ok := item.(object.ValueString); ok {
-				parts = append(parts, s.GetValue())
-			} else if _, ok := item.(*object.List); ok {
-				// For nested lists, use a simplified representation
-				// to avoid including the full data structure in the label
-				parts = append(parts, "data")
-			} else {
-				parts = append(parts, item.String())
-			}
+			parts = append(parts, labelPart(item))
 		}
 		fullLabel = strings.Join(parts, "_")
 	default:
@@ -343,7 +439,7 @@ func parseTargetLabel(input object.Object) ast.Label {
 
 // isInfixOperator checks if a string is a known infix operator
 func isInfixOperator(op string) bool {
-	infixOps := []string{"=", "!=", "<", ">", "+", "-", "*", "/"}
+	infixOps := []string{"=", "!=", "<", ">", "<=", ">=", "+", "-", "*", "/", "%", "and", "or"}
 	for _, infixOp := range infixOps {
 		if op == infixOp {
 			return true
@@ -352,13 +448,21 @@ func isInfixOperator(op string) bool {
 	return false
 }
 
-// isPrimitiveName checks if a string is a known primitive call operator
-func isPrimitiveName(name string) bool {
-	primitives := []string{"hd", "tl", "o", "list", "cons", "newTail", "new_tail", "newHeader", "new_header", "newBlock", "isDone", "cleanOutput", "Gen"}
-	for _, prim := range primitives {
-		if name == prim {
-			return true
-		}
-	}
-	return false
+// prefixTokenTypes maps the known prefix operators to their token types
+var prefixTokenTypes = map[string]token.TokenType{
+	"-":   token.SUB,
+	"!":   token.BANG,
+	"not": token.NOT,
+}
+
+// isPrefixOperator checks if a string is a known prefix operator
+func isPrefixOperator(op string) bool {
+	_, ok := prefixTokenTypes[op]
+	return ok
+}
+
+// isPrimitiveName checks if a string names a primitive in prims
+func isPrimitiveName(prims *primitives.Registry, name string) bool {
+	_, ok := prims.Lookup(name)
+	return ok
 }
@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/object"
+	"testing"
+)
+
+func TestConvertSExprToASTSpans(t *testing.T) {
+	code := testEval("1: '(((f n) (l1 (return (n + 1)))));")
+	lst, ok := code.(*object.List)
+	if !ok {
+		t.Fatalf("expected list, got %T (%+v)", code, code)
+	}
+	prog, err := ConvertSExprToAST(lst.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "f(n):\nl1: return (n + 1);\n"
+	if prog.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, prog.String())
+	}
+
+	ret := prog.Statements[0].Statements[0].(*ast.ReturnStatement)
+	span := ret.ReturnValue.Span()
+	want := ast.Span{File: ResidualFile}
+	want.Start.Line, want.Start.Column, want.Start.Offset = 2, 12, 18
+	want.End.Line, want.End.Column, want.End.Offset = 2, 17, 23
+	if span != want {
+		t.Fatalf("expected span %s, got %s", want, span)
+	}
+	if expected[span.Start.Offset:span.End.Offset] != "n + 1" {
+		t.Fatalf("span does not cover the expression, got %q", expected[span.Start.Offset:span.End.Offset])
+	}
+}
+
+func TestConvertSExprToASTStrings(t *testing.T) {
+	code := &object.List{Value: []object.Object{
+		&object.List{Value: []object.Object{&object.Symbol{Value: "f"}, &object.Symbol{Value: "n"}}},
+		&object.List{Value: []object.Object{
+			&object.Symbol{Value: "l1"},
+			&object.List{Value: []object.Object{
+				&object.Symbol{Value: "return"},
+				&object.List{Value: []object.Object{
+					&object.Symbol{Value: "concat"},
+					&object.List{Value: []object.Object{&object.Symbol{Value: "quote"}, &object.String{Value: "a \"b\""}}},
+					&object.String{Value: "="},
+					&object.Symbol{Value: "n"},
+				}},
+			}},
+		}},
+	}}
+	prog, err := ConvertSExprToAST([]object.Object{code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "f(n):\nl1: return concat(\"a \\\"b\\\"\", \"=\", n);\n"
+	if prog.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, prog.String())
+	}
+}
+
+func TestConvertSExprToASTQuotedData(t *testing.T) {
+	data := testEval(`1: '(hd (-1 true "s") 'x ());`)
+	code := &object.List{Value: []object.Object{
+		&object.List{Value: []object.Object{&object.Symbol{Value: "f"}}},
+		&object.List{Value: []object.Object{
+			&object.Symbol{Value: "l1"},
+			&object.List{Value: []object.Object{
+				&object.Symbol{Value: "return"},
+				&object.List{Value: []object.Object{&object.Symbol{Value: "quote"}, data}},
+			}},
+		}},
+	}}
+	prog, err := ConvertSExprToAST([]object.Object{code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "f():\nl1: return '(hd (-1 true \"s\") 'x ());\n"
+	if prog.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, prog.String())
+	}
+	got := testEval(prog.String())
+	if got.String() != data.String() {
+		t.Fatalf("residual returns %s, expected %s", got, data)
+	}
+}
@@ -3,8 +3,11 @@ package evaluator
 import (
 	"bytes"
 	"cogen/ast"
+	"cogen/diagnostics"
 	"cogen/object"
 	"fmt"
+	"math"
+	"math/big"
 )
 
 var (
@@ -14,30 +17,53 @@ var (
 )
 
 type Evaluator struct {
-	Program *ast.Program
+	Program  *ast.Program
+	Options  Options
+	Observer Observer // told what programs do as they run, if not nil
+
+	labels map[string]*ast.LabelStatement // the first block of each label
+	active *Machine                       // the machine in Step, if any
 }
 
 func New(program *ast.Program) *Evaluator {
 	return &Evaluator{Program: program}
 }
 
+// lookup returns the block a jump to label goes to, or nil. A label
+// defined twice names its first block.
+func (e *Evaluator) lookup(label string) *ast.LabelStatement {
+	if e.labels == nil {
+		e.labels = map[string]*ast.LabelStatement{}
+		if e.Program != nil {
+			for _, block := range e.Program.Statements {
+				if _, ok := e.labels[block.Label.Value]; !ok {
+					e.labels[block.Label.Value] = block
+				}
+			}
+		}
+	}
+	return e.labels[label]
+}
+
 func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
 	if node == nil {
 		return NULL
 	}
 	switch node := node.(type) {
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return &object.Integer{Value: node.Value, Big: node.Big}
 	case *ast.BooleanLiteral:
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
 	case *ast.LabelStatement:
-		return e.evalStatements(node.Statements, env)
+		return e.runNested(node, env, nil)
 	case *ast.Program:
 		return e.evalProgram(node, env)
 	case *ast.SymbolExpression:
 		return &object.Symbol{Value: node.Value}
 	case *ast.Constant:
-		return e.Eval(node.Value, env)
+		return e.evalDatum(node.Value, env)
 	case *ast.ExpressionStatement:
 		return e.Eval(node.Expression, env)
 	case *ast.PrefixExpression:
@@ -45,21 +71,24 @@ func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withRange(evalPrefixExpression(node.Operator, right), node)
 	case *ast.InfixExpression:
 		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "and" || node.Operator == "or" {
+			return e.evalLogicalExpression(node, left, env)
+		}
 		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return withRange(evalInfixExpression(node.Operator, left, right), node)
 	case *ast.IfStatement:
 		return e.evalIfExpression(node, env)
 	case *ast.GotoStatement:
-		return e.evalGotoExpression(node, env)
+		return e.Eval(&node.Label, env)
 	case *ast.ReturnStatement:
 		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -93,58 +122,48 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// evalProgram runs prog from its first block, within the bounds runNested
+// keeps to. A program other than the one the evaluator was made for gets
+// an evaluator of its own, with the same Options and Observer, so that its
+// labels are the ones jumped to.
 func (e *Evaluator) evalProgram(prog *ast.Program, env *object.Environment) object.Object {
-	result := e.Eval(prog.Statements[0], env)
-	switch result := result.(type) {
-	case *object.ReturnValue:
-		return result.Value
-	case *object.Error:
-		return result
+	if len(prog.Statements) == 0 {
+		return newError("program has no labels")
 	}
-	return result
+	if prog != e.Program {
+		other := New(prog)
+		other.Options, other.Observer, other.active = e.Options, e.Observer, e.active
+		return other.runNested(prog.Statements[0], env, nil)
+	}
+	return e.runNested(prog.Statements[0], env, nil)
 }
 
+// evalLabel runs the program from the block label names.
 func (e *Evaluator) evalLabel(node *ast.Label, env *object.Environment) object.Object {
-	var labelStmt *ast.LabelStatement
-	for _, v := range e.Program.Statements {
-		if v.Label.Value == node.Value {
-			labelStmt = v
-			break
-		}
-	}
-
+	labelStmt := e.lookup(node.Value)
 	if labelStmt == nil {
-		return newError("label not found: %s", node.Value)
+		err := newCodeError(diagnostics.LabelNotFound, "label not found: %s", node.Value)
+		err.Range = diagnostics.FromNode(node)
+		return err
 	}
-
-	evaluated := e.Eval(labelStmt, env)
-	return evaluated
+	return e.runNested(labelStmt, env, nil)
 }
 
-func (e *Evaluator) evalGotoExpression(node *ast.GotoStatement, env *object.Environment) object.Object {
-	evaluated := e.Eval(&node.Label, env)
-	return evaluated
+func newError(format string, a ...any) *object.Error {
+	return newCodeError(diagnostics.RuntimeError, format, a...)
 }
 
-func (e *Evaluator) evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
-	var result object.Object
-
-	for _, statement := range stmts {
-		result = e.Eval(statement, env)
-
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE || rt == object.ERROR {
-
-				return result
-			}
-		}
+// withRange points an error produced while evaluating a node at the node,
+// unless the error already knows where it came from.
+func withRange(obj object.Object, node ast.Node) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Range.IsZero() {
+		err.Range = diagnostics.FromNode(node)
 	}
-	return result
+	return obj
 }
 
-func newError(format string, a ...any) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newCodeError(code diagnostics.Code, format string, a ...any) *object.Error {
+	return &object.Error{Code: code, Message: fmt.Sprintf(format, a...)}
 }
 
 func isTruthy(obj object.Object) bool {
@@ -160,22 +179,55 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func (e *Evaluator) evalCallExpression(node *ast.CallExpression, env *object.Environment) object.Object {
-	var labelStmt *ast.LabelStatement
-	for _, v := range e.Program.Statements {
-		if v.Label.Value == node.Label.Value {
-			labelStmt = v
-			break
-		}
-	}
+// IsTruthy reports whether obj counts as true in a condition: anything
+// but false and the null value.
+func IsTruthy(obj object.Object) bool { return isTruthy(obj) }
+
+// Infix applies a binary operator as the evaluator does, for operators
+// other than and and or, which only evaluate their right operand if needed.
+func Infix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
 
+// Prefix applies a unary operator as the evaluator does.
+func Prefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// evalCallExpression runs a call outside of an assignment, where the
+// machine cannot push a frame for it.
+func (e *Evaluator) evalCallExpression(node *ast.CallExpression, env *object.Environment) object.Object {
+	labelStmt := e.lookup(node.Label.Value)
 	if labelStmt == nil {
-		return newError("LabelStatement not found in call expression: %s", node.Label.Value)
+		err := newCodeError(diagnostics.LabelNotFound, "LabelStatement not found in call expression: %s", node.Label.Value)
+		err.Range = diagnostics.FromNode(node)
+		return err
 	}
+	return e.runNested(labelStmt, object.NewEnclosedEnvironment(env), node)
+}
 
-	newEnv := object.NewEnclosedEnvironment(env)
-	evaluated := e.Eval(labelStmt, newEnv)
-	return unwrapReturnValue(evaluated)
+// evalDatum evaluates quoted data. A quote nested inside it is data too, so
+// ''a is the list (quote a).
+func (e *Evaluator) evalDatum(node ast.Expression, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.List:
+		values := make([]object.Object, len(node.Value))
+		for i, elem := range node.Value {
+			values[i] = e.evalDatum(elem, env)
+			if isError(values[i]) {
+				return values[i]
+			}
+		}
+		return &object.List{Value: values}
+	case *ast.Constant:
+		value := e.evalDatum(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		return &object.List{Value: []object.Object{&object.Symbol{Value: "quote"}, value}}
+	default:
+		return e.Eval(node, env)
+	}
 }
 
 func (e *Evaluator) evalList(node *ast.List, env *object.Environment) object.Object {
@@ -183,13 +235,6 @@ func (e *Evaluator) evalList(node *ast.List, env *object.Environment) object.Obj
 	return &object.List{Value: value}
 }
 
-func unwrapReturnValue(obj object.Object) object.Object {
-	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue.Value
-	}
-	return obj
-}
-
 func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, exp := range exps {
@@ -212,13 +257,20 @@ func (e *Evaluator) evalPrimitiveCall(node *ast.PrimitiveCall, env *object.Envir
 		out.WriteString(fmt.Sprintf("(%s, %s) ", val.String(), val.Type()))
 	}
 
-	return CallPrimitive(node.Primitive.String(), args)
+	name := node.Primitive.String()
+	result := withRange(e.checkList(e.Options.Registry().Call(name, args)), node)
+	if e.Observer != nil {
+		e.Observer.Primitive(name, args, result)
+	}
+	return result
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	val, ok := env.Get(node.Value)
 	if !ok {
-		return newError("identifier not found: %s at %d:%d", node.Value, node.Token.Line, node.Token.Column)
+		err := newCodeError(diagnostics.IdentifierNotFound, "identifier not found: %s at %d:%d", node.Value, node.Token.Line, node.Token.Column)
+		err.Range = diagnostics.FromNode(node)
+		return err
 	}
 	return val
 }
@@ -230,19 +282,34 @@ func (e *Evaluator) evalIfExpression(stmt *ast.IfStatement, env *object.Environm
 	}
 	if isTruthy(condition) {
 		return e.Eval(&stmt.LabelTrue, env)
-	} else {
-		return e.Eval(&stmt.LabelFalse, env)
 	}
+	return e.Eval(&stmt.LabelFalse, env)
+}
+
+// evalLogicalExpression evaluates and/or, only evaluating the right operand
+// if the left one does not decide the result.
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if node.Operator == "and" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "or" && isTruthy(left) {
+		return TRUE
+	}
+	right := e.Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
-	case "!":
+	case "!", "not":
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s for %s", operator, right.String())
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s for %s", operator, right.String())
 	}
 }
 
@@ -256,9 +323,12 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	value, ok := right.(*object.Integer)
 	if !ok {
-		return newError("unknown operator: -%s", right.Type())
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: -%s", right.Type())
 	}
-	return &object.Integer{Value: -value.Value}
+	if value.IsInt64() && value.Value != math.MinInt64 {
+		return &object.Integer{Value: -value.Value}
+	}
+	return object.NewInteger(new(big.Int).Neg(value.BigInt()))
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -274,18 +344,46 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
+// intergetInfix works on int64 values while the result fits, and on
+// math/big values otherwise; see bigInfix.
 func intergetInfix(operator string, leftObj, rightObj object.Object) object.Object {
-	left := leftObj.(*object.Integer).Value
-	right := rightObj.(*object.Integer).Value
+	l, r := leftObj.(*object.Integer), rightObj.(*object.Integer)
+	if !l.IsInt64() || !r.IsInt64() {
+		return bigInfix(operator, l, r)
+	}
+	left, right := l.Value, r.Value
 	switch operator {
 	case "+":
-		return &object.Integer{Value: left + right}
+		if sum := left + right; (left^sum)&(right^sum) >= 0 {
+			return &object.Integer{Value: sum}
+		}
+		return bigInfix(operator, l, r)
 	case "-":
-		return &object.Integer{Value: left - right}
+		if diff := left - right; (left^right)&(left^diff) >= 0 {
+			return &object.Integer{Value: diff}
+		}
+		return bigInfix(operator, l, r)
 	case "*":
-		return &object.Integer{Value: left * right}
+		if left == 0 || right == 0 {
+			return &object.Integer{Value: 0}
+		}
+		if prod := left * right; prod/right == left && !(left == -1 && right == math.MinInt64) && !(right == -1 && left == math.MinInt64) {
+			return &object.Integer{Value: prod}
+		}
+		return bigInfix(operator, l, r)
 	case "/":
+		if right == 0 {
+			return newCodeError(diagnostics.DivisionByZero, "division by zero: %d / %d", left, right)
+		}
+		if left == math.MinInt64 && right == -1 {
+			return bigInfix(operator, l, r)
+		}
 		return &object.Integer{Value: left / right}
+	case "%":
+		if right == 0 {
+			return newCodeError(diagnostics.DivisionByZero, "modulo by zero: %d %% %d", left, right)
+		}
+		return &object.Integer{Value: left % right}
 	case "=":
 		if left == right {
 			return TRUE
@@ -310,8 +408,12 @@ func intergetInfix(operator string, leftObj, rightObj object.Object) object.Obje
 		} else {
 			return FALSE
 		}
+	case "<=":
+		return nativeBoolToBooleanObject(left <= right)
+	case ">=":
+		return nativeBoolToBooleanObject(left >= right)
 	default:
-		return newError("unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.Type())
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.Type())
 	}
 }
 
@@ -332,7 +434,7 @@ func booleanInfix(operator string, leftObj, rightObj object.Object) object.Objec
 			return FALSE
 		}
 	default:
-		return newError("unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.Type())
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.Type())
 	}
 }
 
@@ -368,7 +470,7 @@ func listInfix(operator string, leftObj, rightObj object.Object) object.Object {
 			return TRUE
 		}
 	default:
-		return newError("unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.Type())
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.Type())
 	}
 }
 
@@ -390,13 +492,27 @@ func symbolInfix(operator string, leftObj object.Object, rightObj object.Object)
 			return FALSE
 		}
 	default:
-		return newError("unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.String())
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.String())
+	}
+}
+
+func stringInfix(operator string, leftObj object.Object, rightObj object.Object) object.Object {
+	left := leftObj.(*object.String).Value
+	right := rightObj.(*object.String).Value
+
+	switch operator {
+	case "=":
+		return nativeBoolToBooleanObject(left == right)
+	case "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s %s %s", leftObj.Type(), operator, rightObj.Type())
 	}
 }
 
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	if left.Type() != right.Type() {
-		return newError("type mismatch: %s %s %s, for: %s %s", left.Type(), operator, right.Type(), left, right)
+		return newCodeError(diagnostics.TypeMismatch, "type mismatch: %s %s %s, for: %s %s", left.Type(), operator, right.Type(), left, right)
 	}
 	switch left.Type() {
 	case object.INTEGER:
@@ -408,7 +524,9 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 		return listInfix(operator, left, right)
 	case object.SYMBOL:
 		return symbolInfix(operator, left, right)
+	case object.STRING:
+		return stringInfix(operator, left, right)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+	"cogen/diagnostics"
 	"cogen/lexer"
 	"cogen/object"
 	"cogen/parser"
+	"cogen/token"
 	"fmt"
 	"os"
 	"testing"
@@ -29,6 +31,8 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"1: 3 * 3 * 3 + 10;", 37},
 		{"1: 3 * (3 * 3) + 10;", 37},
 		{"1: (5 + 10 * 2 + 15 / 3) * 2 + -10;", 50},
+		{"1: 17 % 5;", 2},
+		{"1: 2 + 17 % 5 * 3;", 8},
 	}
 
 	for _, tt := range tests {
@@ -37,6 +41,62 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1: 9223372036854775807 + 1;", "9223372036854775808"},
+		{"1: -9223372036854775808 - 1;", "-9223372036854775809"},
+		{"1: 4294967296 * 4294967296;", "18446744073709551616"},
+		{"1: -(-9223372036854775807 - 1);", "9223372036854775808"},
+		{"1: (-9223372036854775807 - 1) / -1;", "9223372036854775808"},
+		{"1: 123456789012345678901234567890;", "123456789012345678901234567890"},
+		{"1: 18446744073709551616 - 18446744073709551615;", "1"},
+		{"1: 100000000000000000000 / 7;", "14285714285714285714"},
+		// Division truncates toward zero, the remainder has the sign of
+		// the dividend.
+		{"1: -7 / 2;", "-3"},
+		{"1: -7 % 2;", "-1"},
+		{"1: 7 % -2;", "1"},
+		{"1: -100000000000000000000 / 7;", "-14285714285714285714"},
+		{"1: -100000000000000000000 % 7;", "-2"},
+		{"1: 100000000000000000000 > 99999999999999999999;", "true"},
+		{"1: 100000000000000000000 = 100000000000000000000;", "true"},
+		{"1: 100000000000000000000 < 1;", "false"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.String() != tt.expected {
+			t.Errorf("%q: expected %s, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	// Results that fit in an int64 are kept there.
+	small := testEval("1: 18446744073709551616 / 4294967296;").(*object.Integer)
+	if !small.IsInt64() || small.Value != 4294967296 {
+		t.Errorf("expected int64 4294967296, got %+v", small)
+	}
+}
+
+func TestParseArgument(t *testing.T) {
+	for _, arg := range []string{"-5", "99999999999999999999", "-99999999999999999999", "'(1 -123456789012345678901)"} {
+		val, err := ParseArgument(arg)
+		if err != nil {
+			t.Errorf("%s: %v", arg, err)
+			continue
+		}
+		if val.String() != arg {
+			t.Errorf("%s: got %s", arg, val)
+		}
+	}
+	for _, arg := range []string{"'(a", "1 +", "1 2", "x"} {
+		if val, err := ParseArgument(arg); err == nil {
+			t.Errorf("%s: got %s, want an error", arg, val)
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -52,6 +112,21 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1: 1 != 1;", false},
 		{"1: 1 = 2;", false},
 		{"1: 1 != 2;", true},
+		{"1: 1 <= 2;", true},
+		{"1: 2 <= 2;", true},
+		{"1: 3 <= 2;", false},
+		{"1: 1 >= 2;", false},
+		{"1: 2 >= 2;", true},
+		{"1: true and false;", false},
+		{"1: true and true;", true},
+		{"1: false or true;", true},
+		{"1: false or false;", false},
+		{"1: not true;", false},
+		{"1: not 1 = 2;", true},
+		{"1: 1 < 2 and 2 < 3 or false;", true},
+		{"1: false and foobar;", false},
+		{"1: true or foobar;", true},
+		{"1: false and 1 % 0 = 0;", false},
 	}
 
 	for _, tt := range tests {
@@ -75,6 +150,118 @@ func TestSymbolExpression(t *testing.T) {
 	}
 }
 
+func TestStringExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`1: "a, b";`, "a, b"},
+		{`1: concat("x", " := ", "1");`, "x := 1"},
+		{`1: concat();`, ""},
+		{`1: strlen("héllo");`, int64(5)},
+		{`1: substr("héllo", 1, 3);`, "él"},
+		{`1: substr("abc", 3, 3);`, ""},
+		{`1: symbol->string('stop);`, "stop"},
+		{`1: string->symbol("stop") = 'stop;`, true},
+		{`1: "a" = "a";`, true},
+		{`1: "a" != "a";`, false},
+		{`1: "a" = concat("a", "\n");`, false},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestQuotedDatum(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1: '-1;", "-1"},
+		{"1: 'true;", "true"},
+		{`1: '"s";`, `"s"`},
+		{"1: '(-1 2);", "'(-1 2)"},
+		{"1: '(true false);", "'(true false)"},
+		{`1: '("a \"b\"" c);`, `'("a \"b\"" c)`},
+		{"1: '(a 'b);", "'(a (quote b))"},
+		{"1: ''a;", "'(quote a)"},
+		{"1: '(a '(b 'c));", "'(a (quote (b (quote c))))"},
+		{"1: '(() (()));", "'(() (()))"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.String() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated)
+			continue
+		}
+		// Reading the printed value back gives the same value.
+		again := testEval("1: " + evaluated.String() + ";")
+		if !isTruthy(evalInfixExpression("=", evaluated, again)) || again.String() != evaluated.String() {
+			t.Errorf("%s does not round-trip, read back as %s", evaluated, again)
+		}
+	}
+
+	// Types survive inside lists.
+	lst, ok := testEval(`1: '(-1 true "s" x);`).(*object.List)
+	if !ok {
+		t.Fatal("expected list")
+	}
+	testIntegerObject(t, lst.Value[0], -1)
+	testBooleanObject(t, lst.Value[1], true)
+	testStringObject(t, lst.Value[2], "s")
+	testSymbolObject(t, lst.Value[3], "x")
+}
+
+func TestEmptyList(t *testing.T) {
+	inputs := []string{
+		"1: '();",
+		"1: '( );",
+		"1: '(\n /* empty */\n);",
+		"1: list();",
+		"1: tl('(x));",
+		"1: hd('(()));",
+	}
+	for _, input := range inputs {
+		evaluated := testEval(input)
+		lst, ok := evaluated.(*object.List)
+		if !ok || len(lst.Value) != 0 {
+			t.Errorf("%q: expected the empty list, got %s", input, evaluated)
+			continue
+		}
+		if lst.String() != "'()" {
+			t.Errorf("%q: expected '(), got %s", input, lst)
+		}
+	}
+}
+
+func TestBookDialect(t *testing.T) {
+	input := `read m, n;
+1-init: result := 1;
+        goto test?;
+test?: if n < 1 goto end else loop-body;
+loop-body: result := result * m;
+        n := n - 1;
+        goto test?;
+end: return result;`
+	p := parser.New(lexer.New(input, token.BookDialect))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatal(p.GetErrorMessage())
+	}
+	env := object.NewEnvironment()
+	env.Set("m", &object.Integer{Value: 2})
+	env.Set("n", &object.Integer{Value: 5})
+	testIntegerObject(t, New(program).Eval(program, env), 32)
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -124,6 +311,42 @@ func TestErrorHandling(t *testing.T) {
 			"1: foobar;",
 			"identifier not found: foobar at 1:3",
 		},
+		{
+			"1: 5 % 0;",
+			"modulo by zero: 5 % 0",
+		},
+		{
+			"1: 5 / 0;",
+			"division by zero: 5 / 0",
+		},
+		{
+			"1: 100000000000000000000 / (2 - 2);",
+			"division by zero: 100000000000000000000 / 0",
+		},
+		{
+			`1: substr("abc", 0, 100000000000000000000);`,
+			"substr range [0, 100000000000000000000) out of bounds for string of length 3",
+		},
+		{
+			`1: "a" + "b";`,
+			"unknown operator: STRING + STRING",
+		},
+		{
+			`1: concat("a", 'b);`,
+			"concat expects strings, got SYMBOL as argument 2",
+		},
+		{
+			`1: substr("abc", 2, 4);`,
+			"substr range [2, 4) out of bounds for string of length 3",
+		},
+		{
+			`1: string->symbol('a);`,
+			"string->symbol expects string, got SYMBOL",
+		},
+		{
+			"1: true and foobar;",
+			"identifier not found: foobar at 1:12",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -141,6 +364,33 @@ func TestErrorHandling(t *testing.T) {
 
 }
 
+func TestErrorDiagnostics(t *testing.T) {
+	tests := []struct {
+		input  string
+		code   diagnostics.Code
+		line   int
+		column int
+	}{
+		{"1: foobar;", diagnostics.IdentifierNotFound, 1, 3},
+		{"1: x := 1;\n   x + true;", diagnostics.TypeMismatch, 2, 3},
+		{"1: goto 7;", diagnostics.LabelNotFound, 1, 8},
+		{"1: hd(1, 2);", diagnostics.PrimitiveArity, 1, 3},
+		{"1: x := 0;\n   1 / x;", diagnostics.DivisionByZero, 2, 3},
+	}
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned", tt.input)
+			continue
+		}
+		d := errObj.Diagnostic()
+		if d.Code != tt.code || d.Range.Start.Line != tt.line || d.Range.Start.Column != tt.column {
+			t.Errorf("%q: expected %s at %d:%d, got %s at %d:%d", tt.input, tt.code, tt.line, tt.column,
+				d.Code, d.Range.Start.Line, d.Range.Start.Column)
+		}
+	}
+}
+
 func TestVariables(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -307,6 +557,20 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testSymbolObject(t *testing.T, obj object.Object, expected string) bool {
 	result, ok := obj.(*object.Symbol)
 	if !ok {
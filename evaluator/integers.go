@@ -0,0 +1,49 @@
+package evaluator
+
+import (
+	"cogen/diagnostics"
+	"cogen/object"
+)
+
+// bigInfix applies operator to integers of any size. The results are
+// exact: integers never overflow, they grow. Division truncates toward
+// zero and the remainder has the sign of the dividend, so that
+//
+//	(l / r) * r + l % r = l
+//
+// as for Go's int64. Dividing by zero is a DivisionByZero error.
+func bigInfix(operator string, l, r *object.Integer) object.Object {
+	left, right := l.BigInt(), r.BigInt()
+	switch operator {
+	case "+":
+		return object.NewInteger(left.Add(left, right))
+	case "-":
+		return object.NewInteger(left.Sub(left, right))
+	case "*":
+		return object.NewInteger(left.Mul(left, right))
+	case "/":
+		if right.Sign() == 0 {
+			return newCodeError(diagnostics.DivisionByZero, "division by zero: %s / %s", l, r)
+		}
+		return object.NewInteger(left.Quo(left, right))
+	case "%":
+		if right.Sign() == 0 {
+			return newCodeError(diagnostics.DivisionByZero, "modulo by zero: %s %% %s", l, r)
+		}
+		return object.NewInteger(left.Rem(left, right))
+	case "=":
+		return nativeBoolToBooleanObject(left.Cmp(right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(left.Cmp(right) != 0)
+	case "<":
+		return nativeBoolToBooleanObject(left.Cmp(right) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(left.Cmp(right) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(left.Cmp(right) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(left.Cmp(right) >= 0)
+	default:
+		return newCodeError(diagnostics.UnknownOperator, "unknown operator: %s %s %s", l.Type(), operator, r.Type())
+	}
+}
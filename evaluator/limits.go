@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/object"
+	"cogen/primitives"
+	"context"
+	"errors"
+	"time"
+)
+
+// Options bounds an evaluation and sets the primitives it may call. A
+// zero bound sets no bound.
+type Options struct {
+	MaxSteps      int           // statements run
+	MaxCallDepth  int           // calls active at once
+	MaxListLength int           // elements of a list built by a primitive
+	Timeout       time.Duration // wall-clock time from the start
+
+	Primitives *primitives.Registry // nil: the standard primitives
+}
+
+// Registry returns the primitives an evaluation with o may call. The
+// standard registry it may return must not be changed.
+func (o Options) Registry() *primitives.Registry {
+	if o.Primitives == nil {
+		return standard
+	}
+	return o.Primitives
+}
+
+// Eval runs program with the variables in env until it finishes, ctx is
+// done or a bound in opts is passed. Passing a bound, or ctx ending,
+// returns an *object.Error for which LimitExceeded is true.
+func Eval(ctx context.Context, program *ast.Program, env *object.Environment, opts Options) object.Object {
+	e := New(program)
+	e.Options = opts
+	return e.StartContext(ctx, env).Run()
+}
+
+// LimitExceeded reports whether obj is the error of an evaluation stopped
+// by its Options or its context.
+func LimitExceeded(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Code == diagnostics.LimitExceeded
+}
+
+// StartContext is like Start, but the machine stops with a limit error
+// once ctx is done or the Timeout of the evaluator's Options has passed.
+func (e *Evaluator) StartContext(ctx context.Context, env *object.Environment) *Machine {
+	return e.bound(e.Start(env), ctx)
+}
+
+// bound makes m stop once ctx is done or the Timeout has passed.
+func (e *Evaluator) bound(m *Machine, ctx context.Context) *Machine {
+	m.ctx = ctx
+	if e.Options.Timeout > 0 {
+		m.ctx, m.cancel = context.WithTimeout(ctx, e.Options.Timeout)
+	}
+	if m.done {
+		m.release()
+	}
+	return m
+}
+
+// checkLimits stops the machine before its next step if a bound is passed.
+func (m *Machine) checkLimits() bool {
+	if limit := m.e.Options.MaxSteps; limit > 0 && m.steps >= limit {
+		m.fail(limitError(m.Next(), "step limit of %d exceeded", limit))
+		return false
+	}
+	if m.ctx != nil {
+		if err := m.ctx.Err(); err != nil {
+			msg := "evaluation canceled"
+			if errors.Is(err, context.DeadlineExceeded) {
+				msg = "evaluation deadline exceeded"
+			}
+			m.fail(limitError(m.Next(), "%s after %d steps", msg, m.steps))
+			return false
+		}
+	}
+	return true
+}
+
+// checkDepth stops the machine at call if one more call would pass
+// MaxCallDepth.
+func (m *Machine) checkDepth(call ast.Node) bool {
+	if limit := m.e.Options.MaxCallDepth; limit > 0 && m.top().Depth >= limit {
+		m.fail(limitError(call, "call depth limit of %d exceeded", limit))
+		return false
+	}
+	return true
+}
+
+// checkList returns a limit error in place of a list longer than
+// MaxListLength.
+func (e *Evaluator) checkList(obj object.Object) object.Object {
+	list, ok := obj.(*object.List)
+	if limit := e.Options.MaxListLength; ok && limit > 0 && len(list.Value) > limit {
+		return newCodeError(diagnostics.LimitExceeded, "list length limit of %d exceeded", limit)
+	}
+	return obj
+}
+
+func limitError(node ast.Node, format string, a ...any) *object.Error {
+	err := newCodeError(diagnostics.LimitExceeded, format, a...)
+	err.Range = diagnostics.FromNode(node)
+	return err
+}
+
+// release frees the timer of a Timeout once the machine is done.
+func (m *Machine) release() {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+}
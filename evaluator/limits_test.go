@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const forever = `spin(n);
+loop: n := n + 1; goto loop;`
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     Options
+		expected string
+	}{
+		{"steps", forever, Options{MaxSteps: 10}, "step limit of 10 exceeded"},
+		{"depth", "1: x := call 1; return x;", Options{MaxCallDepth: 3}, "call depth limit of 3 exceeded"},
+		{"list", "1: xs := '(); goto 2;\n2: xs := cons(1, xs); goto 2;", Options{MaxListLength: 5}, "list length limit of 5 exceeded"},
+		{"timeout", forever, Options{Timeout: time.Millisecond}, "evaluation deadline exceeded"},
+	}
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+		env.Set("n", &object.Integer{Value: 0})
+		got := Eval(context.Background(), program, env, tt.opts)
+
+		if !LimitExceeded(got) {
+			t.Errorf("%s: expected a limit error, got %v", tt.name, got)
+			continue
+		}
+		errObj := got.(*object.Error)
+		if !strings.HasPrefix(errObj.Message, tt.expected) {
+			t.Errorf("%s: wrong message. expected prefix=%q, got=%q", tt.name, tt.expected, errObj.Message)
+		}
+		if errObj.Range.IsZero() {
+			t.Errorf("%s: expected the error to point at the program", tt.name)
+		}
+	}
+}
+
+func TestLimitsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	program := parser.New(lexer.New(forever)).ParseProgram()
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 0})
+
+	e := New(program)
+	m := e.StartContext(ctx, env)
+	for i := 0; i < 100; i++ {
+		m.Step()
+	}
+	cancel()
+	got := m.Run()
+	if !LimitExceeded(got) || got.(*object.Error).Message != "evaluation canceled after 100 steps" {
+		t.Errorf("expected the machine to stop once canceled, got %v", got)
+	}
+}
+
+// TestLimitsEvalNode checks that the bounds hold for blocks run by Eval
+// outside a machine.
+func TestLimitsEvalNode(t *testing.T) {
+	program := parser.New(lexer.New(forever + "\ndeep: x := call deep; return x;")).ParseProgram()
+	loop := program.Statements[0]
+	tests := []struct {
+		name     string
+		node     ast.Node
+		opts     Options
+		expected string
+	}{
+		{"steps", loop, Options{MaxSteps: 10}, "step limit of 10 exceeded"},
+		{"program", program, Options{Timeout: time.Millisecond}, "evaluation deadline exceeded"},
+		{"other program", parser.New(lexer.New(forever)).ParseProgram(), Options{MaxSteps: 10}, "step limit of 10 exceeded"},
+		{"timeout", &loop.Label, Options{Timeout: time.Millisecond}, "evaluation deadline exceeded"},
+		{"depth", &ast.CallExpression{Label: ast.Label{Value: "deep"}}, Options{MaxCallDepth: 3}, "call depth limit of 3 exceeded"},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("n", &object.Integer{Value: 0})
+		e := New(program)
+		e.Options = tt.opts
+		got := e.Eval(tt.node, env)
+		if !LimitExceeded(got) || !strings.HasPrefix(got.(*object.Error).Message, tt.expected) {
+			t.Errorf("%s: expected %q, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestLimitsNotReached(t *testing.T) {
+	program := parser.New(lexer.New(`ackerman(m, n):
+ack: if m = 0 goto done else next;
+next: if n = 0 goto ack0 else ack1;
+done: return n + 1;
+ack0: n := 1; goto ack2;
+ack1: n := n - 1; n := call ack; goto ack2;
+ack2: m := m - 1; n := call ack; return n;`)).ParseProgram()
+	env := object.NewEnvironment()
+	env.Set("m", &object.Integer{Value: 2})
+	env.Set("n", &object.Integer{Value: 3})
+
+	opts := Options{MaxSteps: 10_000, MaxCallDepth: 100, MaxListLength: 10, Timeout: time.Minute}
+	got := Eval(context.Background(), program, env, opts)
+	testIntegerObject(t, got, 9)
+
+	if LimitExceeded(newError("x")) || LimitExceeded(newCodeError(diagnostics.LabelNotFound, "x")) {
+		t.Errorf("expected other errors not to be limit errors")
+	}
+}
@@ -0,0 +1,285 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/object"
+	"context"
+)
+
+// A Machine runs a program one statement at a time. It holds a stack of
+// frames, one per active call, so neither loops nor calls grow the Go
+// stack.
+type Machine struct {
+	e      *Evaluator
+	frames []*Frame
+	result object.Object
+	done   bool
+
+	running ast.Statement // the statement Step is running, if any
+
+	ctx    context.Context // nil if the machine cannot be stopped
+	cancel context.CancelFunc
+	steps  int
+}
+
+// A Frame is a block being run: the statement to run next and the
+// variables it sees. A goto moves the frame to another block; a call
+// pushes a new frame whose environment encloses the caller's.
+type Frame struct {
+	Block *ast.LabelStatement
+	PC    int // index of the next statement in Block.Statements
+	Env   *object.Environment
+	Depth int // calls active below the frame, 0 for the program
+
+	dest *ast.Identifier // the caller's variable that gets the result
+	last object.Object   // value of the last statement, if the block ends without a jump
+}
+
+// Start returns a machine about to run the first block of the program
+// with the variables in env.
+func (e *Evaluator) Start(env *object.Environment) *Machine {
+	if e.Program == nil || len(e.Program.Statements) == 0 {
+		m := &Machine{e: e}
+		m.fail(newError("program has no labels"))
+		return m
+	}
+	return e.startAt(&Frame{Block: e.Program.Statements[0], Env: env})
+}
+
+func (e *Evaluator) startAt(f *Frame) *Machine {
+	m := &Machine{e: e, frames: []*Frame{f}}
+	if o := e.Observer; o != nil {
+		o.EnterLabel(m.top())
+	}
+	m.settle()
+	return m
+}
+
+// Done reports whether the program has finished, by a return, by running
+// off the end of a block or with an error.
+func (m *Machine) Done() bool { return m.done }
+
+// Result returns the value of the program once it is done: the returned
+// value, the value of the last statement of the block it ended in, or an
+// *object.Error.
+func (m *Machine) Result() object.Object { return m.result }
+
+// Frames returns the call stack, the running frame last. The frames are
+// live: stepping the machine changes them.
+func (m *Machine) Frames() []*Frame { return m.frames }
+
+// Next returns the statement the next Step runs, or nil when done.
+func (m *Machine) Next() ast.Statement {
+	if m.done {
+		return nil
+	}
+	f := m.top()
+	return f.Block.Statements[f.PC]
+}
+
+// Run steps the machine until the program is done and returns its result.
+func (m *Machine) Run() object.Object {
+	for m.Step() {
+	}
+	return m.result
+}
+
+// Step runs the next statement and reports whether there is more to run.
+func (m *Machine) Step() bool {
+	if m.done || !m.checkLimits() {
+		return false
+	}
+	m.steps++
+	f := m.top()
+	stmt := f.Block.Statements[f.PC]
+	if o := m.e.Observer; o != nil {
+		o.Statement(f, stmt)
+	}
+	f.PC++
+	m.running = stmt
+	outer := m.e.active
+	m.e.active = m
+
+	switch stmt := stmt.(type) {
+	case *ast.GotoStatement:
+		m.jump(f, &stmt.Label)
+	case *ast.IfStatement:
+		cond := m.e.Eval(stmt.Cond, f.Env)
+		if isError(cond) {
+			m.fail(cond)
+			break
+		}
+		taken := &stmt.LabelFalse
+		if isTruthy(cond) {
+			taken = &stmt.LabelTrue
+		}
+		if o := m.e.Observer; o != nil {
+			o.Branch(f, stmt, taken)
+		}
+		m.jump(f, taken)
+	case *ast.ReturnStatement:
+		val := m.e.Eval(stmt.ReturnValue, f.Env)
+		if isError(val) {
+			m.fail(val)
+			break
+		}
+		m.finish(val)
+	case *ast.AssignmentStatement:
+		if call, ok := stmt.Right.(*ast.CallExpression); ok {
+			m.call(f, call, stmt.Left)
+			break
+		}
+		val := m.e.Eval(stmt.Right, f.Env)
+		if isError(val) {
+			m.fail(val)
+			break
+		}
+		f.Env.Set(stmt.Left.Value, val)
+		f.last = nil
+		if o := m.e.Observer; o != nil {
+			o.Assign(f, stmt.Left.Value, val)
+		}
+	default:
+		val := m.e.Eval(stmt, f.Env)
+		if isError(val) {
+			m.fail(val)
+			break
+		}
+		f.last = val
+	}
+
+	m.e.active = outer
+	m.running = nil
+	m.settle()
+	return !m.done
+}
+
+// runNested runs block to its end for Eval, which meets gotos and calls
+// outside Step. Inside a running machine the nested one keeps to the same
+// bounds: it shares the context and the step count, and its frames sit
+// below the running frame. On its own it gets the Timeout of the Options.
+// call is the call that runs block, if any.
+func (e *Evaluator) runNested(block *ast.LabelStatement, env *object.Environment, call ast.Node) object.Object {
+	f := &Frame{Block: block, Env: env}
+	outer := e.active
+	if outer != nil {
+		f.Depth = outer.top().Depth
+	}
+	if call != nil {
+		if limit := e.Options.MaxCallDepth; limit > 0 && f.Depth >= limit {
+			return limitError(call, "call depth limit of %d exceeded", limit)
+		}
+		f.Depth++
+	}
+	if outer == nil {
+		return e.bound(e.startAt(f), context.Background()).Run()
+	}
+	m := e.startAt(f)
+	m.ctx, m.steps = outer.ctx, outer.steps
+	result := m.Run()
+	outer.steps = m.steps
+	return result
+}
+
+func (m *Machine) top() *Frame { return m.frames[len(m.frames)-1] }
+
+// jump moves f to the start of the block label names.
+func (m *Machine) jump(f *Frame, label *ast.Label) {
+	target := m.e.lookup(label.Value)
+	if target == nil {
+		err := newCodeError(diagnostics.LabelNotFound, "label not found: %s", label.Value)
+		err.Range = diagnostics.FromNode(label)
+		m.fail(err)
+		return
+	}
+	f.Block, f.PC, f.last = target, 0, nil
+	if o := m.e.Observer; o != nil {
+		o.EnterLabel(f)
+	}
+}
+
+// call pushes a frame for the block call names, whose result goes to dest.
+func (m *Machine) call(f *Frame, call *ast.CallExpression, dest *ast.Identifier) {
+	target := m.e.lookup(call.Label.Value)
+	if target == nil {
+		err := newCodeError(diagnostics.LabelNotFound, "LabelStatement not found in call expression: %s", call.Label.Value)
+		err.Range = diagnostics.FromNode(call)
+		m.fail(err)
+		return
+	}
+	if !m.checkDepth(call) {
+		return
+	}
+	callee := &Frame{Block: target, Env: object.NewEnclosedEnvironment(f.Env), Depth: f.Depth + 1, dest: dest}
+	m.frames = append(m.frames, callee)
+	if o := m.e.Observer; o != nil {
+		o.CallEnter(f, callee)
+		o.EnterLabel(callee)
+	}
+}
+
+// finish pops the running frame with its result, handing it to the caller
+// or ending the program.
+func (m *Machine) finish(val object.Object) {
+	f := m.top()
+	m.frames = m.frames[:len(m.frames)-1]
+	if len(m.frames) == 0 {
+		m.result, m.done = val, true
+		m.release()
+		return
+	}
+	caller := m.top()
+	caller.Env.Set(f.dest.Value, val)
+	caller.last = nil
+	if o := m.e.Observer; o != nil {
+		o.CallExit(f, val)
+		o.Assign(caller, f.dest.Value, val)
+	}
+}
+
+// settle ends the frames that have run off the end of their block, so
+// that Next always has a statement to show.
+func (m *Machine) settle() {
+	for !m.done {
+		f := m.top()
+		if f.PC < len(f.Block.Statements) {
+			return
+		}
+		m.finish(f.last)
+	}
+}
+
+func (m *Machine) fail(err object.Object) {
+	if e, ok := err.(*object.Error); ok && e.Stack == nil {
+		m.unwind(e)
+	}
+	m.result, m.done = err, true
+	m.release()
+}
+
+// unwind records in err where it happened: the statement that failed,
+// unless err already points at a node within it, and the active frames.
+func (m *Machine) unwind(err *object.Error) {
+	if len(m.frames) == 0 {
+		return
+	}
+	stmt := m.running
+	if stmt == nil {
+		// A limit stopped the machine before the next statement.
+		stmt = m.Next()
+	}
+	if err.Range.IsZero() {
+		err.Range = diagnostics.FromNode(stmt)
+	}
+	err.Stack = make([]object.CallFrame, 0, len(m.frames))
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		f := m.frames[i]
+		r := err.Range
+		if i < len(m.frames)-1 {
+			r = diagnostics.FromNode(f.Block.Statements[f.PC-1])
+		}
+		err.Stack = append(err.Stack, object.CallFrame{Label: f.Block.Label.Value, Range: r})
+	}
+	err.Label = err.Stack[0].Label
+}
@@ -0,0 +1,176 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"testing"
+)
+
+func TestLongLoop(t *testing.T) {
+	input := `count(n);
+loop: if n = 0 goto done else step;
+step: n := n - 1; goto loop;
+done: return 42;`
+
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 1_000_000})
+	testIntegerObject(t, testEvalWithEnv(input, env), 42)
+}
+
+func TestDeepCalls(t *testing.T) {
+	input := `depth(n);
+down: if n = 0 goto bottom else rec;
+rec: n := n - 1; r := call down; return r + 1;
+bottom: return 0;`
+
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 200_000})
+	testIntegerObject(t, testEvalWithEnv(input, env), 200_000)
+}
+
+func TestFallOffEnd(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1: x := 3; goto 2; 2: x + 1;", 4},
+		{"1: x := call 2; x * 2; 2: y := 4; goto 3; 3: y;", 8},
+		{"1: goto 2; 2:", 0},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		if tt.expected == 0 {
+			if got != nil {
+				t.Errorf("%q: expected nil, got %v", tt.input, got)
+			}
+			continue
+		}
+		testIntegerObject(t, got, tt.expected)
+	}
+}
+
+func TestStep(t *testing.T) {
+	input := `f(n);
+a: x := call b; goto c;
+b: return n + 1;
+c: return x * 2;`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 1})
+	m := New(program).Start(env)
+
+	type point struct {
+		block string
+		depth int
+		next  string
+	}
+	var trace []point
+	for !m.Done() {
+		f := m.Frames()[len(m.Frames())-1]
+		trace = append(trace, point{f.Block.Label.Value, len(m.Frames()), m.Next().String()})
+		m.Step()
+	}
+
+	want := []point{
+		{"a", 1, "x := call b"},
+		{"b", 2, "return (n + 1)"},
+		{"a", 1, "goto c"},
+		{"c", 1, "return (x * 2)"},
+	}
+	if len(trace) != len(want) {
+		t.Fatalf("wrong number of steps. want=%d, got=%d: %v", len(want), len(trace), trace)
+	}
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Errorf("step %d wrong. want=%v, got=%v", i, want[i], trace[i])
+		}
+	}
+	testIntegerObject(t, m.Result(), 4)
+	if m.Step() || m.Next() != nil {
+		t.Errorf("expected a finished machine to stay finished")
+	}
+}
+
+func TestStepErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1: goto 2;", "label not found: 2"},
+		{"1: x := call 2; return x;", "LabelStatement not found in call expression: 2"},
+		{"1: if 1 + true goto 1 else 1;", "type mismatch: INTEGER + BOOLEAN, for: 1 true"},
+	}
+	for _, tt := range tests {
+		m := New(parser.New(lexer.New(tt.input)).ParseProgram()).Start(object.NewEnvironment())
+		errObj, ok := m.Run().(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error, got %v", tt.input, m.Result())
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+
+	m := New(&ast.Program{}).Start(object.NewEnvironment())
+	if !m.Done() || !isError(m.Result()) {
+		t.Errorf("expected an error for a program without labels, got %v", m.Result())
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `f(x);
+init: y := call a;
+  return y;
+a: z := call b;
+  return z;
+b: return x + hd(x);`
+
+	env := object.NewEnvironment()
+	env.Set("x", &object.Integer{Value: 1})
+	err, ok := testEvalWithEnv(input, env).(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error")
+	}
+	if err.Label != "b" {
+		t.Errorf("error in %s, want b", err.Label)
+	}
+
+	want := `error[R001]: hd expects list, got INTEGER
+  at b (6:14)
+  called from a (4:3)
+  called from init (2:6)
+`
+	if got := err.StackTrace(); got != want {
+		t.Errorf("wrong stack trace.\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	d := err.Diagnostic()
+	if len(d.Related) != 2 || d.Related[0].Message != "b called from a" || d.Related[1].Range.Start.Line != 2 {
+		t.Errorf("wrong notes %+v", d.Related)
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	// Errors name the block that failed, even if reached by a jump or call.
+	tests := []struct {
+		input string
+		line  int
+		label string
+	}{
+		{"1: goto 2;\n2: goto 3;", 2, "2"},
+		{"1: x := call 2;\n2: y := 1;\n   z := call 3;", 3, "2"},
+	}
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if err.Range.Start.Line != tt.line || err.Label != tt.label {
+			t.Errorf("%q: error at line %d in %s, want line %d in %s", tt.input, err.Range.Start.Line, err.Label, tt.line, tt.label)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/object"
+)
+
+// An Observer is told what a machine does as it runs. The frames it is
+// given are live, and must not be changed.
+type Observer interface {
+	// Statement is called before each statement runs.
+	Statement(f *Frame, stmt ast.Statement)
+	// EnterLabel is called when f starts a block: the first one, the
+	// target of a jump, or the block a call runs.
+	EnterLabel(f *Frame)
+	// Assign is called after a variable of f is set, by an assignment or
+	// by the return of a call.
+	Assign(f *Frame, name string, value object.Object)
+	// Branch is called when an if takes the branch to taken.
+	Branch(f *Frame, stmt *ast.IfStatement, taken *ast.Label)
+	// CallEnter is called when caller pushes the frame callee.
+	CallEnter(caller, callee *Frame)
+	// CallExit is called when callee returns result to its caller.
+	CallExit(callee *Frame, result object.Object)
+	// Primitive is called after a primitive runs, with an *object.Error
+	// as result if it failed.
+	Primitive(name string, args []object.Object, result object.Object)
+}
+
+// BaseObserver ignores everything. Embed it to implement only some of the
+// methods of Observer.
+type BaseObserver struct{}
+
+func (BaseObserver) Statement(*Frame, ast.Statement)                  {}
+func (BaseObserver) EnterLabel(*Frame)                                {}
+func (BaseObserver) Assign(*Frame, string, object.Object)             {}
+func (BaseObserver) Branch(*Frame, *ast.IfStatement, *ast.Label)      {}
+func (BaseObserver) CallEnter(*Frame, *Frame)                         {}
+func (BaseObserver) CallExit(*Frame, object.Object)                   {}
+func (BaseObserver) Primitive(string, []object.Object, object.Object) {}
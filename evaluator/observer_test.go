@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"cogen/ast"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"fmt"
+	"testing"
+)
+
+// recorder writes down every hook it gets.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) add(format string, a ...any) {
+	r.events = append(r.events, fmt.Sprintf(format, a...))
+}
+
+func (r *recorder) Statement(f *Frame, stmt ast.Statement) { r.add("stmt %s", stmt) }
+func (r *recorder) EnterLabel(f *Frame)                    { r.add("enter %s/%d", f.Block.Label.Value, f.Depth) }
+func (r *recorder) Assign(f *Frame, name string, value object.Object) {
+	r.add("assign %s=%s", name, value)
+}
+func (r *recorder) Branch(f *Frame, stmt *ast.IfStatement, taken *ast.Label) {
+	r.add("branch %s", taken.Value)
+}
+func (r *recorder) CallEnter(caller, callee *Frame) {
+	r.add("call %s->%s", caller.Block.Label.Value, callee.Block.Label.Value)
+}
+func (r *recorder) CallExit(callee *Frame, result object.Object) {
+	r.add("exit %s=%s", callee.Block.Label.Value, result)
+}
+func (r *recorder) Primitive(name string, args []object.Object, result object.Object) {
+	r.add("prim %s%v=%s", name, args, result)
+}
+
+func TestObserver(t *testing.T) {
+	input := `1: x := call 2; if x = 1 goto 3 else 3;
+2: return hd('(1 2));
+3: return x;`
+	e := New(parser.New(lexer.New(input)).ParseProgram())
+	r := &recorder{}
+	e.Observer = r
+	testIntegerObject(t, e.Start(object.NewEnvironment()).Run(), 1)
+
+	want := []string{
+		"enter 1/0",
+		"stmt x := call 2",
+		"call 1->2",
+		"enter 2/1",
+		"stmt return hd('(1 2))",
+		"prim hd['(1 2)]=1",
+		"exit 2=1",
+		"assign x=1",
+		"stmt if (x = 1) 3 else 3",
+		"branch 3",
+		"enter 3/0",
+		"stmt return x",
+	}
+	if len(r.events) != len(want) {
+		t.Fatalf("wrong events.\nwant=%q\ngot=%q", want, r.events)
+	}
+	for i := range want {
+		if r.events[i] != want[i] {
+			t.Errorf("event %d wrong. want=%q, got=%q", i, want[i], r.events[i])
+		}
+	}
+}
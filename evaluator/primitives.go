@@ -2,7 +2,11 @@ package evaluator
 
 import (
 	"cogen/object"
+	"cogen/primitives"
+	"fmt"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 func head(arg object.Object) object.Object {
@@ -43,6 +47,31 @@ func cleanIdentifier(s string) string {
 	return result
 }
 
+// labelPart renders one static value as part of a residual label name.
+// Symbols and numbers are used as they are, nested lists (like Q data) use a
+// placeholder to avoid long names, and strings are escaped so different
+// strings give different labels.
+func labelPart(obj object.Object) string {
+	switch v := obj.(type) {
+	case *object.String:
+		var out strings.Builder
+		for _, r := range v.Value {
+			if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				out.WriteRune(r)
+			} else {
+				fmt.Fprintf(&out, "_%x", r)
+			}
+		}
+		return out.String()
+	case object.ValueString:
+		return cleanIdentifier(strings.ReplaceAll(v.GetValue(), " ", "_"))
+	case *object.List:
+		return "data"
+	default:
+		return cleanIdentifier(strings.ReplaceAll(obj.String(), " ", "_"))
+	}
+}
+
 func list(a ...object.Object) object.Object {
 	aCopy := make([]object.Object, len(a))
 	copy(aCopy, a)
@@ -58,6 +87,67 @@ func cons(a object.Object, b object.Object) object.Object {
 	return &object.List{Value: []object.Object{a, b}}
 }
 
+func concat(args ...object.Object) object.Object {
+	var out strings.Builder
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return newError("concat expects strings, got %s as argument %d", arg.Type(), i+1)
+		}
+		out.WriteString(s.Value)
+	}
+	return &object.String{Value: out.String()}
+}
+
+// strlen counts characters, not bytes, to agree with substr.
+func strlen(arg object.Object) object.Object {
+	s, ok := arg.(*object.String)
+	if !ok {
+		return newError("strlen expects string, got %s", arg.Type())
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(s.Value))}
+}
+
+// substr returns the characters of s from start up to, but not including, end.
+func substr(s_obj, start_obj, end_obj object.Object) object.Object {
+	s, ok := s_obj.(*object.String)
+	if !ok {
+		return newError("substr expects first argument to be a string, got %s", s_obj.Type())
+	}
+	start, ok := start_obj.(*object.Integer)
+	if !ok {
+		return newError("substr expects second argument to be an integer, got %s", start_obj.Type())
+	}
+	end, ok := end_obj.(*object.Integer)
+	if !ok {
+		return newError("substr expects third argument to be an integer, got %s", end_obj.Type())
+	}
+	runes := []rune(s.Value)
+	if !start.IsInt64() || !end.IsInt64() {
+		return newError("substr range [%s, %s) out of bounds for string of length %d", start, end, len(runes))
+	}
+	if start.Value < 0 || end.Value < start.Value || end.Value > int64(len(runes)) {
+		return newError("substr range [%d, %d) out of bounds for string of length %d", start.Value, end.Value, len(runes))
+	}
+	return &object.String{Value: string(runes[start.Value:end.Value])}
+}
+
+func symbolToString(arg object.Object) object.Object {
+	s, ok := arg.(*object.Symbol)
+	if !ok {
+		return newError("symbol->string expects symbol, got %s", arg.Type())
+	}
+	return &object.String{Value: s.Value}
+}
+
+func stringToSymbol(arg object.Object) object.Object {
+	s, ok := arg.(*object.String)
+	if !ok {
+		return newError("string->symbol expects string, got %s", arg.Type())
+	}
+	return &object.Symbol{Value: s.Value}
+}
+
 func Gen(a object.Object) object.Object {
 	return a
 }
@@ -200,16 +290,7 @@ func newBlock(code_obj object.Object, name_obj object.Object) object.Object {
 	// For lists (like Q), use "data" as a placeholder to avoid long names
 	name := ""
 	for i, subName := range name_list.Value {
-		var s string
-		if vs, ok := subName.(interface{ GetValue() string }); ok {
-			s = vs.GetValue()
-		} else if _, ok := subName.(*object.List); ok {
-			// For nested lists (like Q data), use a placeholder
-			s = "data"
-		} else {
-			s = subName.String()
-		}
-		s = cleanIdentifier(strings.ReplaceAll(s, " ", "_"))
+		s := labelPart(subName)
 		if i == len(name_list.Value)-1 {
 			name += s
 		} else {
@@ -300,13 +381,13 @@ func isDone(name_obj object.Object, code_obj object.Object) object.Object {
 	return FALSE
 }
 
-func cleanOutput(code_obj object.Object) object.Object {
+func cleanOutput(prims *primitives.Registry, code_obj object.Object) object.Object {
 	code, ok := code_obj.(*object.List)
 	if !ok {
 		return newError("cleanOutput expects second argument (code) to be a list, got %s", code_obj.Type())
 	}
 
-	prog, err := ConvertSExprToAST(code.Value)
+	prog, err := ConvertSExprToASTWith(code.Value, prims)
 	if err != nil {
 		return newError("cleanOutput failed. Got input: %s\n\n Failed with error %s", code_obj.String(), err)
 	}
@@ -314,61 +395,83 @@ func cleanOutput(code_obj object.Object) object.Object {
 	return &object.CodeOutput{Value: prog.String()}
 }
 
+// standard holds the primitives an evaluation may call unless its Options
+// name others. It is never changed; StandardPrimitives hands out copies.
+var standard *primitives.Registry
+
+func init() {
+	// standard holds cleanOutput, which calls ConvertSExprToASTWith, which
+	// falls back on standard, so it cannot be initialized where declared.
+	standard = newStandard()
+}
+
+// StandardPrimitives returns a registry of the primitives of FCL, to which
+// a host program can add its own.
+func StandardPrimitives() *primitives.Registry {
+	return standard.Clone()
+}
+
+// CallPrimitive runs the standard primitive called name on args.
+//
+// Deprecated: use the Call method of a primitives.Registry, such as the
+// one StandardPrimitives returns.
 func CallPrimitive(name string, args []object.Object) object.Object {
-	switch name {
-	case "hd":
-		if len(args) != 1 {
-			return newError("hd takes one input, got %d", len(args))
-		}
-		return head(args[0])
-	case "tl":
-		if len(args) != 1 {
-			return newError("tl takes one input, got %d", len(args))
-		}
-		return tail(args[0])
-	case "o":
-		if len(args) < 2 {
-			return newError("o takes at least 2 inputs, got %d", len(args))
-		}
-		return o(args[0], args[1:]...)
-	case "list":
-		return list(args...)
-	case "cons":
-		if len(args) != 2 {
-			return newError("cons takes two inputs, got %d", len(args))
-		}
-		return cons(args[0], args[1])
-	case "newTail", "new_tail":
-		if len(args) != 2 {
-			return newError("newTail takes two inputs, got %d", len(args))
-		}
-		return newTail(args[0], args[1])
-	case "newHeader", "new_header":
-		if len(args) < 1 {
-			return newError("newHeader takes at least 1 input, got %d", len(args))
-		}
-		return newHeader(args[0], args[1:]...)
-	case "newBlock":
-		if len(args) != 2 {
-			return newError("newBlock takes two inputs, got %d", len(args))
-		}
-		return newBlock(args[0], args[1])
-	case "isDone":
-		if len(args) != 2 {
-			return newError("isDone takes two inputs, got %d", len(args))
-		}
-		return isDone(args[0], args[1])
-	case "cleanOutput":
-		if len(args) != 1 {
-			return newError("cleanOutput expects a single input, got %d", len(args))
-		}
-		return cleanOutput(args[0])
-	case "Gen":
-		if len(args) != 1 {
-			return newError("Gen expects a single input, got %d", len(args))
-		}
-		return Gen(args[0])
-	default:
-		return newError("undefined primitive %s", name)
+	return standard.Call(name, args)
+}
+
+func newStandard() *primitives.Registry {
+	r := primitives.New()
+	for _, p := range []primitives.Primitive{
+		{Name: "hd", Arity: 1, Pure: true, Func: unary(head)},
+		{Name: "tl", Arity: 1, Pure: true, Func: unary(tail)},
+		{Name: "list", Variadic: true, Pure: true, Func: variadic(list)},
+		{Name: "cons", Arity: 2, Pure: true, Func: binary(cons)},
+		{Name: "concat", Variadic: true, Pure: true, Func: variadic(concat)},
+		{Name: "strlen", Arity: 1, Pure: true, Func: unary(strlen)},
+		{Name: "substr", Arity: 3, Pure: true, Func: func(_ *primitives.Registry, args []object.Object) object.Object {
+			return substr(args[0], args[1], args[2])
+		}},
+		{Name: "symbol->string", Arity: 1, Pure: true, Func: unary(symbolToString)},
+		{Name: "string->symbol", Arity: 1, Pure: true, Func: unary(stringToSymbol)},
+		{Name: "newTail", Arity: 2, Pure: true, Func: binary(newTail)},
+		{Name: "new_tail", Arity: 2, Pure: true, Func: binary(newTail)},
+		// The code-building primitives of generating extensions. o and
+		// newBlock add to the code they are given in place.
+		{Name: "o", Arity: 2, Variadic: true, Func: func(_ *primitives.Registry, args []object.Object) object.Object {
+			return o(args[0], args[1:]...)
+		}},
+		{Name: "newHeader", Arity: 1, Variadic: true, Pure: true, Func: func(_ *primitives.Registry, args []object.Object) object.Object {
+			return newHeader(args[0], args[1:]...)
+		}},
+		{Name: "new_header", Arity: 1, Variadic: true, Pure: true, Func: func(_ *primitives.Registry, args []object.Object) object.Object {
+			return newHeader(args[0], args[1:]...)
+		}},
+		{Name: "newBlock", Arity: 2, Func: binary(newBlock)},
+		{Name: "isDone", Arity: 2, Pure: true, Func: binary(isDone)},
+		{Name: "cleanOutput", Arity: 1, Pure: true, Func: func(r *primitives.Registry, args []object.Object) object.Object {
+			return cleanOutput(r, args[0])
+		}},
+		{Name: "Gen", Arity: 1, Pure: true, BindingTime: primitives.Dynamic, Func: unary(Gen)},
+	} {
+		r.MustRegister(p)
+	}
+	return r
+}
+
+func unary(f func(object.Object) object.Object) primitives.Func {
+	return func(_ *primitives.Registry, args []object.Object) object.Object {
+		return f(args[0])
+	}
+}
+
+func binary(f func(object.Object, object.Object) object.Object) primitives.Func {
+	return func(_ *primitives.Registry, args []object.Object) object.Object {
+		return f(args[0], args[1])
+	}
+}
+
+func variadic(f func(...object.Object) object.Object) primitives.Func {
+	return func(_ *primitives.Registry, args []object.Object) object.Object {
+		return f(args...)
 	}
 }
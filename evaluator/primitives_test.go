@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"cogen/diagnostics"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"cogen/primitives"
+	"context"
+	"testing"
+)
+
+// square is a primitive a host program might add.
+func square(_ *primitives.Registry, args []object.Object) object.Object {
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return primitives.Errorf("square expects integer, got %s", args[0].Type())
+	}
+	return Infix("*", n, n)
+}
+
+func TestPrimitivesOption(t *testing.T) {
+	withSquare := StandardPrimitives()
+	withSquare.MustRegister(primitives.Primitive{Name: "square", Arity: 1, Pure: true, Func: square})
+	listsOnly, err := withSquare.Restrict("hd", "tl", "cons")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		prims    *primitives.Registry
+		expected string
+		code     diagnostics.Code
+	}{
+		{"standard", "1: return strlen(\"abc\");", nil, "3", ""},
+		{"host", "1: return cons(square(12), square(-3));", withSquare, "'(144 9)", ""},
+		{"host error", "1: return square('a);", withSquare, "ERROR: square expects integer, got SYMBOL", diagnostics.RuntimeError},
+		{"arity", "1: return square(1, 2);", withSquare, "ERROR: square takes one input, got 2", diagnostics.PrimitiveArity},
+		{"not added", "1: return square(2);", nil, "ERROR: undefined primitive square", diagnostics.UndefinedPrimitive},
+		{"restricted", "1: return hd(tl(cons(1, '(2))));", listsOnly, "2", ""},
+		{"left out", "1: return strlen(\"abc\");", listsOnly, "ERROR: undefined primitive strlen", diagnostics.UndefinedPrimitive},
+	}
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		got := Eval(context.Background(), program, object.NewEnvironment(), Options{Primitives: tt.prims})
+		if got.String() != tt.expected {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.expected)
+			continue
+		}
+		if errObj, ok := got.(*object.Error); ok {
+			if errObj.Code != tt.code {
+				t.Errorf("%s: got code %s, want %s", tt.name, errObj.Code, tt.code)
+			}
+			if errObj.Range.IsZero() {
+				t.Errorf("%s: expected the error to point at the program", tt.name)
+			}
+		}
+	}
+}
+
+func TestStandardPrimitivesCopies(t *testing.T) {
+	StandardPrimitives().MustRegister(primitives.Primitive{Name: "square", Arity: 1, Func: square})
+	if _, ok := StandardPrimitives().Lookup("square"); ok {
+		t.Error("registering in StandardPrimitives changed the standard set")
+	}
+}
+
+func TestCallPrimitive(t *testing.T) {
+	got := CallPrimitive("cons", []object.Object{&object.Integer{Value: 1}, &object.List{}})
+	if got.String() != "'(1)" {
+		t.Errorf("got %s, want '(1)", got)
+	}
+	if got := CallPrimitive("square", nil); got.String() != "ERROR: undefined primitive square" {
+		t.Errorf("got %s", got)
+	}
+}
+
+// TestConvertHostPrimitive checks that code read back from lists knows the
+// primitives it was given, and only those.
+func TestConvertHostPrimitive(t *testing.T) {
+	code := &object.List{Value: []object.Object{
+		&object.List{Value: []object.Object{&object.Symbol{Value: "f"}, &object.Symbol{Value: "x"}}},
+		&object.List{Value: []object.Object{
+			&object.Symbol{Value: "l1"},
+			&object.List{Value: []object.Object{
+				&object.Symbol{Value: "return"},
+				&object.List{Value: []object.Object{&object.Symbol{Value: "square"}, &object.Symbol{Value: "x"}}},
+			}},
+		}},
+	}}
+	prims := StandardPrimitives()
+	prims.MustRegister(primitives.Primitive{Name: "square", Arity: 1, Pure: true, Func: square})
+	tests := []struct {
+		prims *primitives.Registry
+		want  string
+	}{
+		{prims, "square(x)"},
+		{nil, "'(square x)"},
+	}
+	for _, tt := range tests {
+		prog, err := ConvertSExprToASTWith([]object.Object{code}, tt.prims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := prog.Statements[0].Statements[0].String(); got != "return "+tt.want {
+			t.Errorf("got %q, want %q", got, "return "+tt.want)
+		}
+	}
+}
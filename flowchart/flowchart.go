@@ -0,0 +1,156 @@
+// Package flowchart draws the control flow graph of an FCL program as a
+// Graphviz DOT or Mermaid diagram. Each block is a box holding its label
+// and statements. The two edges of an if are labelled true and false, and
+// calls are dashed.
+package flowchart
+
+import (
+	"cogen/cfg"
+	"cogen/generator"
+	"fmt"
+	"strings"
+)
+
+// Options changes how a chart is drawn.
+type Options struct {
+	// BindingTimes colours blocks by when they run, keyed by label, as
+	// generator.BindingTimes returns them. Blocks not in it are not
+	// coloured.
+	BindingTimes map[string]generator.BindingTime
+}
+
+var colours = map[generator.BindingTime]string{
+	generator.Static:  "#cfe2f3",
+	generator.Dynamic: "#fce5cd",
+}
+
+// lines returns the label and statements of b, one per line.
+func lines(b *cfg.Block) []string {
+	if b.IsExit() {
+		return []string{b.Name}
+	}
+	out := []string{b.Name + ":"}
+	for _, stmt := range b.Node.Statements {
+		out = append(out, stmt.String())
+	}
+	return out
+}
+
+// shown returns the blocks to draw: the exit only if something reaches it.
+func shown(g *cfg.Graph) []*cfg.Block {
+	blocks := g.Blocks
+	if len(g.Exit.Preds) == 0 {
+		blocks = blocks[:len(blocks)-1]
+	}
+	return blocks
+}
+
+func id(b *cfg.Block) string {
+	return fmt.Sprintf("b%d", b.Index)
+}
+
+// DOT returns g as a Graphviz digraph.
+func DOT(g *cfg.Graph, opts Options) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "digraph %s {\n", dotQuote(g.Program.Name))
+	out.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	for _, b := range shown(g) {
+		var label strings.Builder
+		for _, line := range lines(b) {
+			label.WriteString(dotEscape(line) + `\l`)
+		}
+		attrs := []string{`label="` + label.String() + `"`}
+		if b.IsExit() {
+			attrs = []string{`label="exit"`, "shape=oval"}
+		}
+		if b == g.Entry {
+			attrs = append(attrs, "penwidth=2")
+		}
+		if bt, ok := opts.BindingTimes[b.Name]; ok && !b.IsExit() {
+			attrs = append(attrs, "style=filled", `fillcolor="`+colours[bt]+`"`)
+		}
+		fmt.Fprintf(&out, "\t%s [%s];\n", id(b), strings.Join(attrs, ", "))
+	}
+
+	for _, b := range shown(g) {
+		for _, e := range b.Succs {
+			var attrs []string
+			switch e.Kind {
+			case cfg.True, cfg.False:
+				attrs = append(attrs, `label="`+e.Kind.String()+`"`)
+			case cfg.Call:
+				attrs = append(attrs, `label="call"`, "style=dashed")
+			}
+			if len(attrs) == 0 {
+				fmt.Fprintf(&out, "\t%s -> %s;\n", id(e.From), id(e.To))
+			} else {
+				fmt.Fprintf(&out, "\t%s -> %s [%s];\n", id(e.From), id(e.To), strings.Join(attrs, ", "))
+			}
+		}
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+// Mermaid returns g as a Mermaid flowchart, read from the top down.
+func Mermaid(g *cfg.Graph, opts Options) string {
+	var out strings.Builder
+	out.WriteString("flowchart TD\n")
+
+	for _, b := range shown(g) {
+		var text []string
+		for _, line := range lines(b) {
+			text = append(text, mermaidEscape(line))
+		}
+		if b.IsExit() {
+			fmt.Fprintf(&out, "\t%s([\"exit\"])\n", id(b))
+		} else {
+			fmt.Fprintf(&out, "\t%s[\"%s\"]\n", id(b), strings.Join(text, "<br/>"))
+		}
+	}
+
+	for _, b := range shown(g) {
+		for _, e := range b.Succs {
+			arrow := "-->"
+			switch e.Kind {
+			case cfg.True, cfg.False:
+				arrow = "-->|" + e.Kind.String() + "|"
+			case cfg.Call:
+				arrow = "-.->|call|"
+			}
+			fmt.Fprintf(&out, "\t%s %s %s\n", id(e.From), arrow, id(e.To))
+		}
+	}
+
+	if len(opts.BindingTimes) > 0 {
+		classes := map[generator.BindingTime][]string{}
+		for _, b := range shown(g) {
+			if bt, ok := opts.BindingTimes[b.Name]; ok && !b.IsExit() {
+				classes[bt] = append(classes[bt], id(b))
+			}
+		}
+		for _, bt := range []generator.BindingTime{generator.Static, generator.Dynamic} {
+			if len(classes[bt]) == 0 {
+				continue
+			}
+			fmt.Fprintf(&out, "\tclassDef %s fill:%s\n", bt, colours[bt])
+			fmt.Fprintf(&out, "\tclass %s %s\n", strings.Join(classes[bt], ","), bt)
+		}
+	}
+	return out.String()
+}
+
+// mermaidEscape replaces the characters Mermaid reads as markup in a
+// quoted label with entity codes.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
@@ -0,0 +1,87 @@
+package flowchart_test
+
+import (
+	"cogen/cfg"
+	"cogen/flowchart"
+	"cogen/generator"
+	"cogen/lexer"
+	"cogen/parser"
+	"strings"
+	"testing"
+)
+
+func build(t *testing.T, input string) *cfg.Graph {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	return cfg.New(program)
+}
+
+const input = `f(n);
+a: if n < 1 goto b else c;
+b: x := call c; return "say \"hi\"";
+c: n := n - 1; goto a;`
+
+func TestDOT(t *testing.T) {
+	got := flowchart.DOT(build(t, input), flowchart.Options{})
+
+	for _, want := range []string{
+		`digraph "f" {`,
+		`b0 [label="a:\lif (n < 1) b else c\l", penwidth=2];`,
+		`b1 [label="b:\lx := call c\lreturn \"say \\\"hi\\\"\"\l"];`,
+		`b3 [label="exit", shape=oval];`,
+		`b0 -> b1 [label="true"];`,
+		`b0 -> b2 [label="false"];`,
+		`b1 -> b2 [label="call", style=dashed];`,
+		`b1 -> b3;`,
+		`b2 -> b0;`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	got := flowchart.Mermaid(build(t, input), flowchart.Options{})
+
+	for _, want := range []string{
+		"flowchart TD\n",
+		`b0["a:<br/>if (n #lt; 1) b else c"]`,
+		`b1["b:<br/>x := call c<br/>return #quot;say \#quot;hi\#quot;#quot;"]`,
+		`b3(["exit"])`,
+		"b0 -->|true| b1",
+		"b0 -->|false| b2",
+		"b1 -.->|call| b2",
+		"b2 --> b0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestBindingTimes(t *testing.T) {
+	g := build(t, `f(n);
+a: code := newHeader(list('f), 'n); goto b;
+b: code := o(code, list('return, 'n)); return code;`)
+	opts := flowchart.Options{BindingTimes: generator.BindingTimes(g.Program)}
+
+	dot := flowchart.DOT(g, opts)
+	if !strings.Contains(dot, `b0 [label="a:\lcode := newHeader(list('f), 'n)\lgoto b\l", penwidth=2, style=filled, fillcolor="#cfe2f3"];`) {
+		t.Errorf("expected a to be static in\n%s", dot)
+	}
+	if !strings.Contains(dot, `b1 [label="b:\lcode := o(code, list('return, 'n))\lreturn code\l", style=filled, fillcolor="#fce5cd"];`) {
+		t.Errorf("expected b to be dynamic in\n%s", dot)
+	}
+
+	mermaid := flowchart.Mermaid(g, opts)
+	for _, want := range []string{"class b0 static", "class b1 dynamic"} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("expected %q in\n%s", want, mermaid)
+		}
+	}
+}
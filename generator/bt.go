@@ -0,0 +1,77 @@
+package generator
+
+import "cogen/ast"
+
+// BindingTime says when a block runs: while the generating extension
+// specializes (Static), or in the residual program (Dynamic).
+type BindingTime int
+
+const (
+	Static BindingTime = iota
+	Dynamic
+)
+
+func (bt BindingTime) String() string {
+	if bt == Static {
+		return "static"
+	}
+	return "dynamic"
+}
+
+// BindingTimes classifies the blocks of program by label. In a generating
+// extension built by Gen, a block is Dynamic if it adds residual code with
+// o and Static if it only computes. Any other program, a residual one
+// included, runs all its blocks at run time.
+func BindingTimes(program *ast.Program) map[string]BindingTime {
+	times := map[string]BindingTime{}
+	ext := isExtension(program)
+	for _, block := range program.Statements {
+		bt := Dynamic
+		if ext && !emitsCode(block) {
+			bt = Static
+		}
+		if _, ok := times[block.Label.Value]; !ok {
+			times[block.Label.Value] = bt
+		}
+	}
+	return times
+}
+
+// isExtension reports whether program starts its residual code with
+// newHeader, as the header blocks of Gen do.
+func isExtension(program *ast.Program) bool {
+	for _, block := range program.Statements {
+		for _, stmt := range block.Statements {
+			if as, ok := stmt.(*ast.AssignmentStatement); ok && as.Left.Value == "code" && isPrimitive(as.Right, "newHeader") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emitsCode reports whether block adds to the residual code.
+func emitsCode(block *ast.LabelStatement) bool {
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			if s.Left.Value == "code" && isPrimitive(s.Right, "o") {
+				return true
+			}
+		case *ast.ReturnStatement:
+			if isPrimitive(s.ReturnValue, "o") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isPrimitive(exp ast.Expression, name string) bool {
+	call, ok := exp.(*ast.PrimitiveCall)
+	if !ok {
+		return false
+	}
+	id, ok := call.Primitive.(*ast.Identifier)
+	return ok && id.Value == name
+}
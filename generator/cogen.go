@@ -2,11 +2,15 @@ package generator
 
 import (
 	"cogen/ast"
+	"cogen/cfg"
+	"cogen/dataflow"
+	"cogen/diagnostics"
+	"cogen/evaluator"
 	"cogen/parser"
+	"cogen/primitives"
 	"cogen/token"
 	"errors"
 	"fmt"
-	"log"
 	"maps"
 	"sort"
 	"strconv"
@@ -21,8 +25,18 @@ type State struct {
 type Cogen struct {
 	state           *State
 	OriginalProgram *ast.Program
+	graph           *cfg.Graph
+	liveness        *dataflow.Result[dataflow.VarSet]
 	dynamicVar      []ast.Expression
 	parser          *parser.Parser
+	// Primitives are the primitives the program may call; nil means the
+	// standard ones. Each says whether a call to it with static inputs runs
+	// in the generating extension or is left in the residual program.
+	Primitives *primitives.Registry
+	prims      *primitives.Registry
+	// origin is the token of the original statement being processed. Nodes
+	// added to the extension inherit its position.
+	origin token.Token
 }
 
 func New(p *parser.Parser) *Cogen {
@@ -31,21 +45,53 @@ func New(p *parser.Parser) *Cogen {
 	}
 }
 
-func (c *Cogen) Gen(delta []int) (*ast.Program, error) {
+// Gen builds the generating extension of the parsed program, treating the
+// parameters at the indices in delta as static. Errors are returned as a
+// *diagnostics.List.
+func (c *Cogen) Gen(delta []int) (ext *ast.Program, err error) {
 	// Parse program and check for errors
 	c.OriginalProgram = c.parser.ParseProgram()
 
-	if len(c.parser.Errors()) != 0 {
-		return nil, errors.New(c.parser.GetErrorMessage())
+	if err := c.parser.Err(); err != nil {
+		return nil, err
 	}
+	c.graph = cfg.New(c.OriginalProgram)
+	c.prims = c.Primitives
+	if c.prims == nil {
+		c.prims = evaluator.StandardPrimitives()
+	}
+	c.liveness = dataflow.Liveness(c.graph)
+
+	// Generation errors are raised with fail deep inside the recursion and
+	// turned into a returned error here.
+	defer func() {
+		if r := recover(); r != nil {
+			d, ok := r.(diagnostics.Diagnostic)
+			if !ok {
+				panic(r)
+			}
+			ext = nil
+			err = &diagnostics.List{Source: c.parser.Source(), Diagnostics: []diagnostics.Diagnostic{d}}
+		}
+	}()
+
+	if len(c.OriginalProgram.Statements) == 0 {
+		c.fail(diagnostics.GeneratorError, token.Token{}, "program has no labels")
+	}
+
 	// Note the first var as static
 	c.state = &State{}
 	c.state.delta = make(map[string]*ast.Identifier, len(delta))
 	vars := make([]ast.Input, len(delta))
 	for i, delt := range delta {
+		if delt < 0 || delt >= len(c.OriginalProgram.Variables) {
+			c.fail(diagnostics.InvalidStaticArgs, token.Token{},
+				"static parameter index %d out of range, program %s has %d parameters",
+				delt, c.OriginalProgram.Name, len(c.OriginalProgram.Variables))
+		}
 		cpy := c.OriginalProgram.Variables[delt]
 		c.addDelta(cpy.Ident)
-		vars[i] = cpy
+		vars[i] = ast.Input{Ident: ast.Clone(cpy.Ident), Value: cpy.Value}
 	}
 	c.state.extension = &ast.Program{
 		Name:      c.OriginalProgram.Name,
@@ -60,6 +106,29 @@ func (c *Cogen) Gen(delta []int) (*ast.Program, error) {
 	return c.state.extension, nil
 }
 
+// fail aborts generation with a diagnostic pointing at tok. It is recovered
+// in Gen.
+func (c *Cogen) fail(code diagnostics.Code, tok token.Token, format string, a ...any) {
+	panic(diagnostics.New(code, tok, format, a...))
+}
+
+// stmtToken returns the token a diagnostic about stmt should point at.
+func stmtToken(stmt ast.Statement) token.Token {
+	switch v := stmt.(type) {
+	case *ast.AssignmentStatement:
+		return v.Left.Token
+	case *ast.IfStatement:
+		return v.Token
+	case *ast.GotoStatement:
+		return v.Token
+	case *ast.ReturnStatement:
+		return v.Token
+	case *ast.ExpressionStatement:
+		return v.Token
+	}
+	return token.Token{}
+}
+
 func (c *Cogen) saveState() *State {
 	delta := make(map[string]*ast.Identifier)
 	maps.Copy(delta, c.state.delta)
@@ -199,6 +268,10 @@ func (c *Cogen) processHeader() {
 		},
 	}
 
+	// The header blocks are derived from the program's entry label
+	for _, l := range []*ast.LabelStatement{initLabel, newheaderLabel, twoLabel} {
+		ast.Inherit(l, initialLabel.Token)
+	}
 	c.state.extension.Statements = append(
 		c.state.extension.Statements,
 		initLabel,
@@ -247,7 +320,7 @@ func (c *Cogen) labelUplift(label string) ast.Expression {
 func (c *Cogen) exprUplift(exp ast.Expression) ast.Expression {
 	switch v := exp.(type) {
 	case *ast.CallExpression:
-		log.Fatal("exprup: how is this call expression?")
+		c.fail(diagnostics.UnsupportedCall, v.Token, "call %s can only be used as the right-hand side of an assignment", v.Label.Value)
 	case *ast.Identifier:
 		if c.existsDelta(v) {
 			return &ast.PrimitiveCall{
@@ -258,7 +331,7 @@ func (c *Cogen) exprUplift(exp ast.Expression) ast.Expression {
 						Token: newToken(token.CONSTANT, "'"),
 						Value: newSymbol("quote"),
 					},
-					v,
+					ast.Clone(v),
 				},
 			}
 		} else {
@@ -307,22 +380,29 @@ func (c *Cogen) exprUplift(exp ast.Expression) ast.Expression {
 			Arguments: arguments,
 		}
 	case *ast.Constant:
-			return &ast.PrimitiveCall{
-				Token:     newToken(token.LPAREN, "("),
-				Primitive: newIdentifier("list"),
-				Arguments: []ast.Expression{
-					&ast.Constant{
-						Token: newToken(token.CONSTANT, "'"),
-						Value: newSymbol("quote"),
-					},
-					v,
+		return &ast.PrimitiveCall{
+			Token:     newToken(token.LPAREN, "("),
+			Primitive: newIdentifier("list"),
+			Arguments: []ast.Expression{
+				&ast.Constant{
+					Token: newToken(token.CONSTANT, "'"),
+					Value: newSymbol("quote"),
 				},
-			}
-		
-	// TODO: We are hitting this case, which we should not.
+				ast.Clone(v),
+			},
+		}
+
+	// Literals evaluate to themselves, so the residual code can hold them as is.
+	case *ast.IntegerLiteral, *ast.BooleanLiteral, *ast.StringLiteral:
+		return ast.Clone(v)
+
+	// Lists and symbols are only data, the parser keeps them inside a Constant.
+	case *ast.List:
+		c.fail(diagnostics.GeneratorError, v.Token, "list %s outside of a quoted constant", v.String())
+	case *ast.SymbolExpression:
+		c.fail(diagnostics.GeneratorError, v.Token, "symbol %s outside of a quoted constant", v.String())
 	default:
-		fmt.Printf("Default: type=%T, %s\n", exp, exp.String())
-		return v
+		c.fail(diagnostics.GeneratorError, token.Token{}, "cannot lift %T %s into residual code", v, v.String())
 	}
 	return nil
 }
@@ -332,12 +412,13 @@ func (c *Cogen) processBlock(stmt *ast.LabelStatement) *ast.LabelStatement {
 	if c.existsLabel(&l.Label) {
 		l, err := c.getCurLabelStatement(&l.Label)
 		if err != nil {
-			log.Fatalf("block: %v", err)
+			c.fail(diagnostics.MissingLabel, stmt.Label.Token, "block: %v", err)
 		}
 		return l
 	}
 
 	// add new label, and attempt to processBody
+	ast.Inherit(l, stmt.Label.Token)
 	c.state.extension.Statements = append(c.state.extension.Statements, l)
 	c.state.curStatement = l
 	c.processBody(stmt.Statements)
@@ -350,7 +431,7 @@ func (c *Cogen) processPoly(stmt *ast.LabelStatement) *ast.LabelStatement {
 	if c.existsLabel(&l1.Label) {
 		l, err := c.getCurLabelStatement(&l1.Label)
 		if err != nil {
-			log.Fatalf("block: %v", err)
+			c.fail(diagnostics.MissingLabel, stmt.Label.Token, "block: %v", err)
 		}
 		return l
 	}
@@ -402,19 +483,24 @@ func (c *Cogen) processPoly(stmt *ast.LabelStatement) *ast.LabelStatement {
 			Label: l4.Label,
 		},
 	}
+	ast.Inherit(l1, stmt.Label.Token)
+	ast.Inherit(l3, stmt.Label.Token)
 	c.state.extension.Statements = append(c.state.extension.Statements, l1, l3)
 	return l1
 }
 
 func (c *Cogen) processBody(stmts []ast.Statement) {
+	prevOrigin := c.origin
+	defer func() { c.origin = prevOrigin }()
 	for i, stmt := range stmts {
+		c.origin = stmtToken(stmt)
 		switch v := stmt.(type) {
 		case *ast.AssignmentStatement:
 			c.processAssginment(v)
 		default:
 			c.processJump(v)
 			if i != len(stmts)-1 {
-				log.Fatalf("expected last statement to be jump, got %T", v)
+				c.fail(diagnostics.ExpectedJump, stmtToken(v), "expected last statement to be jump, got %T", v)
 			}
 		}
 	}
@@ -429,7 +515,7 @@ func (c *Cogen) processJump(stmt ast.Statement) {
 	case *ast.GotoStatement:
 		c.processGoto(v)
 	default:
-		log.Fatalf("expected jump, got %s", v.String())
+		c.fail(diagnostics.ExpectedJump, stmtToken(v), "expected jump, got %s", v.String())
 	}
 }
 
@@ -445,6 +531,7 @@ func (c *Cogen) copyBlock(stmt *ast.LabelStatement) *ast.Label {
 	}
 
 	// Then we add the statement
+	ast.Inherit(newStmt, stmt.Label.Token)
 	c.state.extension.Statements = append(c.state.extension.Statements, newStmt)
 
 	// Otherwise, copy it over
@@ -453,7 +540,7 @@ func (c *Cogen) copyBlock(stmt *ast.LabelStatement) *ast.Label {
 		case *ast.IfStatement:
 			ifStmt := ast.IfStatement{
 				Token:      v.Token,
-				Cond:       v.Cond,
+				Cond:       ast.Clone(v.Cond),
 				LabelTrue:  *c.copyBlocks(&v.LabelTrue),
 				LabelFalse: *c.copyBlocks(&v.LabelFalse),
 			}
@@ -469,7 +556,7 @@ func (c *Cogen) copyBlock(stmt *ast.LabelStatement) *ast.Label {
 		case *ast.AssignmentStatement:
 			prevCallExp, ok := v.Right.(*ast.CallExpression)
 			if !ok {
-				newStmt.Statements[i] = v
+				newStmt.Statements[i] = ast.Clone(v)
 				continue
 			}
 			callExp := ast.CallExpression{
@@ -478,14 +565,14 @@ func (c *Cogen) copyBlock(stmt *ast.LabelStatement) *ast.Label {
 			}
 
 			assignStmt := ast.AssignmentStatement{
-				Left:  v.Left,
+				Left:  ast.Clone(v.Left),
 				Token: v.Token,
 				Right: &callExp,
 			}
 			newStmt.Statements[i] = &assignStmt
 
 		default:
-			newStmt.Statements[i] = v
+			newStmt.Statements[i] = ast.Clone(v)
 		}
 	}
 
@@ -499,12 +586,13 @@ func (c *Cogen) copyBlocks(label *ast.Label) *ast.Label {
 			return l
 		}
 	}
-	log.Fatalf("expected to have a label %s, got none", label.Value)
+	c.fail(diagnostics.MissingLabel, label.Token, "expected to have a label %s, got none", label.Value)
 	// not reached
 	return nil
 }
 
 func (c *Cogen) addStatement(stmt ast.Statement) {
+	ast.Inherit(stmt, c.origin)
 	c.state.curStatement.Statements = append(c.state.curStatement.Statements, stmt)
 }
 
@@ -512,35 +600,17 @@ func (c *Cogen) processAssginment(stmt *ast.AssignmentStatement) {
 	switch expr := stmt.Right.(type) {
 	case *ast.CallExpression:
 		c.processCallAssginment(stmt, expr)
-	case *ast.PrimitiveCall:
-		if (expr.Primitive.String() == "Gen") {
-			upliftE := c.exprUplift(stmt.Right)
-			code := newIdentifier("code")
-			o := newIdentifier("o")
-			leftCpy := *stmt.Left
-			c.addStatement(codeAssign(
-				&ast.PrimitiveCall{
-					Token:     o.Token,
-					Primitive: o,
-					Arguments: []ast.Expression{code, underlineAssign(&leftCpy, upliftE)},
-				}))
-			c.removeDelta(stmt.Left)
-		} else {
-			c.processRegularAssginment(stmt)
-		}
 	default:
 		c.processRegularAssginment(stmt)
 	}
 }
 
 func (c *Cogen) processRegularAssginment(stmt *ast.AssignmentStatement) {
-	vars := getVars(stmt.Right)
-
-	if c.isSubsetDelta(vars) {
+	if c.isStatic(stmt.Right) {
 		c.addStatement(&ast.AssignmentStatement{
 			Left:  newIdentifier(stmt.Left.Value),
 			Token: newToken(token.ASSIGN, ":="),
-			Right: stmt.Right,
+			Right: ast.Clone(stmt.Right),
 		})
 		c.addDelta(stmt.Left)
 	} else {
@@ -558,114 +628,18 @@ func (c *Cogen) processRegularAssginment(stmt *ast.AssignmentStatement) {
 	}
 }
 
-func UniqueBy[T any, K comparable](input []T, keySelector func(T) K) []T {
-	seen := make(map[K]struct{})
-	result := make([]T, 0, len(input)) // Pre-allocate capacity for efficiency
-
-	for _, item := range input {
-		key := keySelector(item)
-		// If the key is not in the map, it's unique
-		if _, ok := seen[key]; !ok {
-			seen[key] = struct{}{} // Mark as seen
-			result = append(result, item)
-		}
+// live returns the variables live at the start of the block a call to
+// label runs.
+func (c *Cogen) live(label *ast.Label) []*ast.Identifier {
+	vars, ok := c.liveness.AtLabel(label.Value)
+	if !ok {
+		return nil
 	}
-	return result
-}
-
-func uniqueLiterals(idens []*ast.Identifier) []*ast.Identifier {
-	return UniqueBy(idens, func(i *ast.Identifier) string {
-		return i.Token.Literal
-	})
-}
-
-func (c *Cogen) live(exp ast.Node) []*ast.Identifier {
-	// 1. Initialize the visited map to prevent infinite recursion
-	visited := make(map[string]struct{})
-
-	// 2. Call the recursive helper
-	return uniqueLiterals(c.liveRecursive(exp, []*ast.Identifier{}, visited))
-}
-
-// liveRecursive carries the 'visited' state to track control flow cycles
-func (c *Cogen) liveRecursive(exp ast.Node, cur_live []*ast.Identifier, visited map[string]struct{}) []*ast.Identifier {
-	if exp == nil {
-		return cur_live
+	ids := []*ast.Identifier{}
+	for _, name := range vars.Sorted() {
+		ids = append(ids, newIdentifier(name))
 	}
-
-	switch node := exp.(type) {
-
-	case *ast.Identifier:
-		return append(cur_live, node)
-	case *ast.IntegerLiteral, *ast.BooleanLiteral, *ast.SymbolExpression:
-		return cur_live
-
-	case *ast.PrefixExpression:
-		return c.liveRecursive(node.Right, cur_live, visited)
-
-	case *ast.InfixExpression:
-		tmp := c.liveRecursive(node.Left, cur_live, visited)
-		return c.liveRecursive(node.Right, tmp, visited)
-
-	case *ast.PrimitiveCall:
-		tmp := c.liveRecursive(node.Primitive, cur_live, visited)
-		for _, arg := range node.Arguments {
-			tmp = c.liveRecursive(arg, tmp, visited)
-		}
-		return tmp
-
-	case *ast.List:
-		tmp := cur_live
-		for _, expr := range node.Value {
-			tmp = c.liveRecursive(expr, tmp, visited)
-		}
-		return tmp
-
-	case *ast.Constant:
-		return c.liveRecursive(node.Value, cur_live, visited)
-
-	case *ast.ExpressionStatement:
-		return c.liveRecursive(node.Expression, cur_live, visited)
-
-	case *ast.AssignmentStatement:
-		return c.liveRecursive(node.Right, cur_live, visited)
-
-	case *ast.ReturnStatement:
-		return c.liveRecursive(node.ReturnValue, cur_live, visited)
-
-	case *ast.LabelStatement:
-		tmp := cur_live
-		for _, stmt := range node.Statements {
-			tmp = c.liveRecursive(stmt, tmp, visited)
-		}
-		return tmp
-
-	case *ast.GotoStatement:
-		return c.liveRecursive(&node.Label, cur_live, visited)
-
-	case *ast.CallExpression:
-		return c.liveRecursive(&node.Label, cur_live, visited)
-
-	case *ast.IfStatement:
-		tmp := c.liveRecursive(node.Cond, cur_live, visited)
-		tmp = c.liveRecursive(&node.LabelTrue, tmp, visited)
-		return c.liveRecursive(&node.LabelFalse, tmp, visited)
-
-	case *ast.Label:
-		if _, seen := visited[node.Value]; seen {
-			return cur_live
-		}
-
-		visited[node.Value] = struct{}{}
-
-		targetBlock, err := c.getOrigLabelStatement(node)
-		if err != nil {
-			return cur_live
-		}
-		return c.liveRecursive(targetBlock, cur_live, visited)
-	}
-
-	return cur_live
+	return ids
 }
 
 func (c *Cogen) processCallAssginment(
@@ -673,7 +647,7 @@ func (c *Cogen) processCallAssginment(
 	callExp *ast.CallExpression,
 ) {
 	// live exp
-	if c.isSubsetDelta(c.live(callExp)) {
+	if c.isSubsetDelta(c.live(&callExp.Label)) {
 		leftCpy := *stmt.Left
 		c.addStatement(
 			&ast.AssignmentStatement{
@@ -690,7 +664,7 @@ func (c *Cogen) processCallAssginment(
 		// first process poly on the label
 		callStmt, err := c.getOrigLabelStatement(&callExp.Label)
 		if err != nil {
-			log.Fatalf("call assignment: %v", err)
+			c.fail(diagnostics.MissingLabel, callExp.Label.Token, "call assignment: %v", err)
 		}
 		curState := c.saveState()
 		c.processPoly(callStmt)
@@ -740,18 +714,17 @@ func (c *Cogen) getCurLabelStatement(stmt *ast.Label) (*ast.LabelStatement, erro
 }
 
 func (c *Cogen) processIf(stmt *ast.IfStatement) {
-	variables := getVars(stmt.Cond)
-	if c.isSubsetDelta(variables) {
+	if c.isStatic(stmt.Cond) {
 		newStmt := &ast.IfStatement{
 			Token: stmt.Token,
-			Cond:  stmt.Cond,
+			Cond:  ast.Clone(stmt.Cond),
 		}
 		c.addStatement(newStmt)
 		curState := c.saveState()
 		// process true label statement
 		subStmt, err := c.getOrigLabelStatement(&stmt.LabelTrue)
 		if err != nil {
-			log.Fatalf("if statement: %v", err)
+			c.fail(diagnostics.MissingLabel, stmt.LabelTrue.Token, "if statement: %v", err)
 		}
 		l1 := c.processBlock(subStmt)
 
@@ -761,7 +734,7 @@ func (c *Cogen) processIf(stmt *ast.IfStatement) {
 		// process false label statement
 		subStmt, err = c.getOrigLabelStatement(&stmt.LabelFalse)
 		if err != nil {
-			log.Fatalf("if statement: %v", err)
+			c.fail(diagnostics.MissingLabel, stmt.LabelFalse.Token, "if statement: %v", err)
 		}
 		l2 := c.processBlock(subStmt)
 
@@ -777,7 +750,7 @@ func (c *Cogen) processIf(stmt *ast.IfStatement) {
 		curState := c.saveState()
 		l1, err := c.getOrigLabelStatement(&stmt.LabelTrue)
 		if err != nil {
-			log.Fatalf("if statement: %v", err)
+			c.fail(diagnostics.MissingLabel, stmt.LabelTrue.Token, "if statement: %v", err)
 		}
 		l1 = c.processPoly(l1)
 
@@ -785,7 +758,7 @@ func (c *Cogen) processIf(stmt *ast.IfStatement) {
 		curState = c.saveState()
 		l2, err := c.getOrigLabelStatement(&stmt.LabelFalse)
 		if err != nil {
-			log.Fatalf("if statement: %v", err)
+			c.fail(diagnostics.MissingLabel, stmt.LabelFalse.Token, "if statement: %v", err)
 		}
 		l2 = c.processPoly(l2)
 
@@ -826,10 +799,9 @@ func (c *Cogen) processIf(stmt *ast.IfStatement) {
 }
 
 func (c *Cogen) processReturn(stmt *ast.ReturnStatement) {
-	vars := getVars(stmt.ReturnValue)
 	var rv ast.Expression
-	if c.isSubsetDelta(vars) {
-		rv = underlineReturn(stmt.ReturnValue)
+	if c.isStatic(stmt.ReturnValue) {
+		rv = underlineReturn(ast.Clone(stmt.ReturnValue))
 	} else {
 		eu := c.exprUplift(stmt.ReturnValue)
 		rv = underlineReturn(eu)
@@ -849,13 +821,36 @@ func (c *Cogen) processReturn(stmt *ast.ReturnStatement) {
 func (c *Cogen) processGoto(stmt *ast.GotoStatement) {
 	ogStmt, err := c.getOrigLabelStatement(&stmt.Label)
 	if err != nil {
-		log.Fatalf("goto: %v", err)
+		c.fail(diagnostics.MissingLabel, stmt.Label.Token, "goto: %v", err)
 	}
 	curState := c.saveState()
 	c.processBody(ogStmt.Statements)
 	c.state = curState
 }
 
+// isStatic reports whether the generating extension can compute exp: it
+// reads only static variables and calls no primitive that must be left in
+// the residual program.
+func (c *Cogen) isStatic(exp ast.Expression) bool {
+	return c.isSubsetDelta(getVars(exp)) && !c.callsResidual(exp)
+}
+
+// callsResidual reports whether exp calls a primitive that is Residual.
+// A primitive missing from the registry follows its inputs, as a Static
+// one does.
+func (c *Cogen) callsResidual(exp ast.Expression) bool {
+	residual := false
+	ast.Inspect(exp, func(n ast.Node) bool {
+		if call, ok := n.(*ast.PrimitiveCall); ok {
+			if p, ok := c.prims.Lookup(call.Primitive.String()); ok && p.Residual() {
+				residual = true
+			}
+		}
+		return true
+	})
+	return residual
+}
+
 func (c *Cogen) isSubsetDelta(vars []*ast.Identifier) bool {
 	for _, value := range vars {
 		if !c.existsDelta(value) {
@@ -1001,34 +996,18 @@ func underlineReturn(e ast.Expression) ast.Expression {
 
 func getVars(exp ast.Expression) []*ast.Identifier {
 	keys := []*ast.Identifier{}
-	vars := make(map[*ast.Identifier]struct{})
-
-	switch v := exp.(type) {
-	case *ast.PrefixExpression:
-		keys = append(keys, getVars(v.Right)...)
-	case *ast.InfixExpression:
-		keys = append(keys, getVars(v.Left)...)
-		keys = append(keys, getVars(v.Right)...)
-	case *ast.List:
-		for _, item := range v.Value {
-			keys = append(keys, getVars(item)...)
-		}
-	case *ast.Constant:
-		keys = append(keys, getVars(v.Value)...)
-	case *ast.PrimitiveCall:
-		for _, item := range v.Arguments {
-			keys = append(keys, getVars(item)...)
-		}
-	case *ast.Identifier:
-		vars[v] = struct{}{}
-	default:
-		return nil
-	}
-
-	for i := range vars {
-		if i != nil {
-			keys = append(keys, i)
+	ast.Inspect(exp, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.Identifier:
+			keys = append(keys, v)
+		case *ast.PrimitiveCall:
+			// The primitive is named by an identifier, but it is not a variable.
+			for _, arg := range v.Arguments {
+				keys = append(keys, getVars(arg)...)
+			}
+			return false
 		}
-	}
+		return true
+	})
 	return keys
 }
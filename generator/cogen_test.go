@@ -1,10 +1,18 @@
 package generator_test
 
 import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/evaluator"
 	"cogen/generator"
 	"cogen/lexer"
+	"cogen/object"
 	"cogen/parser"
+	"cogen/primitives"
+	"context"
+	"errors"
 	"log"
+	"math"
 	"strings"
 	"testing"
 )
@@ -184,3 +192,303 @@ stop: return right;
 		})
 	}
 }
+
+func TestCogen_GenErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		prog  string
+		delta []int
+		code  diagnostics.Code
+	}{
+		{
+			name:  "MissingLabel",
+			prog:  "f(x):\ninit: goto nowhere;",
+			delta: []int{0},
+			code:  diagnostics.MissingLabel,
+		},
+		{
+			name:  "StaticIndexOutOfRange",
+			prog:  "f(x):\ninit: return x;",
+			delta: []int{3},
+			code:  diagnostics.InvalidStaticArgs,
+		},
+		{
+			name:  "SyntaxError",
+			prog:  "f(x):\ninit: return ;",
+			delta: []int{0},
+			code:  diagnostics.NoPrefixParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := generator.New(parser.New(lexer.New(tt.prog)))
+			_, err := c.Gen(tt.delta)
+			var list *diagnostics.List
+			if !errors.As(err, &list) {
+				t.Fatalf("expected *diagnostics.List, got %T (%v)", err, err)
+			}
+			if list.Diagnostics[0].Code != tt.code {
+				t.Fatalf("expected code %s, got %s", tt.code, list.Diagnostics[0].Code)
+			}
+		})
+	}
+}
+
+func TestCogen_GenPositions(t *testing.T) {
+	prog := `pow(m, n);
+init: result := 1;
+      goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m;
+      n := n - 1;
+      goto test;
+end: return result;`
+	c := generator.New(parser.New(lexer.New(prog)))
+	got, err := c.Gen([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ls := range got.Statements {
+		if !ls.Span().IsValid() {
+			t.Errorf("label %s has no position", ls.Label.Value)
+		}
+		for _, stmt := range ls.Statements {
+			if !stmt.Span().IsValid() {
+				t.Errorf("statement %q in %s has no position", stmt, ls.Label.Value)
+			}
+		}
+	}
+}
+
+func TestCogen_GenOperators(t *testing.T) {
+	prog := `f(m, n);
+init: if m >= 2 and not m % 2 = 1 goto big else small;
+big: if n <= m or n % m = 0 goto hit else miss;
+small: return not (n > 0);
+hit: return n % m;
+miss: return m >= n and n >= 0;`
+	c := generator.New(parser.New(lexer.New(prog)))
+	got, err := c.Gen([]int{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := got.String()
+	for _, want := range []string{
+		// static conditions are decided by the generating extension
+		"if ((m >= 2) and (not ((m % 2) = 1)))",
+		// dynamic ones are lifted into residual code
+		"list(list('n, '<=, list('quote, m)), 'or, list(list('n, '%, list('quote, m)), '=, 0))",
+		"list('return, list('not, list('n, '>, 0)))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected generating extension to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestCogen_GenStrings(t *testing.T) {
+	prog := `greet(name, who);
+init: prefix := concat("Hello, ", symbol->string(who));
+      if strlen(name) > 3 goto long else short;
+long: return concat(prefix, " \"", substr(name, 0, 3), "\"\n");
+short: return concat(prefix, "\t", name);`
+	c := generator.New(parser.New(lexer.New(prog)))
+	genext, err := c.Gen([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run the generating extension with who = 'bob
+	env := object.NewEnvironment()
+	env.Set("who", &object.Symbol{Value: "bob"})
+	code := evaluator.New(genext).Eval(genext, env)
+	if _, ok := code.(*object.CodeOutput); !ok {
+		t.Fatalf("expected residual code, got %T (%s)", code, code)
+	}
+	if !strings.Contains(code.String(), `concat("Hello, bob", " \"", substr(name, 0, 3), "\"\n")`) {
+		t.Fatalf("strings not lifted as literals:\n%s", code)
+	}
+
+	p := parser.New(lexer.New(code.String()))
+	residual := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("residual program does not parse:\n%s", p.GetErrorMessage())
+	}
+	for _, name := range []string{"Al", "Alexander"} {
+		env := object.NewEnvironment()
+		env.Set("name", &object.String{Value: name})
+		got := evaluator.New(residual).Eval(residual, env)
+
+		env = object.NewEnvironment()
+		env.Set("name", &object.String{Value: name})
+		env.Set("who", &object.Symbol{Value: "bob"})
+		original := parser.New(lexer.New(prog)).ParseProgram()
+		want := evaluator.New(original).Eval(original, env)
+		if got.String() != want.String() {
+			t.Errorf("name=%q: residual gave %s, original gave %s", name, got, want)
+		}
+	}
+}
+
+func TestCogen_GenBigIntegers(t *testing.T) {
+	prog := `f(a, b);
+s: c := a * a;
+   return c + b;`
+	c := generator.New(parser.New(lexer.New(prog)))
+	genext, err := c.Gen([]int{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := object.NewEnvironment()
+	env.Set("a", &object.Integer{Value: math.MaxInt64})
+	code := evaluator.New(genext).Eval(genext, env)
+	if _, ok := code.(*object.CodeOutput); !ok {
+		t.Fatalf("expected residual code, got %T (%s)", code, code)
+	}
+	if !strings.Contains(code.String(), "85070591730234615847396907784232501249") {
+		t.Fatalf("a * a not lifted as a literal:\n%s", code)
+	}
+
+	p := parser.New(lexer.New(code.String()))
+	residual := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("residual program does not parse:\n%s", p.GetErrorMessage())
+	}
+	env = object.NewEnvironment()
+	env.Set("b", &object.Integer{Value: 1})
+	got := evaluator.New(residual).Eval(residual, env)
+	if got.String() != "85070591730234615847396907784232501250" {
+		t.Errorf("residual gave %s", got)
+	}
+}
+
+func TestCogen_GenLeavesOriginal(t *testing.T) {
+	prog := `pow(m, n);
+init: result := 1;
+      goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m;
+      n := n - 1;
+      goto test;
+end: return result;`
+
+	for _, delta := range [][]int{{0}, {1}, {0, 1}} {
+		c := generator.New(parser.New(lexer.New(prog)))
+		genext, err := c.Gen(delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Scribble over every identifier and label of the extension.
+		ast.Inspect(genext, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Identifier:
+				n.Value = "x"
+			case *ast.Label:
+				n.Value = "x"
+			}
+			return true
+		})
+
+		want := parser.New(lexer.New(prog)).ParseProgram()
+		if !ast.Equal(c.OriginalProgram, want) {
+			t.Errorf("delta=%v: generating the extension changed the original:\n%s", delta, c.OriginalProgram)
+		}
+	}
+}
+
+// TestCogen_GenPrimitives specializes a program calling primitives a host
+// program added, which the generator runs early only if they are pure and
+// static.
+func TestCogen_GenPrimitives(t *testing.T) {
+	prims := evaluator.StandardPrimitives()
+	for _, p := range []primitives.Primitive{
+		{Name: "square", Arity: 1, Pure: true},
+		{Name: "later", Arity: 1, Pure: true, BindingTime: primitives.Dynamic},
+		{Name: "tick", Arity: 1},
+	} {
+		p.Func = func(_ *primitives.Registry, args []object.Object) object.Object {
+			if p.Name == "square" {
+				return evaluator.Infix("*", args[0], args[0])
+			}
+			return evaluator.Infix("+", args[0], &object.Integer{Value: 1})
+		}
+		prims.MustRegister(p)
+	}
+	prog := `f(a, b);
+s: c := square(a);
+   d := later(a);
+   e := tick(a);
+   return list(c, d, e, b);`
+	c := generator.New(parser.New(lexer.New(prog)))
+	c.Primitives = prims
+	genext, err := c.Gen([]int{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := object.NewEnvironment()
+	env.Set("a", &object.Integer{Value: 3})
+	code := evaluator.Eval(context.Background(), genext, env, evaluator.Options{Primitives: prims})
+	if _, ok := code.(*object.CodeOutput); !ok {
+		t.Fatalf("expected residual code, got %T (%s)", code, code)
+	}
+	out := code.String()
+	for _, want := range []string{"d := later('3)", "e := tick('3)", "list('9, d, e, b)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected residual program to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "square") {
+		t.Errorf("square(3) left in the residual program:\n%s", out)
+	}
+
+	p := parser.New(lexer.New(out))
+	residual := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("residual program does not parse:\n%s", p.GetErrorMessage())
+	}
+	env = object.NewEnvironment()
+	env.Set("b", &object.Integer{Value: 0})
+	got := evaluator.Eval(context.Background(), residual, env, evaluator.Options{Primitives: prims})
+	if got.String() != "'(9 4 4 0)" {
+		t.Errorf("residual gave %s", got)
+	}
+}
+
+func TestBindingTimes(t *testing.T) {
+	prog := `pow(m, n);
+init: result := 1;
+      goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m;
+      n := n - 1;
+      goto test;
+end: return result;`
+
+	genext, err := generator.New(parser.New(lexer.New(prog))).Gen([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := generator.BindingTimes(genext)
+	tests := map[string]generator.BindingTime{
+		"init":            generator.Static,
+		"0_init_n":        generator.Static,
+		"4_init_n":        generator.Static,
+		"4_loop_n_result": generator.Dynamic,
+		"4_end_n":         generator.Dynamic,
+	}
+	for label, want := range tests {
+		if got, ok := times[label]; !ok || got != want {
+			t.Errorf("%s: want %s, got %s (found %v)", label, want, got, ok)
+		}
+	}
+
+	// The original program is no extension, so all of it runs at run time.
+	for label, bt := range generator.BindingTimes(parser.New(lexer.New(prog)).ParseProgram()) {
+		if bt != generator.Dynamic {
+			t.Errorf("%s of the original should be dynamic, got %s", label, bt)
+		}
+	}
+}
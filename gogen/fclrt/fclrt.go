@@ -0,0 +1,463 @@
+// Package fclrt is the runtime of the Go code gogen writes: the values of
+// FCL programs and the operators and primitives that work on them. gogen
+// copies this file into each package it writes, under that package's
+// name, so the package builds without this module.
+package fclrt
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Value is an FCL value: an int64, or a *big.Int for an integer past
+// int64, a bool, a string, a Symbol, a List or Null. A nil Value is a
+// variable not set yet.
+type Value any
+
+// A Symbol is a quoted name, such as 'right.
+type Symbol string
+
+// A List is a list of values. Programs never change a list once built.
+type List []Value
+
+// Null is the value of a return without one.
+type Null struct{}
+
+// An Error is what a function fails with where the evaluator returns an
+// error. Functions panic with it.
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func fclFail(format string, a ...any) {
+	panic(&Error{Message: fmt.Sprintf(format, a...)})
+}
+
+// Format prints v as the evaluator prints its values.
+func Format(v Value) string { return fclFormat(v, false) }
+
+func fclFormat(v Value, inList bool) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case *big.Int:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return strconv.Quote(v)
+	case Null:
+		return "null"
+	case Symbol:
+		if inList {
+			return string(v)
+		}
+		return "'" + string(v)
+	case List:
+		var out strings.Builder
+		if !inList {
+			out.WriteString("'")
+		}
+		out.WriteString("(")
+		for i, elem := range v {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			out.WriteString(fclFormat(elem, true))
+		}
+		out.WriteString(")")
+		return out.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func fclType(v Value) string {
+	switch v.(type) {
+	case int64, *big.Int:
+		return "INTEGER"
+	case bool:
+		return "BOOLEAN"
+	case string:
+		return "STRING"
+	case Symbol:
+		return "SYMBOL"
+	case List:
+		return "LIST"
+	case Null:
+		return "NULL"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// fclGet reads a variable that may not be set yet.
+func fclGet(v Value, notFound string) Value {
+	if v == nil {
+		panic(&Error{Message: notFound})
+	}
+	return v
+}
+
+func fclTruthy(v Value) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case Null:
+		return false
+	}
+	return true
+}
+
+// The integer operators work on int64 values while the result fits, and
+// on *big.Int values otherwise, as the evaluator does.
+
+// fclInt returns v as an int64 if it fits, and as a *big.Int otherwise.
+func fclInt(v *big.Int) Value {
+	if v.IsInt64() {
+		return v.Int64()
+	}
+	return v
+}
+
+// fclBig returns the integer literal s, which does not fit in an int64.
+func fclBig(s string) Value {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		fclFail("invalid integer %s", s)
+	}
+	return fclInt(v)
+}
+
+func fclBigOf(v Value) *big.Int {
+	if i, ok := v.(int64); ok {
+		return big.NewInt(i)
+	}
+	return new(big.Int).Set(v.(*big.Int))
+}
+
+func fclAdd(a, b int64) Value {
+	sum := a + b
+	if (a^sum)&(b^sum) < 0 {
+		return fclBigInfix("+", a, b)
+	}
+	return sum
+}
+
+func fclSub(a, b int64) Value {
+	diff := a - b
+	if (a^b)&(a^diff) < 0 {
+		return fclBigInfix("-", a, b)
+	}
+	return diff
+}
+
+func fclMul(a, b int64) Value {
+	if a == 0 || b == 0 {
+		return int64(0)
+	}
+	prod := a * b
+	if prod/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return fclBigInfix("*", a, b)
+	}
+	return prod
+}
+
+func fclDiv(a, b int64) Value {
+	if b == 0 {
+		fclFail("division by zero: %d / %d", a, b)
+	}
+	if a == math.MinInt64 && b == -1 {
+		return fclBigInfix("/", a, b)
+	}
+	return a / b
+}
+
+func fclMod(a, b int64) int64 {
+	if b == 0 {
+		fclFail("modulo by zero: %d %% %d", a, b)
+	}
+	return a % b
+}
+
+func fclNeg(a Value) Value {
+	if a, ok := a.(int64); ok && a != math.MinInt64 {
+		return -a
+	}
+	return fclInt(new(big.Int).Neg(fclBigOf(a)))
+}
+
+// fclBigInfix applies an operator to integers of which one may not fit in
+// an int64.
+func fclBigInfix(op string, l, r Value) Value {
+	left, right := fclBigOf(l), fclBigOf(r)
+	switch op {
+	case "+":
+		return fclInt(left.Add(left, right))
+	case "-":
+		return fclInt(left.Sub(left, right))
+	case "*":
+		return fclInt(left.Mul(left, right))
+	case "/":
+		if right.Sign() == 0 {
+			fclFail("division by zero: %s / %s", Format(l), Format(r))
+		}
+		return fclInt(left.Quo(left, right))
+	case "%":
+		if right.Sign() == 0 {
+			fclFail("modulo by zero: %s %% %s", Format(l), Format(r))
+		}
+		return fclInt(left.Rem(left, right))
+	case "=":
+		return left.Cmp(right) == 0
+	case "!=":
+		return left.Cmp(right) != 0
+	case "<":
+		return left.Cmp(right) < 0
+	case ">":
+		return left.Cmp(right) > 0
+	case "<=":
+		return left.Cmp(right) <= 0
+	case ">=":
+		return left.Cmp(right) >= 0
+	}
+	fclFail("unknown operator: INTEGER %s INTEGER", op)
+	return nil
+}
+
+// fclInfix applies an operator to values whose types are only known when
+// the program runs.
+func fclInfix(op string, l, r Value) Value {
+	if fclType(l) != fclType(r) {
+		fclFail("type mismatch: %s %s %s, for: %s %s", fclType(l), op, fclType(r), Format(l), Format(r))
+	}
+	switch l := l.(type) {
+	case int64:
+		if _, ok := r.(int64); !ok {
+			return fclBigInfix(op, l, r)
+		}
+		r := r.(int64)
+		switch op {
+		case "+":
+			return fclAdd(l, r)
+		case "-":
+			return fclSub(l, r)
+		case "*":
+			return fclMul(l, r)
+		case "/":
+			return fclDiv(l, r)
+		case "%":
+			return fclMod(l, r)
+		case "=":
+			return l == r
+		case "!=":
+			return l != r
+		case "<":
+			return l < r
+		case ">":
+			return l > r
+		case "<=":
+			return l <= r
+		case ">=":
+			return l >= r
+		}
+	case *big.Int:
+		return fclBigInfix(op, l, r)
+	case List:
+		switch op {
+		case "=":
+			return fclEqualList(l, r.(List))
+		case "!=":
+			return !fclEqualList(l, r.(List))
+		}
+	case Symbol:
+		switch op {
+		case "=":
+			return l == r
+		case "!=":
+			return l != r
+		}
+		fclFail("unknown operator: %s %s %s", fclType(l), op, Format(r))
+	case bool, string:
+		switch op {
+		case "=":
+			return l == r
+		case "!=":
+			return l != r
+		}
+	}
+	fclFail("unknown operator: %s %s %s", fclType(l), op, fclType(r))
+	return nil
+}
+
+// fclEqualList compares lists as the evaluator does, where elements that
+// cannot be compared, being of different types, count as equal.
+func fclEqualList(l, r List) bool {
+	if len(l) != len(r) {
+		return false
+	}
+	for i := range l {
+		if !fclEqualElem(l[i], r[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func fclEqualElem(l, r Value) bool {
+	if fclType(l) != fclType(r) {
+		return true
+	}
+	switch l := l.(type) {
+	case List:
+		return fclEqualList(l, r.(List))
+	case int64, *big.Int:
+		return fclInfix("=", l, r).(bool)
+	case bool, string, Symbol:
+		return l == r
+	}
+	return true
+}
+
+func fclPrefix(op string, v Value) Value {
+	switch op {
+	case "!", "not":
+		return !fclTruthy(v)
+	case "-":
+		if fclType(v) == "INTEGER" {
+			return fclNeg(v)
+		}
+		fclFail("unknown operator: -%s", fclType(v))
+	}
+	fclFail("unknown operator: %s for %s", op, Format(v))
+	return nil
+}
+
+func fclHd(v Value) Value {
+	l, ok := v.(List)
+	if !ok {
+		fclFail("hd expects list, got %s", fclType(v))
+	}
+	if len(l) == 0 {
+		fclFail("hd called on empty list")
+	}
+	return l[0]
+}
+
+func fclTl(v Value) Value {
+	l, ok := v.(List)
+	if !ok {
+		fclFail("tl expects list, got %s", fclType(v))
+	}
+	if len(l) == 0 {
+		fclFail("tl called on empty list")
+	}
+	return l[1:]
+}
+
+func fclCons(a, b Value) Value {
+	if l, ok := b.(List); ok {
+		return append(List{a}, l...)
+	}
+	return List{a, b}
+}
+
+func fclConcat(args ...Value) string {
+	var out strings.Builder
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			fclFail("concat expects strings, got %s as argument %d", fclType(arg), i+1)
+		}
+		out.WriteString(s)
+	}
+	return out.String()
+}
+
+func fclStrlen(v Value) int64 {
+	s, ok := v.(string)
+	if !ok {
+		fclFail("strlen expects string, got %s", fclType(v))
+	}
+	return int64(utf8.RuneCountInString(s))
+}
+
+func fclSubstr(sv, startv, endv Value) string {
+	s, ok := sv.(string)
+	if !ok {
+		fclFail("substr expects first argument to be a string, got %s", fclType(sv))
+	}
+	if fclType(startv) != "INTEGER" {
+		fclFail("substr expects second argument to be an integer, got %s", fclType(startv))
+	}
+	if fclType(endv) != "INTEGER" {
+		fclFail("substr expects third argument to be an integer, got %s", fclType(endv))
+	}
+	runes := []rune(s)
+	start, ok := startv.(int64)
+	end, ok2 := endv.(int64)
+	if !ok || !ok2 {
+		fclFail("substr range [%s, %s) out of bounds for string of length %d", Format(startv), Format(endv), len(runes))
+	}
+	if start < 0 || end < start || end > int64(len(runes)) {
+		fclFail("substr range [%d, %d) out of bounds for string of length %d", start, end, len(runes))
+	}
+	return string(runes[start:end])
+}
+
+func fclSymbolToString(v Value) string {
+	s, ok := v.(Symbol)
+	if !ok {
+		fclFail("symbol->string expects symbol, got %s", fclType(v))
+	}
+	return string(s)
+}
+
+func fclStringToSymbol(v Value) Value {
+	s, ok := v.(string)
+	if !ok {
+		fclFail("string->symbol expects string, got %s", fclType(v))
+	}
+	return Symbol(s)
+}
+
+// fclNewTail returns the instructions of q from the one labelled item.
+func fclNewTail(item, qv Value) Value {
+	q, ok := qv.(List)
+	if !ok {
+		fclFail("newTail expects second element to be a list, got %s", fclType(qv))
+	}
+	name := Format(item)
+	i := 0
+	for _, block := range q {
+		l, ok := block.(List)
+		if !ok {
+			fclFail("newTail expects second input to be list of list, got %s", fclType(block))
+		}
+		if len(l) == 0 {
+			continue
+		}
+		var label string
+		switch v := l[0].(type) {
+		case int64, *big.Int, bool:
+			label = Format(v)
+		case string:
+			label = v
+		case Symbol:
+			label = string(v)
+		default:
+			fclFail("newTail expects the first value of each sublist to implement the ValueString interface.")
+		}
+		if label == name {
+			return q[i:]
+		}
+		i++
+	}
+	return q[i:]
+}
@@ -0,0 +1,813 @@
+// Package gogen translates FCL programs, original or residual, to Go. A
+// program becomes an exported function whose parameters and result have
+// the Go types its variables are used at: int64, bool, string, or Value
+// for lists, symbols and variables that hold more than one kind of value.
+//
+// Each block a program enters by goto is a labelled statement of a Go
+// function, and a jump is a goto. A call starts a function of its own for
+// the called block, which gets the caller's variables as arguments, so
+// that what it assigns stays its own as in the evaluator.
+//
+// The code gives what the evaluator gives. Integers are int64 where they
+// cannot grow past it; the results of arithmetic are Values, which hold a
+// *big.Int where the evaluator goes on with a big integer, as for pow 2
+// 100.
+//
+// The code needs the runtime Runtime returns, in the same package.
+package gogen
+
+import (
+	"bytes"
+	"cogen/ast"
+	"cogen/cfg"
+	"cogen/dataflow"
+	_ "embed"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed fclrt/fclrt.go
+var runtimeSource string
+
+// Runtime returns the source of the runtime for package pkg.
+func Runtime(pkg string) []byte {
+	src := strings.Replace(runtimeSource, "package fclrt", "package "+pkg, 1)
+	return []byte("// Code generated by fcl build-go. DO NOT EDIT.\n\n" + src)
+}
+
+// Options names what Generate writes.
+type Options struct {
+	Package string // the package clause
+	Func    string // the exported function; from the program name if empty
+}
+
+// goType is the Go type of a variable or expression. The types form a
+// lattice: none, below int64, bool and string, below Value.
+type goType int
+
+const (
+	tNone goType = iota
+	tInt
+	tBool
+	tString
+	tValue
+)
+
+func (t goType) String() string {
+	return [...]string{"Value", "int64", "bool", "string", "Value"}[t]
+}
+
+func join(a, b goType) goType {
+	switch {
+	case a == tNone:
+		return b
+	case b == tNone, a == b:
+		return a
+	}
+	return tValue
+}
+
+// expr is an expression translated to Go.
+type expr struct {
+	code   string
+	t      goType
+	lit    bool // an untyped constant
+	binary bool // needs parentheses as an operand
+}
+
+// function is the Go function of the blocks that run from entry on, up to
+// a return or a call.
+type function struct {
+	entry   *cfg.Block
+	name    string
+	blocks  []*cfg.Block // entry first, then the blocks it jumps to in program order
+	labels  map[*cfg.Block]string
+	targets map[*cfg.Block]bool // blocks some goto in the function jumps to
+	result  goType
+}
+
+type generator struct {
+	program *ast.Program
+	graph   *cfg.Graph
+	assign  *dataflow.Result[dataflow.VarSet]
+	opts    Options
+	prefix  string // of the names of the package-level declarations
+
+	vars    []string          // the variables, parameters first
+	names   map[string]string // the Go name of each variable
+	types   map[string]goType
+	inputs  map[string]goType // the type of each parameter of the exported function
+	checked map[string]bool   // variables read where they may not be set
+
+	funcs  []*function
+	called map[*cfg.Block]*function
+	data   map[ast.Node]string // the package variable holding each quoted list
+	decls  []string
+}
+
+// Generate translates program to the source of a Go file. It fails on
+// programs that call the primitives that build code, which only
+// generating extensions use.
+func Generate(program *ast.Program, opts Options) ([]byte, error) {
+	if len(program.Statements) == 0 {
+		return nil, fmt.Errorf("program has no labels")
+	}
+	if opts.Func == "" {
+		opts.Func = exported(program.Name)
+	}
+	if !token.IsIdentifier(opts.Func) || !token.IsExported(opts.Func) {
+		return nil, fmt.Errorf("%q is not an exported Go name", opts.Func)
+	}
+	if !token.IsIdentifier(opts.Package) {
+		return nil, fmt.Errorf("%q is not a Go package name", opts.Package)
+	}
+	graph := cfg.New(program)
+	g := &generator{
+		program: program,
+		graph:   graph,
+		assign:  dataflow.DefiniteAssignment(graph),
+		opts:    opts,
+		prefix:  strings.ToLower(opts.Func[:1]) + opts.Func[1:],
+		names:   map[string]string{},
+		types:   map[string]goType{},
+		inputs:  map[string]goType{},
+		checked: map[string]bool{},
+		called:  map[*cfg.Block]*function{},
+		data:    map[ast.Node]string{},
+	}
+	g.function(graph.Entry)
+	for i := 0; i < len(g.funcs); i++ {
+		for _, b := range g.funcs[i].blocks {
+			for _, e := range b.Succs {
+				if e.Kind == cfg.Call {
+					g.function(e.To)
+				}
+			}
+		}
+	}
+	g.variables()
+	if err := g.infer(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := g.write(&out); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not parse: %v\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+// function returns the function starting at entry, adding it if new.
+func (g *generator) function(entry *cfg.Block) *function {
+	if f, ok := g.called[entry]; ok {
+		return f
+	}
+	f := &function{entry: entry, labels: map[*cfg.Block]string{}, targets: map[*cfg.Block]bool{}}
+	g.called[entry] = f
+	g.funcs = append(g.funcs, f)
+	f.name = g.prefix + "_" + sanitize(entry.Name)
+	for _, other := range g.funcs[:len(g.funcs)-1] {
+		if other.name == f.name {
+			f.name += strconv.Itoa(len(g.funcs))
+		}
+	}
+
+	seen := map[*cfg.Block]bool{entry: true}
+	work := []*cfg.Block{entry}
+	for len(work) > 0 {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, e := range b.Succs {
+			if e.Kind != cfg.Goto && e.Kind != cfg.True && e.Kind != cfg.False {
+				continue
+			}
+			f.targets[e.To] = true
+			if !seen[e.To] {
+				seen[e.To] = true
+				work = append(work, e.To)
+			}
+		}
+	}
+	f.blocks = append(f.blocks, entry)
+	for _, b := range g.graph.Blocks {
+		if seen[b] && b != entry {
+			f.blocks = append(f.blocks, b)
+		}
+	}
+	used := map[string]bool{}
+	for _, b := range f.blocks {
+		name := sanitize(b.Name)
+		if token.IsKeyword(name) {
+			name = "_" + name
+		}
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		f.labels[b] = name
+	}
+	return f
+}
+
+// variables names the variables of the blocks translated, and finds those
+// read where the evaluator may not have set them yet.
+func (g *generator) variables() {
+	seen, used := map[string]bool{}, map[string]bool{}
+	add := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		g.vars = append(g.vars, name)
+		goName := sanitize(name)
+		for g.reserved(goName) || used[goName] {
+			goName = "_" + goName
+		}
+		used[goName] = true
+		g.names[name] = goName
+	}
+	for _, in := range g.program.Variables {
+		add(in.Ident.Value)
+	}
+	for _, f := range g.funcs {
+		for _, b := range f.blocks {
+			for i, stmt := range b.Stmts {
+				for _, id := range dataflow.Uses(stmt) {
+					add(id.Value)
+					if !g.assign.Before(b, i).Has(id.Value) {
+						g.checked[id.Value] = true
+					}
+				}
+				if d := dataflow.Def(stmt); d != nil {
+					add(d.Value)
+				}
+			}
+		}
+	}
+}
+
+// reserved reports whether a variable cannot be called name in Go: a
+// keyword, a name Go predeclares, or one the runtime or the package-level
+// declarations use.
+func (g *generator) reserved(name string) bool {
+	switch name {
+	case "Value", "Symbol", "List", "Null", "Error", "Format",
+		"any", "bool", "byte", "comparable", "complex64", "complex128", "error",
+		"float32", "float64", "int", "int8", "int16", "int32", "int64", "rune",
+		"string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"true", "false", "iota", "nil", "append", "cap", "clear", "close",
+		"complex", "copy", "delete", "imag", "len", "make", "max", "min", "new",
+		"panic", "print", "println", "real", "recover":
+		return true
+	}
+	return token.IsKeyword(name) || strings.HasPrefix(name, "fcl") || strings.HasPrefix(name, g.prefix+"_")
+}
+
+// sanitize turns an FCL name, which may hold hyphens or start with a
+// digit, into a Go identifier.
+func sanitize(name string) string {
+	var out strings.Builder
+	for _, r := range name {
+		if r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			out.WriteRune(r)
+		} else {
+			out.WriteRune('_')
+		}
+	}
+	s := out.String()
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "_" + s
+	}
+	return s
+}
+
+// exported returns the exported Go name of the program called name.
+func exported(name string) string {
+	s := strings.TrimLeft(sanitize(name), "_")
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		return "Program" + s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// infer gives each variable the type of the values assigned to it and
+// each function the type of the values it returns, joining them until
+// none changes. A parameter also gets the type its uses demand, which is
+// the type the exported function takes it at.
+func (g *generator) infer() error {
+	for _, in := range g.program.Variables {
+		g.inputs[in.Ident.Value] = g.demand(in.Ident.Value)
+		g.types[in.Ident.Value] = g.inputs[in.Ident.Value]
+	}
+	for name := range g.checked {
+		g.types[name] = tValue
+	}
+	for changed := true; changed; {
+		changed = false
+		update := func(t *goType, with goType) {
+			if j := join(*t, with); j != *t {
+				*t, changed = j, true
+			}
+		}
+		for _, f := range g.funcs {
+			for _, b := range f.blocks {
+				var last goType = tValue // of a block that ends without a jump
+				for _, stmt := range b.Stmts {
+					last = tValue
+					switch stmt := stmt.(type) {
+					case *ast.ReturnStatement:
+						e, err := g.expr(stmt.ReturnValue)
+						if err != nil {
+							return err
+						}
+						update(&f.result, e.t)
+					case *ast.AssignmentStatement:
+						t := g.types[stmt.Left.Value]
+						if call, ok := stmt.Right.(*ast.CallExpression); ok {
+							if callee := g.graph.Block(call.Label.Value); callee != nil {
+								update(&t, g.called[callee].result)
+							}
+						} else {
+							e, err := g.expr(stmt.Right)
+							if err != nil {
+								return err
+							}
+							update(&t, e.t)
+						}
+						g.types[stmt.Left.Value] = t
+					case *ast.ExpressionStatement:
+						e, err := g.expr(stmt.Expression)
+						if err != nil {
+							return err
+						}
+						last = e.t
+					case *ast.GotoStatement, *ast.IfStatement:
+					default:
+						return fmt.Errorf("cannot translate statement %s", stmt)
+					}
+				}
+				if len(b.Stmts) == 0 || !jumps(b.Stmts[len(b.Stmts)-1]) {
+					update(&f.result, last)
+				}
+			}
+		}
+	}
+	for name, t := range g.types {
+		if t == tNone {
+			g.types[name] = tValue
+		}
+	}
+	for _, f := range g.funcs {
+		if f.result == tNone {
+			f.result = tValue
+		}
+	}
+	return nil
+}
+
+func jumps(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.GotoStatement, *ast.IfStatement, *ast.ReturnStatement:
+		return true
+	}
+	return false
+}
+
+var intOperators = map[string]string{"+": "fclAdd", "-": "fclSub", "*": "fclMul", "/": "fclDiv", "%": "fclMod"}
+
+// demand returns the type the uses of parameter name need it to have: an
+// int64 if it is an operand of arithmetic or of an ordering, the type of
+// the inputs of the primitives it is given to, and a Value otherwise.
+func (g *generator) demand(name string) goType {
+	t := tNone
+	is := func(e ast.Expression) bool {
+		id, ok := e.(*ast.Identifier)
+		return ok && id.Value == name
+	}
+	for _, f := range g.funcs {
+		for _, b := range f.blocks {
+			for _, stmt := range b.Stmts {
+				ast.Inspect(stmt, func(n ast.Node) bool {
+					switch n := n.(type) {
+					case *ast.InfixExpression:
+						_, arith := intOperators[n.Operator]
+						ordering := n.Operator == "<" || n.Operator == ">" || n.Operator == "<=" || n.Operator == ">="
+						if (arith || ordering) && (is(n.Left) || is(n.Right)) {
+							t = join(t, tInt)
+						}
+					case *ast.PrefixExpression:
+						if n.Operator == "-" && is(n.Right) {
+							t = join(t, tInt)
+						}
+					case *ast.PrimitiveCall:
+						inputs := primitives[n.Primitive.String()].inputs
+						for i, arg := range n.Arguments {
+							if is(arg) && len(inputs) > 0 {
+								t = join(t, inputs[min(i, len(inputs)-1)])
+							}
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+	if t == tNone {
+		return tValue
+	}
+	return t
+}
+
+// box returns e as an operand of type Value.
+func box(e expr) string {
+	if e.lit && e.t == tInt {
+		return "int64(" + e.code + ")"
+	}
+	return e.code
+}
+
+// operand returns e as the operand of a binary or unary operator.
+func operand(e expr) string {
+	if e.binary {
+		return "(" + e.code + ")"
+	}
+	return e.code
+}
+
+// convert returns e as a value of type t, which e's values must have.
+func convert(e expr, t goType) string {
+	switch {
+	case e.t == t:
+		return e.code
+	case t == tValue:
+		return box(e)
+	}
+	return operand(e) + ".(" + t.String() + ")"
+}
+
+func truthy(e expr) string {
+	if e.t == tBool {
+		return e.code
+	}
+	return "fclTruthy(" + box(e) + ")"
+}
+
+func (g *generator) expr(node ast.Expression) (expr, error) {
+	switch node := node.(type) {
+	case nil:
+		return expr{code: "Null{}", t: tValue}, nil
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return expr{code: "fclBig(" + strconv.Quote(node.Big.String()) + ")", t: tValue}, nil
+		}
+		return expr{code: strconv.FormatInt(node.Value, 10), t: tInt, lit: true}, nil
+	case *ast.BooleanLiteral:
+		return expr{code: strconv.FormatBool(node.Value), t: tBool, lit: true}, nil
+	case *ast.StringLiteral:
+		return expr{code: strconv.Quote(node.Value), t: tString, lit: true}, nil
+	case *ast.SymbolExpression:
+		return expr{code: "Symbol(" + strconv.Quote(node.Value) + ")", t: tValue}, nil
+	case *ast.Identifier:
+		name := g.names[node.Value]
+		if g.checked[node.Value] {
+			msg := fmt.Sprintf("identifier not found: %s at %d:%d", node.Value, node.Token.Line, node.Token.Column)
+			return expr{code: "fclGet(" + name + ", " + strconv.Quote(msg) + ")", t: tValue}, nil
+		}
+		return expr{code: name, t: g.types[node.Value]}, nil
+	case *ast.Constant:
+		e, _, err := g.datum(node.Value)
+		return e, err
+	case *ast.List:
+		elems, err := g.exprs(node.Value)
+		if err != nil {
+			return expr{}, err
+		}
+		return list(elems), nil
+	case *ast.PrefixExpression:
+		right, err := g.expr(node.Right)
+		if err != nil {
+			return expr{}, err
+		}
+		switch node.Operator {
+		case "-":
+			if right.t == tInt {
+				return expr{code: "fclNeg(" + box(right) + ")", t: tValue}, nil
+			}
+			return expr{code: "fclPrefix(\"-\", " + box(right) + ")", t: tValue}, nil
+		case "!", "not":
+			if right.t == tBool {
+				return expr{code: "!" + operand(right), t: tBool}, nil
+			}
+			return expr{code: "!" + truthy(right), t: tBool}, nil
+		}
+		return expr{}, fmt.Errorf("unknown operator %s in %s", node.Operator, node)
+	case *ast.InfixExpression:
+		return g.infix(node)
+	case *ast.PrimitiveCall:
+		return g.primitive(node)
+	}
+	return expr{}, fmt.Errorf("cannot translate expression %s", node)
+}
+
+func (g *generator) exprs(nodes []ast.Expression) ([]expr, error) {
+	out := make([]expr, len(nodes))
+	for i, n := range nodes {
+		e, err := g.expr(n)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = e
+	}
+	return out, nil
+}
+
+func list(elems []expr) expr {
+	codes := make([]string, len(elems))
+	for i, e := range elems {
+		codes[i] = box(e)
+	}
+	return expr{code: "List{" + strings.Join(codes, ", ") + "}", t: tValue}
+}
+
+func (g *generator) infix(node *ast.InfixExpression) (expr, error) {
+	left, err := g.expr(node.Left)
+	if err != nil {
+		return expr{}, err
+	}
+	right, err := g.expr(node.Right)
+	if err != nil {
+		return expr{}, err
+	}
+	op := node.Operator
+	dynamic := func(t goType) expr {
+		code := fmt.Sprintf("fclInfix(%q, %s, %s)", op, box(left), box(right))
+		if t != tValue {
+			code += ".(" + t.String() + ")"
+		}
+		return expr{code: code, t: t}
+	}
+	switch op {
+	case "and", "or":
+		goOp := map[string]string{"and": " && ", "or": " || "}[op]
+		l, r := truthy(left), truthy(right)
+		if left.t == tBool {
+			l = operand(left)
+		}
+		if right.t == tBool {
+			r = operand(right)
+		}
+		return expr{code: l + goOp + r, t: tBool, binary: true}, nil
+	case "+", "-", "*", "/", "%":
+		if left.t != tInt || right.t != tInt {
+			return dynamic(tValue), nil
+		}
+		// Only the remainder of two int64 values is sure to fit in one.
+		t := tValue
+		if op == "%" {
+			t = tInt
+		}
+		return expr{code: fmt.Sprintf("%s(%s, %s)", intOperators[op], left.code, right.code), t: t}, nil
+	case "<", ">", "<=", ">=":
+		if left.t != tInt || right.t != tInt {
+			return dynamic(tBool), nil
+		}
+		return expr{code: operand(left) + " " + op + " " + operand(right), t: tBool, binary: true}, nil
+	case "=", "!=":
+		if left.t != right.t || left.t == tValue {
+			return dynamic(tBool), nil
+		}
+		goOp := map[string]string{"=": " == ", "!=": " != "}[op]
+		return expr{code: operand(left) + goOp + operand(right), t: tBool, binary: true}, nil
+	}
+	return expr{}, fmt.Errorf("unknown operator %s in %s", op, node)
+}
+
+// primitives gives the runtime function, arity and result of each
+// primitive Go code can call, and the types its inputs must have, the last
+// repeating; none is any type. An arity of -1 takes any number.
+var primitives = map[string]struct {
+	fn     string
+	arity  int
+	result goType
+	inputs []goType
+}{
+	"hd":             {"fclHd", 1, tValue, []goType{tValue}},
+	"tl":             {"fclTl", 1, tValue, []goType{tValue}},
+	"cons":           {"fclCons", 2, tValue, []goType{tNone, tValue}},
+	"list":           {"", -1, tValue, nil},
+	"concat":         {"fclConcat", -1, tString, []goType{tString}},
+	"strlen":         {"fclStrlen", 1, tInt, []goType{tString}},
+	"substr":         {"fclSubstr", 3, tString, []goType{tString, tInt}},
+	"symbol->string": {"fclSymbolToString", 1, tString, []goType{tValue}},
+	"string->symbol": {"fclStringToSymbol", 1, tValue, []goType{tString}},
+	"newTail":        {"fclNewTail", 2, tValue, []goType{tNone, tValue}},
+	"new_tail":       {"fclNewTail", 2, tValue, []goType{tNone, tValue}},
+}
+
+func (g *generator) primitive(node *ast.PrimitiveCall) (expr, error) {
+	name := node.Primitive.String()
+	p, ok := primitives[name]
+	if !ok {
+		return expr{}, fmt.Errorf("primitive %s cannot be translated to Go", name)
+	}
+	if p.arity >= 0 && len(node.Arguments) != p.arity {
+		return expr{}, fmt.Errorf("%s takes %d inputs, got %d", name, p.arity, len(node.Arguments))
+	}
+	args, err := g.exprs(node.Arguments)
+	if err != nil {
+		return expr{}, err
+	}
+	if name == "list" {
+		return list(args), nil
+	}
+	if name == "concat" {
+		codes := []string{}
+		for _, a := range args {
+			if a.t != tString {
+				codes = nil
+				break
+			}
+			codes = append(codes, operand(a))
+		}
+		switch {
+		case len(args) == 0:
+			return expr{code: `""`, t: tString, lit: true}, nil
+		case len(args) == 1 && codes != nil:
+			return args[0], nil
+		case codes != nil:
+			return expr{code: strings.Join(codes, " + "), t: tString, binary: true}, nil
+		}
+	}
+	codes := make([]string, len(args))
+	for i, a := range args {
+		codes[i] = box(a)
+	}
+	return expr{code: p.fn + "(" + strings.Join(codes, ", ") + ")", t: p.result}, nil
+}
+
+// datum translates quoted data. A list of constants becomes a package
+// variable, built once: no primitive changes the lists it is given.
+func (g *generator) datum(node ast.Expression) (expr, bool, error) {
+	switch node := node.(type) {
+	case *ast.List:
+		elems := make([]expr, len(node.Value))
+		constant := true
+		for i, elem := range node.Value {
+			e, c, err := g.datum(elem)
+			if err != nil {
+				return expr{}, false, err
+			}
+			elems[i], constant = e, constant && c
+		}
+		e := list(elems)
+		if !constant {
+			return e, false, nil
+		}
+		name, ok := g.data[node]
+		if !ok {
+			name = fmt.Sprintf("%s_data%d", g.prefix, len(g.decls))
+			g.data[node] = name
+			g.decls = append(g.decls, fmt.Sprintf("var %s = %s", name, e.code))
+		}
+		return expr{code: name, t: tValue}, true, nil
+	case *ast.Constant:
+		e, c, err := g.datum(node.Value)
+		if err != nil {
+			return expr{}, false, err
+		}
+		return list([]expr{{code: `Symbol("quote")`, t: tValue}, e}), c, nil
+	case *ast.IntegerLiteral, *ast.BooleanLiteral, *ast.StringLiteral, *ast.SymbolExpression:
+		e, err := g.expr(node)
+		return e, true, err
+	}
+	e, err := g.expr(node)
+	return e, false, err
+}
+
+func (g *generator) write(out *bytes.Buffer) error {
+	fmt.Fprintf(out, "// Code generated by fcl build-go. DO NOT EDIT.\n\npackage %s\n\n", g.opts.Package)
+
+	var inputs, params, locals, args []string
+	for i, name := range g.vars {
+		decl := g.names[name] + " " + g.types[name].String()
+		if i < len(g.program.Variables) {
+			inputs = append(inputs, g.names[name]+" "+g.inputs[name].String())
+			params = append(params, decl)
+		} else {
+			locals = append(locals, decl)
+		}
+		args = append(args, g.names[name])
+	}
+	entry := g.funcs[0]
+	var sig []string
+	for _, in := range g.program.Variables {
+		sig = append(sig, in.Ident.Value)
+	}
+	fmt.Fprintf(out, "// %s runs the FCL program %s(%s).\n", g.opts.Func, g.program.Name, strings.Join(sig, ", "))
+	fmt.Fprintf(out, "// It panics with an *Error where the evaluator would return an error.\n")
+	fmt.Fprintf(out, "func %s(%s) %s {\n", g.opts.Func, strings.Join(inputs, ", "), entry.result)
+	switch len(locals) {
+	case 0:
+	case 1:
+		fmt.Fprintf(out, "var %s\n", locals[0])
+	default:
+		fmt.Fprintf(out, "var (\n%s\n)\n", strings.Join(locals, "\n"))
+	}
+	fmt.Fprintf(out, "return %s(%s)\n}\n", entry.name, strings.Join(args, ", "))
+
+	all := strings.Join(append(params, locals...), ", ")
+	for _, f := range g.funcs {
+		fmt.Fprintf(out, "\n// %s runs the program from %s.\n", f.name, f.entry.Name)
+		fmt.Fprintf(out, "func %s(%s) %s {\n", f.name, all, f.result)
+		for _, b := range f.blocks {
+			if f.targets[b] {
+				fmt.Fprintf(out, "%s:\n", f.labels[b])
+			}
+			if err := g.block(out, f, b, args); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "}\n")
+	}
+
+	if len(g.decls) > 0 {
+		out.WriteString("\n")
+		out.WriteString(strings.Join(g.decls, "\n") + "\n")
+	}
+	return nil
+}
+
+// block writes the statements of b, ending with a goto, a return or a
+// panic, so that control never runs into the next block.
+func (g *generator) block(out *bytes.Buffer, f *function, b *cfg.Block, args []string) error {
+	jump := func(label *ast.Label) string {
+		target := g.graph.Block(label.Value)
+		if target == nil {
+			return fmt.Sprintf("panic(&Error{Message: %q})", "label not found: "+label.Value)
+		}
+		return "goto " + f.labels[target]
+	}
+	for i, stmt := range b.Stmts {
+		last := i == len(b.Stmts)-1
+		switch stmt := stmt.(type) {
+		case *ast.GotoStatement:
+			fmt.Fprintln(out, jump(&stmt.Label))
+			return nil
+		case *ast.IfStatement:
+			cond, err := g.expr(stmt.Cond)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "if %s {\n%s\n} else {\n%s\n}\n", truthy(cond), jump(&stmt.LabelTrue), jump(&stmt.LabelFalse))
+			return nil
+		case *ast.ReturnStatement:
+			e, err := g.expr(stmt.ReturnValue)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "return %s\n", convert(e, f.result))
+			return nil
+		case *ast.AssignmentStatement:
+			name, t := g.names[stmt.Left.Value], g.types[stmt.Left.Value]
+			if call, ok := stmt.Right.(*ast.CallExpression); ok {
+				callee := g.graph.Block(call.Label.Value)
+				if callee == nil {
+					fmt.Fprintf(out, "panic(&Error{Message: %q})\n", "LabelStatement not found in call expression: "+call.Label.Value)
+					return nil
+				}
+				fn := g.called[callee]
+				e := expr{code: fn.name + "(" + strings.Join(args, ", ") + ")", t: fn.result}
+				fmt.Fprintf(out, "%s = %s\n", name, convert(e, t))
+				break
+			}
+			e, err := g.expr(stmt.Right)
+			if err != nil {
+				return err
+			}
+			if code := convert(e, t); code != name {
+				fmt.Fprintf(out, "%s = %s\n", name, code)
+			}
+		case *ast.ExpressionStatement:
+			e, err := g.expr(stmt.Expression)
+			if err != nil {
+				return err
+			}
+			if last {
+				fmt.Fprintf(out, "return %s\n", convert(e, f.result))
+				return nil
+			}
+			fmt.Fprintf(out, "_ = %s\n", e.code)
+		}
+	}
+	// The block ends without a jump and its last statement has no value.
+	fmt.Fprintln(out, "return nil")
+	return nil
+}
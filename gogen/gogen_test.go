@@ -0,0 +1,289 @@
+package gogen_test
+
+import (
+	"cogen/ast"
+	"cogen/evaluator"
+	"cogen/generator"
+	"cogen/gogen"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const pow = `pow(m, n);
+init: result := 1;
+      goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m;
+      n := n - 1;
+      goto test;
+end: return result;`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	return program
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		opts    gogen.Options
+		want    []string
+	}{
+		{"pow", pow, gogen.Options{Package: "p"}, []string{
+			"package p\n",
+			"func Pow(m int64, n int64) Value {",
+			"\tvar result Value\n\treturn pow_init(m, n, result)",
+			"func pow_init(m int64, n Value, result Value) Value {",
+			"test:\n\tif fclInfix(\"<\", n, int64(1)).(bool) {\n\t\tgoto end\n\t} else {\n\t\tgoto loop\n\t}",
+			`result = fclInfix("*", result, m)`,
+		}},
+		{"named", pow, gogen.Options{Package: "p", Func: "Pow_2"}, []string{
+			"func Pow_2(m int64, n int64) Value {",
+			"func pow_2_init(",
+		}},
+		{"call", "f(n);\na: x := call b;\n   return x;\nb: return n + 1;", gogen.Options{Package: "p"}, []string{
+			"func F(n int64) Value {",
+			"x = f_b(n, x)",
+			"func f_b(n int64, x Value) Value {",
+		}},
+		{"lists", "f(l);\na: if l = '() goto b else c;\nb: return 'empty;\nc: return hd(l);", gogen.Options{Package: "p"}, []string{
+			"func F(l Value) Value {",
+			`if fclInfix("=", l, f_data0).(bool) {`,
+			`return Symbol("empty")`,
+			"var f_data0 = List{}",
+		}},
+		{"strings", "f(s);\na: n := strlen(s);\n   return concat(s, \"!\");", gogen.Options{Package: "p"}, []string{
+			"func F(s string) string {",
+			`return s + "!"`,
+		}},
+		{"maybe unset", "f(x);\na: if x goto b else c;\nb: y := 1;\n   goto c;\nc: return y;", gogen.Options{Package: "p"}, []string{
+			"var y Value",
+			`return fclGet(y, "identifier not found: y at 5:10")`,
+		}},
+		{"big", "f(n);\na: if n < 2 goto b else c;\nb: return 99999999999999999999;\nc: return n % 2 + 1;", gogen.Options{Package: "p"}, []string{
+			"func F(n int64) Value {",
+			`return fclBig("99999999999999999999")`,
+			"return fclAdd(fclMod(n, 2), 1)",
+		}},
+		{"names", "f(len, Symbol);\nrange: a_b := len + Symbol;\n   goto range;", gogen.Options{Package: "p"}, []string{
+			"func F(_len int64, _Symbol int64) Value {",
+			"_range:\n\ta_b = fclAdd(_len, _Symbol)\n\tgoto _range",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := gogen.Generate(parse(t, tt.program), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(src), want) {
+					t.Errorf("missing %q in\n%s", want, src)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	genext, err := generator.New(parser.New(lexer.New(pow))).Gen([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		program *ast.Program
+		opts    gogen.Options
+		want    string
+	}{
+		{"generating extension", genext, gogen.Options{Package: "p"}, "cannot be translated to Go"},
+		{"function name", parse(t, pow), gogen.Options{Package: "p", Func: "pow"}, "not an exported Go name"},
+		{"package name", parse(t, pow), gogen.Options{Package: "a-b"}, "not a Go package name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := gogen.Generate(tt.program, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// goValue writes obj as a Go expression of the runtime in package pkg.
+func goValue(pkg string, obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return fmt.Sprintf("int64(%d)", obj.Value)
+	case *object.String:
+		return strconv.Quote(obj.Value)
+	case *object.Boolean:
+		return strconv.FormatBool(obj.Value)
+	case *object.Symbol:
+		return fmt.Sprintf("%s.Symbol(%q)", pkg, obj.Value)
+	case *object.List:
+		elems := make([]string, len(obj.Value))
+		for i, elem := range obj.Value {
+			elems[i] = goValue(pkg, elem)
+		}
+		return pkg + ".List{" + strings.Join(elems, ", ") + "}"
+	}
+	panic(fmt.Sprintf("no Go value for %s", obj))
+}
+
+// TestBuild compiles the generated code with the go command, vets it and
+// checks that it gives what the evaluator gives.
+func TestBuild(t *testing.T) {
+	gocmd, err := exec.LookPath("go")
+	if err != nil || testing.Short() {
+		t.Skip("needs the go command")
+	}
+	turing, err := os.ReadFile("../turing_machine.fcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genext, err := generator.New(parser.New(lexer.New(pow))).Gen([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 5})
+	residual := evaluator.New(genext).Eval(genext, env)
+
+	programs := []struct {
+		fn      string
+		program string
+		runs    [][]string
+	}{
+		{"Pow", pow, [][]string{{"2", "10"}, {"3", "0"}, {"2", "62"}}},
+		{"Pow_5", residual.String(), [][]string{{"3"}}},
+		{"Ackermann", `ack(m, n);
+ack: if m = 0 goto done else next;
+next: if n = 0 goto ack0 else ack1;
+done: return n + 1;
+ack0: n := 1;
+      goto ack2;
+ack1: n := n - 1;
+      n := call ack;
+      goto ack2;
+ack2: m := m - 1;
+      n := call ack;
+      return n;`, [][]string{{"2", "3"}}},
+		{"Turing", string(turing), [][]string{{"'((0 if 0 goto 3) (1 right) (2 goto 0) (3 write 1))", "'(1 1 0 1 0)"}}},
+		{"Greet", `greet(name, who);
+init: prefix := concat("Hello, ", symbol->string(who));
+      if strlen(name) > 3 goto long else short;
+long: return concat(prefix, " \"", substr(name, 0, 3), "\"\n");
+short: return concat(prefix, "\t", name);`, [][]string{{`"Al"`, "'bob"}, {`"Alexander"`, "'bob"}}},
+		{"Logic", `f(x, l);
+a: y := list(x and false, x or hd(l), !x, not (l = '(1 a)), l != '(2), -3 % 2);
+   y;`, [][]string{{"true", "'(1 b)"}, {"false", "'(5)"}}},
+		{"Unset", "f(x);\na: if x goto b else c;\nb: y := 1;\n   goto c;\nc: return y;", [][]string{{"true"}, {"false"}}},
+		{"Fail", "f(x);\ninit: y := call a;\n  return y;\na: z := call b;\n  return z;\nb: return x + hd(x);", [][]string{{"'()"}}},
+		{"Div", "f(a, b);\ns: return a / b;", [][]string{{"7", "-2"}, {"1", "0"}, {"-9223372036854775808", "-1"}}},
+		{"Big", `f(x);
+a: y := 99999999999999999999 - x;
+   return list(y, y / 3, y % 7, -y, y > x, x - y, y - 99999999999999999990, '(99999999999999999999) = list(y + x));`, [][]string{{"5"}, {"-9223372036854775808"}}},
+	}
+
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module build\n\ngo 1.24\n")
+	write("progs/fcl_runtime.go", string(gogen.Runtime("progs")))
+
+	var main strings.Builder
+	main.WriteString(`package main
+
+import (
+	"build/progs"
+	"fmt"
+)
+
+func run(f func() progs.Value) (out string) {
+	defer func() {
+		if err, ok := recover().(*progs.Error); ok {
+			out = "ERROR: " + err.Message
+		}
+	}()
+	return progs.Format(f())
+}
+
+func main() {
+`)
+	var want []string
+	for _, p := range programs {
+		program := parse(t, p.program)
+		src, err := gogen.Generate(program, gogen.Options{Package: "progs", Func: p.fn})
+		if err != nil {
+			t.Fatalf("%s: %v", p.fn, err)
+		}
+		write("progs/"+strings.ToLower(p.fn)+".go", string(src))
+		for _, args := range p.runs {
+			env, err := evaluator.BindArguments(program, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, evaluator.Eval(context.Background(), program, env, evaluator.Options{}).String())
+
+			var goArgs []string
+			for _, arg := range args {
+				val, err := evaluator.ParseArgument(arg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				goArgs = append(goArgs, goValue("progs", val))
+			}
+			fmt.Fprintf(&main, "\tfmt.Println(run(func() progs.Value { return progs.%s(%s) }))\n", p.fn, strings.Join(goArgs, ", "))
+		}
+	}
+	// Past int64 the code goes on with big integers, as the evaluator does.
+	main.WriteString("\tfmt.Println(run(func() progs.Value { return progs.Pow(2, 100) }))\n")
+	want = append(want, "1267650600228229401496703205376")
+	main.WriteString("}\n")
+	write("main.go", main.String())
+
+	for _, args := range [][]string{{"vet", "./..."}, {"run", "."}} {
+		cmd := exec.Command(gocmd, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("go %s: %v\n%s", args[0], err, out)
+		}
+		if args[0] != "run" {
+			continue
+		}
+		got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+		if len(got) != len(want) {
+			t.Fatalf("got %d results, want %d:\n%s", len(got), len(want), out)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("run %d: Go gave %s, the evaluator %s", i, got[i], want[i])
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"cogen/token"
+	"strings"
 )
 
 const (
@@ -18,16 +19,25 @@ type Lexer interface {
 	NextToken() token.Token
 	GetLine() int
 	GetColumn() int
+	GetOffset() int
+	GetFile() string
 	GetInput() string
+	Dialect() token.Dialect
+	// Comments returns the comments scanned since the previous call, in
+	// source order, and forgets them.
+	Comments() []token.Token
 }
 
 type DefaultLexer struct {
+	file     string
 	input    string
+	dialect  token.Dialect
 	stack    []LexerState
 	position int
 	ch       byte
 	line     int
 	column   int
+	comments []token.Token
 }
 
 func (l *DefaultLexer) GetInput() string {
@@ -48,14 +58,34 @@ func (l *DefaultLexer) currentState() *LexerState {
 	return &l.stack[len(l.stack)-1]
 }
 
-func New(input string) *DefaultLexer {
-	l := &DefaultLexer{input: input, line: 1, column: -1}
+// New returns a lexer for input. An optional dialect selects another
+// syntax, such as token.BookDialect for programs copied from the book.
+func New(input string, dialect ...token.Dialect) *DefaultLexer {
+	return NewFile("", input, dialect...)
+}
+
+// NewFile returns a lexer whose tokens record the given file name.
+func NewFile(file string, input string, dialect ...token.Dialect) *DefaultLexer {
+	l := &DefaultLexer{file: file, input: input, line: 1, column: -1}
+	if len(dialect) > 0 {
+		l.dialect = dialect[0]
+	}
 	l.position = -1
 	l.stack = []LexerState{{mode: ModeInitial, parenDepth: 0}}
 	l.readChar()
 	return l
 }
 
+func (l *DefaultLexer) Dialect() token.Dialect {
+	return l.dialect
+}
+
+func (l *DefaultLexer) Comments() []token.Token {
+	comments := l.comments
+	l.comments = nil
+	return comments
+}
+
 func (l *DefaultLexer) GetLine() int {
 	return l.line
 }
@@ -64,6 +94,25 @@ func (l *DefaultLexer) GetColumn() int {
 	return l.column
 }
 
+func (l *DefaultLexer) GetOffset() int {
+	return l.position
+}
+
+func (l *DefaultLexer) GetFile() string {
+	return l.file
+}
+
+func (l *DefaultLexer) pos() token.Pos {
+	return token.Pos{Offset: l.position, Line: l.line, Column: l.column}
+}
+
+// startingAt moves tok to start, for tokens created after reading past
+// their first character.
+func startingAt(tok token.Token, start token.Pos) token.Token {
+	tok.Offset, tok.Line, tok.Column = start.Offset, start.Line, start.Column
+	return tok
+}
+
 func (l *DefaultLexer) readChar() {
 	readPosition := l.position + 1
 	if readPosition >= len(l.input) {
@@ -82,26 +131,36 @@ func (l *DefaultLexer) readChar() {
 }
 
 func (l *DefaultLexer) peakChar() byte {
-	if l.position+1 >= len(l.input) {
+	return l.peakCharAt(1)
+}
+
+func (l *DefaultLexer) peakCharAt(n int) byte {
+	if l.position+n >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.position+1]
+		return l.input[l.position+n]
 	}
 }
 
 func (l *DefaultLexer) NextToken() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
+	if illegal, ok := l.skipTrivia(); !ok {
+		return illegal
+	}
+
+	state := l.currentState()
 
 	if l.ch == '\'' {
-		l.pushState(ModeQuoted)
+		// A quote inside quoted data is part of the same datum, so only
+		// the outermost quote starts a quoted context.
+		if state.mode != ModeQuoted {
+			l.pushState(ModeQuoted)
+		}
 		tok := newToken(l, token.QUOTE, '\'')
 		l.readChar()
 		return tok
 	}
 
-	state := l.currentState()
-
 	if state.mode == ModeQuoted {
 		return l.lexQuoted(state)
 	}
@@ -118,9 +177,23 @@ func (l *DefaultLexer) NextToken() token.Token {
 	case '=':
 		tok = newToken(l, token.EQUAL, '=')
 	case '<':
-		tok = newToken(l, token.LESSTHAN, '<')
+		if l.peakChar() == '=' {
+			start := l.pos()
+			l.readChar()
+			tok = startingAt(newToken(l, token.LESSEQUAL, "<="), start)
+		} else {
+			tok = newToken(l, token.LESSTHAN, '<')
+		}
 	case '>':
-		tok = newToken(l, token.GREATERTHAN, '>')
+		if l.peakChar() == '=' {
+			start := l.pos()
+			l.readChar()
+			tok = startingAt(newToken(l, token.GREATEREQ, ">="), start)
+		} else {
+			tok = newToken(l, token.GREATERTHAN, '>')
+		}
+	case '%':
+		tok = newToken(l, token.PERCENT, '%')
 	case '-':
 		tok = newToken(l, token.SUB, '-')
 	case '+':
@@ -128,40 +201,37 @@ func (l *DefaultLexer) NextToken() token.Token {
 	case '*':
 		tok = newToken(l, token.ASTERISK, '*')
 	case '"':
-		tok = newToken(l, token.DOUBLEQUOTE, '"')
+		start := l.pos()
+		return startingAt(newToken(l, token.STRING, l.readString()), start)
 	case '/':
 		tok = newToken(l, token.SLASH, '/')
 	case ':':
 		// We have to first take care of the : := situation
 		if l.peakChar() == '=' {
-			col := l.column
+			start := l.pos()
 			ch := l.ch
 			l.readChar()
-			tok = newToken(l, token.ASSIGN, string(ch)+string(l.ch))
-			tok.Column = col
+			tok = startingAt(newToken(l, token.ASSIGN, string(ch)+string(l.ch)), start)
 		} else {
 			tok = newToken(l, token.COLON, ':')
 		}
 	case '!':
 		// We have to first take care of the : := situation
 		if l.peakChar() == '=' {
-			col := l.column
+			start := l.pos()
 			ch := l.ch
 			l.readChar()
-			tok = newToken(l, token.NOT_EQUAL, string(ch)+string(l.ch))
-			tok.Column = col
+			tok = startingAt(newToken(l, token.NOT_EQUAL, string(ch)+string(l.ch)), start)
 		} else {
 			tok = newToken(l, token.BANG, '!')
 		}
 	case 0:
 		tok = newToken(l, token.EOF, "")
 	default:
-		col := l.column
+		start := l.pos()
 		if isLetter(l.ch) {
 			literal := l.readIdentifier()
-			tok = newToken(l, token.LookupIdent(literal), literal)
-			tok.Column = col
-			return tok
+			return startingAt(newToken(l, token.LookupIdent(literal), literal), start)
 		} else if isDigit(l.ch) {
 			position := l.position
 			for isDigit(l.ch) {
@@ -170,24 +240,18 @@ func (l *DefaultLexer) NextToken() token.Token {
 
 			// CHECK: Did we stop because of a letter or hyphen?
 			// If so, this is a Mixed Identifier (e.g. "1-ack"), not a Number.
-			if isLetter(l.ch) {
+			if isLetter(l.ch) || l.isBookHyphen() {
 				// Continue reading as an identifier
-				for isLetter(l.ch) || isDigit(l.ch) {
-					l.readChar()
-				}
+				l.readIdentifierRest()
 
 				// Return as IDENT
 				literal := l.input[position:l.position]
-				tok = newToken(l, token.LookupIdent(literal), literal)
-				tok.Column = col
-				return tok
+				return startingAt(newToken(l, token.LookupIdent(literal), literal), start)
 			}
 
 			// Otherwise, it really is just a Number
 			literal := l.input[position:l.position]
-			tok = newToken(l, token.NUMBER, literal)
-			tok.Column = col
-			return tok
+			return startingAt(newToken(l, token.NUMBER, literal), start)
 		} else {
 			tok = newToken(l, token.ILLEGAL, l.ch)
 		}
@@ -216,14 +280,24 @@ func (l *DefaultLexer) lexQuoted(state *LexerState) token.Token {
 		l.popState()
 		return newToken(l, token.EOF, "")
 	default:
-		if isDigit(l.ch) {
-			tok = newToken(l, token.NUMBER, l.readNumber())
+		start := l.pos()
+		if l.ch == '"' {
+			tok = startingAt(newToken(l, token.STRING, l.readString()), start)
 		} else if isQuotedChar(l.ch) {
-			// Read the symbol (e.g., 'stop' or 'cont')
-			tok = newToken(l, token.SYMBOL, l.readQuoted())
+			// Read the atom (e.g., 'stop, '-1 or 'true)
+			atom := l.readQuoted()
+			tok = startingAt(newToken(l, quotedAtomType(atom), atom), start)
+		} else if state.parenDepth == 0 {
+			// Nothing was quoted, e.g. ';. Lex the character normally
+			// and let the parser report the missing datum.
+			l.popState()
+			return l.NextToken()
+		} else {
+			tok = newToken(l, token.ILLEGAL, l.ch)
+			l.readChar()
 		}
 
-		// If we aren't inside a list (parenDepth 0), a single symbol
+		// If we aren't inside a list (parenDepth 0), a single atom
 		// ends the quoted context (e.g., 'stop )
 		if state.parenDepth == 0 {
 			l.popState()
@@ -232,6 +306,24 @@ func (l *DefaultLexer) lexQuoted(state *LexerState) token.Token {
 	return tok
 }
 
+// quotedAtomType classifies an atom of quoted data. Integers and booleans
+// read as themselves, everything else is a symbol.
+func quotedAtomType(atom string) token.TokenType {
+	if atom == "true" || atom == "false" {
+		return token.LookupIdent(atom)
+	}
+	digits := strings.TrimPrefix(atom, "-")
+	if digits == "" {
+		return token.SYMBOL
+	}
+	for i := 0; i < len(digits); i++ {
+		if !isDigit(digits[i]) {
+			return token.SYMBOL
+		}
+	}
+	return token.NUMBER
+}
+
 func (l *DefaultLexer) readQuoted() string {
 	position := l.position
 	for isQuotedChar(l.ch) {
@@ -242,18 +334,114 @@ func (l *DefaultLexer) readQuoted() string {
 
 func (l *DefaultLexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) || isDigit(l.ch) {
+	l.readIdentifierRest()
+	return l.input[position:l.position]
+}
+
+// readIdentifierRest reads the remaining characters of an identifier.
+func (l *DefaultLexer) readIdentifierRest() {
+	for {
+		switch {
+		case isLetter(l.ch) || isDigit(l.ch):
+			l.readChar()
+		case l.ch == '-' && l.peakChar() == '>' && isLetter(l.peakCharAt(2)):
+			// Conversion names such as symbol->string. "->" is never valid
+			// between two operands, so this cannot swallow an expression.
+			l.readChar()
+			l.readChar()
+		case l.isBookHyphen():
+			l.readChar()
+		case l.dialect == token.BookDialect && l.ch == '?':
+			// Predicates such as done? end at the question mark.
+			l.readChar()
+			return
+		default:
+			return
+		}
+	}
+}
+
+// isBookHyphen reports whether the current '-' joins two parts of a book
+// name such as 1-init-m.
+func (l *DefaultLexer) isBookHyphen() bool {
+	next := l.peakChar()
+	return l.dialect == token.BookDialect && l.ch == '-' && (isLetter(next) || isDigit(next))
+}
+
+// readString reads a string literal including its quotes. Escapes are kept
+// as written and decoded by the parser. The literal ends at the closing
+// quote, or unterminated at the end of the line or input.
+func (l *DefaultLexer) readString() string {
+	position := l.position
+	l.readChar()
+	for l.ch != '"' {
+		if l.ch == '\\' && l.peakChar() != '\n' && l.peakChar() != 0 {
+			l.readChar()
+		} else if l.ch == '\n' || l.ch == 0 {
+			return l.input[position:l.position]
+		}
 		l.readChar()
 	}
+	l.readChar()
 	return l.input[position:l.position]
 }
 
-func (l *DefaultLexer) readNumber() string {
+// skipTrivia skips whitespace and comments, recording the comments so the
+// parser can attach them to the surrounding nodes. Comments may stand
+// wherever whitespace may, inside quoted data too, so a symbol cannot
+// start with // or /*. An unterminated block comment is reported as an
+// ILLEGAL token.
+func (l *DefaultLexer) skipTrivia() (token.Token, bool) {
+	for {
+		l.skipWhitespace()
+		if l.ch != '/' {
+			return token.Token{}, true
+		}
+		switch l.peakChar() {
+		case '/':
+			l.comments = append(l.comments, l.readLineComment())
+		case '*':
+			comment, ok := l.readBlockComment()
+			if !ok {
+				comment.Type = token.ILLEGAL
+				return comment, false
+			}
+			l.comments = append(l.comments, comment)
+		default:
+			return token.Token{}, true
+		}
+	}
+}
+
+// readLineComment reads a // comment up to, but not including, the newline.
+func (l *DefaultLexer) readLineComment() token.Token {
+	tok := newToken(l, token.COMMENT, "")
 	position := l.position
-	for isDigit(l.ch) {
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	tok.Literal = strings.TrimRight(l.input[position:l.position], "\r")
+	return tok
+}
+
+// readBlockComment reads a /* */ comment. Block comments do not nest.
+func (l *DefaultLexer) readBlockComment() (token.Token, bool) {
+	tok := newToken(l, token.COMMENT, "")
+	position := l.position
+	// Move past the opening /*
+	l.readChar()
+	l.readChar()
+	for !(l.ch == '*' && l.peakChar() == '/') {
+		if l.ch == 0 {
+			tok.Literal = l.input[position:l.position]
+			return tok, false
+		}
+		l.readChar()
+	}
+	l.readChar()
+	l.readChar()
+	tok.Literal = l.input[position:l.position]
+	return tok, true
 }
 
 func (l *DefaultLexer) skipWhitespace() {
@@ -263,7 +451,7 @@ func (l *DefaultLexer) skipWhitespace() {
 }
 
 func isQuotedChar(ch byte) bool {
-	return !(isEndLine(ch) || isWhitespace(ch) || (ch == '\'') || (ch == '(') || (ch == ')') || (ch == ','))
+	return !(ch == 0 || isEndLine(ch) || isWhitespace(ch) || (ch == '\'') || (ch == '"') || (ch == '(') || (ch == ')') || (ch == ','))
 }
 
 func isEndLine(ch byte) bool {
@@ -285,7 +473,7 @@ func isWhitespace(ch byte) bool {
 func newToken[T rune | string | byte](l Lexer, tokenType token.TokenType, ch T) token.Token {
 	lit := string(ch)
 	return token.Token{Type: tokenType, Literal: lit, Line: l.GetLine(),
-		Column: l.GetColumn()}
+		Column: l.GetColumn(), Offset: l.GetOffset(), File: l.GetFile()}
 }
 
 func isLetter(ch byte) bool {
@@ -203,6 +203,218 @@ func TestNotEqual(t *testing.T) {
 	testEquality(l, tests, t)
 }
 
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	input := "a <= b >= c % d and not e or f < g;"
+	l := New(input)
+	tests := []test{
+		{token.IDENT, "a"},
+		{token.LESSEQUAL, "<="},
+		{token.IDENT, "b"},
+		{token.GREATEREQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "and"},
+		{token.NOT, "not"},
+		{token.IDENT, "e"},
+		{token.OR, "or"},
+		{token.IDENT, "f"},
+		{token.LESSTHAN, "<"},
+		{token.IDENT, "g"},
+		{token.SEMICOLON, ";"},
+	}
+	testEquality(l, tests, t)
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `s := concat("a, b", "say \"hi\"\n", symbol->string(x)) "open
+;`
+	l := New(input)
+	tests := []test{
+		{token.IDENT, "s"},
+		{token.ASSIGN, ":="},
+		{token.IDENT, "concat"},
+		{token.LPAREN, "("},
+		{token.STRING, `"a, b"`},
+		{token.COMMA, ","},
+		{token.STRING, `"say \"hi\"\n"`},
+		{token.COMMA, ","},
+		{token.IDENT, "symbol->string"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.RPAREN, ")"},
+		// unterminated, ends at the newline
+		{token.STRING, `"open`},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	testEquality(l, tests, t)
+}
+
+func TestQuotedSymbolAtEOF(t *testing.T) {
+	l := New("'bob")
+	tests := []test{
+		{token.QUOTE, "'"},
+		{token.SYMBOL, "bob"},
+		{token.EOF, ""},
+	}
+	testEquality(l, tests, t)
+}
+
+func TestQuotedDatum(t *testing.T) {
+	input := `'(-1 2 - -x true "a b" 'y ( ) 3a);`
+	l := New(input)
+	tests := []test{
+		{token.QUOTE, "'"},
+		{token.LPAREN, "("},
+		{token.NUMBER, "-1"},
+		{token.NUMBER, "2"},
+		{token.SYMBOL, "-"},
+		{token.SYMBOL, "-x"},
+		{token.TRUE, "true"},
+		{token.STRING, `"a b"`},
+		{token.QUOTE, "'"},
+		{token.SYMBOL, "y"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.SYMBOL, "3a"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	testEquality(l, tests, t)
+}
+
+func TestNestedQuoteEndsDatum(t *testing.T) {
+	l := New("x := ''a; y := ';")
+	tests := []test{
+		{token.IDENT, "x"},
+		{token.ASSIGN, ":="},
+		{token.QUOTE, "'"},
+		{token.QUOTE, "'"},
+		{token.SYMBOL, "a"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, ":="},
+		{token.QUOTE, "'"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	testEquality(l, tests, t)
+}
+
+func TestBookDialect(t *testing.T) {
+	input := "read m, n;\n1-init-m: if done?(x) goto end-2 else 3; n := n - 1;"
+	l := New(input, token.BookDialect)
+	tests := []test{
+		{token.IDENT, "read"},
+		{token.IDENT, "m"},
+		{token.COMMA, ","},
+		{token.IDENT, "n"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "1-init-m"},
+		{token.COLON, ":"},
+		{token.IF, "if"},
+		{token.IDENT, "done?"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.GOTO, "goto"},
+		{token.IDENT, "end-2"},
+		{token.ELSE, "else"},
+		{token.NUMBER, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "n"},
+		{token.ASSIGN, ":="},
+		{token.IDENT, "n"},
+		{token.SUB, "-"},
+		{token.NUMBER, "1"},
+		{token.SEMICOLON, ";"},
+	}
+	testEquality(l, tests, t)
+
+	// The default dialect keeps reading - as subtraction.
+	l = New("1-init-m")
+	testEquality(l, []test{
+		{token.NUMBER, "1"},
+		{token.SUB, "-"},
+		{token.IDENT, "init"},
+		{token.SUB, "-"},
+		{token.IDENT, "m"},
+	}, t)
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+x := 1; // trailing
+/* block
+   comment */ y / 2;`
+	l := New(input)
+	tests := []test{
+		{token.IDENT, "x"},
+		{token.ASSIGN, ":="},
+		{token.NUMBER, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "y"},
+		{token.SLASH, "/"},
+		{token.NUMBER, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	expectedComments := [][]string{
+		{"// header"}, nil, nil, nil,
+		{"// trailing", "/* block\n   comment */"},
+		nil, nil, nil, nil,
+	}
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		comments := l.Comments()
+		if len(comments) != len(expectedComments[i]) {
+			t.Fatalf("tests[%d] - expected %d comments, got %d", i, len(expectedComments[i]), len(comments))
+		}
+		for j, c := range comments {
+			if c.Type != token.COMMENT || c.Literal != expectedComments[i][j] {
+				t.Fatalf("tests[%d] - comment wrong. expected=%q, got=%q", i, expectedComments[i][j], c.Literal)
+			}
+		}
+	}
+}
+
+// TestCommentsInQuotedData pins that comments are trivia inside quoted
+// data as well, so // and /* never start a symbol.
+func TestCommentsInQuotedData(t *testing.T) {
+	l := New("x := '(a //b\n /*c*/ d/e);")
+	tests := []test{
+		{token.IDENT, "x"},
+		{token.ASSIGN, ":="},
+		{token.QUOTE, "'"},
+		{token.LPAREN, "("},
+		{token.SYMBOL, "a"},
+		{token.SYMBOL, "d/e"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	testEquality(l, tests, t)
+	comments := l.Comments()
+	if len(comments) != 2 || comments[0].Literal != "//b" || comments[1].Literal != "/*c*/" {
+		t.Fatalf("expected the comments //b and /*c*/, got %v", comments)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("x /* never closed")
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("expected ILLEGAL token, got %q", tok.Type)
+	}
+}
+
 func testEquality(l Lexer, tests []test, t *testing.T) {
 	for i, tt := range tests {
 		tok := l.NextToken()
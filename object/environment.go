@@ -44,3 +44,18 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env.outer = outer
 	return env
 }
+
+// Vars returns a copy of the variables set in e itself, not in the
+// environments it encloses.
+func (e *Environment) Vars() map[string]Object {
+	vars := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		vars[name] = value
+	}
+	return vars
+}
+
+// Outer returns the environment e encloses, or nil.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
@@ -2,7 +2,10 @@ package object
 
 import (
 	"bytes"
+	"cogen/diagnostics"
 	"fmt"
+	"math/big"
+	"strconv"
 )
 
 type ObjectType int
@@ -36,13 +39,41 @@ type Object interface {
 	String() string
 }
 
+// An Integer is a whole number of any size. One that fits in an int64 is
+// kept in Value, with Big nil; a larger one only in Big. NewInteger keeps
+// to this, so integers can be compared field by field.
 type Integer struct {
 	Value int64
+	Big   *big.Int // the value, if it does not fit in Value; never changed
 }
 
-func (i *Integer) String() string   { return fmt.Sprintf("%d", i.Value) }
+// NewInteger returns the integer v. It does not keep v.
+func NewInteger(v *big.Int) *Integer {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &Integer{Big: new(big.Int).Set(v)}
+}
+
+// BigInt returns the value of i as a new big.Int.
+func (i *Integer) BigInt() *big.Int {
+	if i.Big != nil {
+		return new(big.Int).Set(i.Big)
+	}
+	return big.NewInt(i.Value)
+}
+
+// IsInt64 reports whether the value of i is in Value.
+func (i *Integer) IsInt64() bool { return i.Big == nil }
+
+func (i *Integer) String() string {
+	if i.Big != nil {
+		return i.Big.String()
+	}
+	return strconv.FormatInt(i.Value, 10)
+}
 func (i *Integer) Type() ObjectType { return INTEGER }
-func (i *Integer) GetValue() string { return fmt.Sprint(i.Value) }
+func (i *Integer) GetValue() string { return i.String() }
 
 type Boolean struct {
 	Value bool
@@ -56,8 +87,9 @@ type String struct {
 	Value string
 }
 
+// String prints the value as a literal, so it reads back as the same string.
 func (s *String) String() string {
-	return fmt.Sprintf("%s", s.Value)
+	return strconv.Quote(s.Value)
 }
 func (s *String) Type() ObjectType { return STRING }
 func (s *String) GetValue() string { return s.Value }
@@ -132,11 +164,77 @@ func (rv *ReturnValue) String() string   { return rv.Value.String() }
 
 type Error struct {
 	Message string
+	Code    diagnostics.Code
+	Range   diagnostics.Range // zero if the failing node has no position
+	Label   string            // the label of the block that failed, if a program was running
+	Stack   []CallFrame       // the blocks active when it failed, the failing one first
+}
+
+// A CallFrame is a block that was active when a runtime error happened:
+// its label, and the statement it was at, which for a caller is its call.
+type CallFrame struct {
+	Label string
+	Range diagnostics.Range
 }
 
 func (e *Error) Type() ObjectType { return ERROR }
 func (e *Error) String() string   { return "ERROR: " + e.Message }
 
+func (e *Error) code() diagnostics.Code {
+	if e.Code == "" {
+		return diagnostics.RuntimeError
+	}
+	return e.Code
+}
+
+// Diagnostic converts the runtime error into a diagnostic, with a note at
+// each call that led to it.
+func (e *Error) Diagnostic() diagnostics.Diagnostic {
+	d := diagnostics.Diagnostic{
+		Severity: diagnostics.Error,
+		Code:     e.code(),
+		Message:  e.Message,
+		Range:    e.Range,
+	}
+	for i := 1; i < len(e.Stack); i++ {
+		d.Related = append(d.Related, diagnostics.Note{
+			Message: fmt.Sprintf("%s called from %s", e.Stack[i-1].Label, e.Stack[i].Label),
+			Range:   e.Stack[i].Range,
+		})
+	}
+	return d
+}
+
+// StackTrace describes the error and where it happened, one line per
+// active block:
+//
+//	error[R002]: type mismatch: INTEGER + LIST, for: 1 '()
+//	  at loop (tm.fcl:12:5)
+//	  called from init (tm.fcl:3:2)
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "error[%s]: %s\n", e.code(), e.Message)
+	for i, f := range e.Stack {
+		where := "at"
+		if i > 0 {
+			where = "called from"
+		}
+		fmt.Fprintf(&out, "  %s %s (%s)\n", where, f.Label, position(f.Range))
+	}
+	return out.String()
+}
+
+func position(r diagnostics.Range) string {
+	if r.IsZero() {
+		return "unknown position"
+	}
+	pos := fmt.Sprintf("%d:%d", r.Start.Line, r.Start.Column)
+	if r.File != "" {
+		pos = r.File + ":" + pos
+	}
+	return pos
+}
+
 type CodeOutput struct {
 	Value string
 }
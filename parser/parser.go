@@ -2,16 +2,20 @@ package parser
 
 import (
 	"cogen/ast"
+	"cogen/diagnostics"
 	"cogen/lexer"
 	"cogen/token"
 	"fmt"
+	"math/big"
 	"strconv"
-	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	OR
+	AND
+	NOT // not binds looser than comparisons: not a = b is not (a = b)
 	EQUALS
 	LESSGREATER
 	SUM
@@ -25,10 +29,15 @@ var precedence = map[token.TokenType]int{
 	token.NOT_EQUAL:   EQUALS,
 	token.LESSTHAN:    LESSGREATER,
 	token.GREATERTHAN: LESSGREATER,
+	token.LESSEQUAL:   LESSGREATER,
+	token.GREATEREQ:   LESSGREATER,
 	token.ADD:         SUM,
 	token.SUB:         SUM,
 	token.ASTERISK:    PRODUCT,
 	token.SLASH:       PRODUCT,
+	token.PERCENT:     PRODUCT,
+	token.AND:         AND,
+	token.OR:          OR,
 	token.LPAREN:      FUNCCALL,
 }
 
@@ -38,26 +47,32 @@ type (
 )
 
 type Parser struct {
-	l lexer.Lexer
+	l       lexer.Lexer
+	dialect token.Dialect
 
-	errors []ParserError
+	errors []diagnostics.Diagnostic
+	// panicking is set after a syntax error and suppresses further errors
+	// until the parser has resynchronised on a ; or the next label.
+	panicking bool
+	errToken  token.Token
 
 	curToken  token.Token
 	peakToken token.Token
 
+	// comments read before curToken that are not yet attached to a node,
+	// and the comments read before peakToken.
+	comments     []token.Token
+	peakComments []token.Token
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
-type ParserError struct {
-	Msg   string
-	Token token.Token
-}
-
 func New(l lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []ParserError{},
+		l:       l,
+		dialect: l.Dialect(),
+		errors:  []diagnostics.Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
@@ -71,7 +86,8 @@ func New(l lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.SUB, p.parsePrefixExpression)
-	p.registerPrefix(token.DOUBLEQUOTE, p.parseString)
+	p.registerPrefix(token.NOT, p.parseNotExpression)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
 
 	// infix
 	p.registerInfix(token.ADD, p.parseInfixExpression)
@@ -83,6 +99,11 @@ func New(l lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.LESSTHAN, p.parseInfixExpression)
 	p.registerInfix(token.GREATERTHAN, p.parseInfixExpression)
+	p.registerInfix(token.LESSEQUAL, p.parseInfixExpression)
+	p.registerInfix(token.GREATEREQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -100,7 +121,29 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peakToken
+	p.comments = append(p.comments, p.peakComments...)
 	p.peakToken = p.l.NextToken()
+	p.peakComments = p.l.Comments()
+}
+
+// takeComments returns every comment read up to and including curToken that
+// has not yet been attached to a node.
+func (p *Parser) takeComments() []token.Token {
+	comments := p.comments
+	p.comments = nil
+	return comments
+}
+
+// takeTrailing returns the unattached comments that start on the given line,
+// i.e. the comments following the last token on that line.
+func (p *Parser) takeTrailing(line int) []token.Token {
+	i := 0
+	for i < len(p.comments) && p.comments[i].Line == line {
+		i++
+	}
+	trailing := p.comments[:i]
+	p.comments = p.comments[i:]
+	return trailing
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -122,41 +165,65 @@ func (p *Parser) requirePeak(t token.TokenType) bool {
 	}
 }
 
-func (p *Parser) Errors() []ParserError {
+func (p *Parser) Errors() []diagnostics.Diagnostic {
 	return p.errors
 }
 
+// GetErrorMessage renders every syntax error with the offending source line
+// underlined.
 func (p *Parser) GetErrorMessage() string {
-	lines := strings.Split(p.l.GetInput(), "\n")
-	msg := ""
-	err := p.errors[0]
-	line := lines[err.Token.Line-1]
+	return diagnostics.RenderText(p.l.GetInput(), p.errors)
+}
 
-	// Print offending line with ~ underline
-	endCol := err.Token.Column + len(err.Token.Literal)
-	underline := strings.Repeat(" ", err.Token.Column) + strings.Repeat("~", endCol-err.Token.Column)
-	msg += line + "\n"
-	msg += underline + "\n"
+// Source returns the text being parsed.
+func (p *Parser) Source() string {
+	return p.l.GetInput()
+}
 
-	// Print error
-	msg += fmt.Sprintf("Error at line %d:%d: %s\n\n", err.Token.Line, err.Token.Column, err.Msg)
+// Err returns the syntax errors as a single error, or nil if there are none.
+func (p *Parser) Err() error {
+	if len(p.errors) == 0 {
+		return nil
+	}
+	return &diagnostics.List{Source: p.Source(), Diagnostics: p.errors}
+}
 
-	msg += fmt.Sprintf("Found %d errors, provided only the first.", len(p.errors))
-	return msg
+func (p *Parser) newError(code diagnostics.Code, msg string) {
+	p.errorAt(code, p.curToken, msg)
 }
 
-func (p *Parser) newError(msg string) {
-	p.errors = append(p.errors, ParserError{Msg: msg, Token: p.curToken})
+func (p *Parser) errorAt(code diagnostics.Code, tok token.Token, msg string) {
+	// Anything reported before resynchronising is a consequence of the first
+	// error, so it is dropped.
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errToken = tok
+	p.errors = append(p.errors, diagnostics.New(code, tok, "%s", msg))
 }
 
 func (p *Parser) peakError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s", t, p.peakToken.Type)
-	p.newError(msg)
+	p.errorAt(diagnostics.ExpectedToken, p.peakToken, msg)
+}
+
+// synchronize skips tokens until the current token is a ; or the start of the
+// next label, and leaves panic mode. If toLabel is set, semicolons are skipped
+// as well.
+func (p *Parser) synchronize(toLabel bool) {
+	for !p.curTokenIs(token.EOF) && !p.peakLabel() {
+		if !toLabel && p.curTokenIs(token.SEMICOLON) {
+			break
+		}
+		p.nextToken()
+	}
+	p.panicking = false
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.newError(msg)
+	p.newError(diagnostics.NoPrefixParse, msg)
 }
 
 func (p *Parser) peakPrecedence() int {
@@ -238,40 +305,93 @@ func (p *Parser) parseFunctionHeader() (string, []ast.Input) {
 	return name, variables
 }
 
+// parseReadHeader parses the book dialect header read m, n; and moves to
+// the first token after it.
+func (p *Parser) parseReadHeader() []ast.Input {
+	variables := []ast.Input{}
+	for !p.peakTokenIs(token.SEMICOLON) {
+		if !p.requirePeak(token.IDENT) {
+			return variables
+		}
+		variables = append(variables, ast.Input{Ident: p.requireIdentifier(), Value: ""})
+		if !p.peakTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if p.requirePeak(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return variables
+}
+
+// isReadHeader reports whether the program starts with a book dialect
+// header. A label called read is not one.
+func (p *Parser) isReadHeader() bool {
+	return p.dialect == token.BookDialect && p.curTokenIs(token.IDENT) &&
+		p.curToken.Literal == "read" && !p.peakTokenIs(token.COLON)
+}
+
 func (p *Parser) parseConstant() ast.Expression {
 	stmt := &ast.Constant{Token: p.curToken}
+	p.nextToken()
 
-	switch p.peakToken.Type {
+	stmt.Value = p.parseDatum(0)
+	if stmt.Value == nil {
+		msg := fmt.Sprintf("constant: expected quoted data after ', got %s", p.curToken.Type)
+		p.newError(diagnostics.InvalidConstant, msg)
+		return nil
+	}
+	return stmt
+}
+
+// parseDatum parses a single piece of quoted data: an atom, a list or
+// another quoted datum. It returns nil if the current token starts none.
+func (p *Parser) parseDatum(depth int) ast.Expression {
+	switch p.curToken.Type {
 	case token.LPAREN:
-		p.nextToken()
-		stmt.Value = p.parseConstantList(1)
+		return p.parseConstantList(depth + 1)
+	case token.QUOTE:
+		return p.parseConstant()
+	case token.SYMBOL:
+		return p.parseSymbolExpression()
 	case token.NUMBER:
-		p.nextToken()
-		stmt.Value = p.parseIntegerLiteral()
-	default:
-		p.nextToken()
-		stmt.Value = p.parseSymbolExpression()
+		return p.parseIntegerLiteral()
+	case token.TRUE, token.FALSE:
+		return p.parseBooleanLiteral()
+	case token.STRING:
+		return p.parseStringLiteral()
 	}
-	return stmt
+	return nil
 }
 
-func (p *Parser) parseString() ast.Expression {
-	stmt := &ast.SymbolExpression{Token: p.curToken}
-	p.nextToken()
-	// A string is just a lot of identifiers with space in between.
-	// The end is simply, when we have no more identifiers.
-	value := ""
-	for !p.curTokenIs(token.DOUBLEQUOTE) {
-		// Add space if next token is identifier
-		if p.peakTokenIs(token.DOUBLEQUOTE) {
-			value = value + p.curToken.Literal
-		} else {
-			value = value + p.curToken.Literal + " "
+func (p *Parser) parseStringLiteral() ast.Expression {
+	lit := &ast.StringLiteral{Token: p.curToken}
+
+	value, err := strconv.Unquote(p.curToken.Literal)
+	if err != nil {
+		msg := fmt.Sprintf("invalid escape in string literal %s", p.curToken.Literal)
+		if !isTerminatedString(p.curToken.Literal) {
+			msg = "unterminated string literal"
 		}
-		p.nextToken()
+		p.newError(diagnostics.InvalidString, msg)
+		return nil
 	}
-	stmt.Value = value
-	return stmt
+	lit.Value = value
+	return lit
+}
+
+// isTerminatedString reports whether lit ends in a closing quote that is not
+// itself escaped.
+func isTerminatedString(lit string) bool {
+	if len(lit) < 2 || lit[len(lit)-1] != '"' {
+		return false
+	}
+	backslashes := 0
+	for i := len(lit) - 2; i > 0 && lit[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 0
 }
 
 func (p *Parser) parseSymbolExpression() ast.Expression {
@@ -291,19 +411,14 @@ func (p *Parser) parseConstantList(depth int) ast.Expression {
 	// loop as long as we don't have the closing of the list
 	var value ast.Expression
 	for !p.curTokenIs(token.RPAREN) {
-		switch p.curToken.Type {
-		case token.LPAREN:
-			value = p.parseConstantList(depth + 1)
-		case token.QUOTE:
-			value = p.parseConstant()
-		case token.SYMBOL:
-			value = p.parseSymbolExpression()
-		case token.NUMBER:
-			value = p.parseIntegerLiteral()
+		if p.curTokenIs(token.EOF) {
+			p.newError(diagnostics.InvalidList, "list: unexpected end of input")
+			break
 		}
+		value = p.parseDatum(depth)
 		if value == nil {
 			msg := fmt.Sprintf("list: could not parse %s of type %s", p.curToken.Literal, p.curToken.Type)
-			p.newError(msg)
+			p.newError(diagnostics.InvalidList, msg)
 		}
 
 		// Move over the parsed token
@@ -311,6 +426,9 @@ func (p *Parser) parseConstantList(depth int) ast.Expression {
 		values = append(values, value)
 	}
 	stmt.Value = values
+	if p.curTokenIs(token.RPAREN) {
+		stmt.Rparen = p.curToken
+	}
 	return stmt
 }
 
@@ -325,12 +443,17 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
+	value, ok := new(big.Int).SetString(p.curToken.Literal, 0)
+	if !ok {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.newError(msg)
+		p.newError(diagnostics.InvalidInteger, msg)
+		return lit
+	}
+	if value.IsInt64() {
+		lit.Value = value.Int64()
+	} else {
+		lit.Big = value
 	}
-	lit.Value = value
 	return lit
 }
 
@@ -351,11 +474,18 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.IF:
-		return p.parseIfStatement()
+		// Avoid wrapping a nil *IfStatement in a non-nil interface
+		if stmt := p.parseIfStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	default:
 		// If next token is assign, then take care of it
 		if p.peakTokenIs(token.ASSIGN) {
-			return p.parseAssignmentStatement()
+			if stmt := p.parseAssignmentStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
 		}
 		return p.parseExpressionStatement()
 	}
@@ -364,19 +494,54 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLabelStatement() *ast.LabelStatement {
 	// Update the label to state label
 	label := p.parseLabel()
+	leading := p.takeComments()
 	// Move past the colon
 	if !p.requirePeak(token.COLON) {
 		p.nextToken()
 		return nil
 	}
+	colonLine := p.curToken.Line
 	p.nextToken()
 	labelStmt := &ast.LabelStatement{Token: p.curToken, Label: label}
+	labelStmt.Leading = leading
+	labelStmt.Trailing = p.takeTrailing(colonLine)
 	labelStmt.Statements = []ast.Statement{}
 
 	for !p.peakLabel() && p.curToken.Type != token.EOF {
+		stmtLeading := p.takeComments()
+		errs := len(p.errors)
 		stmt := p.parseStatement()
-		labelStmt.Statements = append(labelStmt.Statements, stmt)
+		if len(p.errors) == errs && !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) && !p.peakLabel() {
+			p.newError(diagnostics.ExpectedSemicolon, fmt.Sprintf("expected ; after statement, got %s", p.curToken.Type))
+		}
+		if len(p.errors) > errs {
+			// Drop the broken statement and resume after the next ;. If the
+			// statement failed on a ; and already stepped over it, we are
+			// at the start of the next statement.
+			if p.errToken.Type == token.SEMICOLON && p.curToken != p.errToken {
+				p.panicking = false
+			} else {
+				p.synchronize(false)
+				if p.curTokenIs(token.SEMICOLON) {
+					p.nextToken()
+				}
+			}
+			p.takeComments()
+			continue
+		}
+		// Comments inside the statement are kept as trailing trivia, together
+		// with the ones following it on the line of its last token.
+		inner := p.takeComments()
+		endLine := p.curToken.Line
 		p.nextToken()
+		if stmt == nil {
+			continue
+		}
+		if c, ok := stmt.(ast.Commented); ok {
+			c.Comments().Leading = stmtLeading
+			c.Comments().Trailing = append(inner, p.takeTrailing(endLine)...)
+		}
+		labelStmt.Statements = append(labelStmt.Statements, stmt)
 	}
 	return labelStmt
 }
@@ -396,13 +561,18 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	// Parse true label
 	stmt.LabelTrue = p.parseLabel()
 	p.nextToken()
-	// skip over else
-	if !p.curTokenIs(token.ELSE) {
+	// skip over else, which the book dialect allows to be left out
+	if p.curTokenIs(token.ELSE) {
+		p.nextToken()
+	} else if p.dialect != token.BookDialect {
 		msg := fmt.Sprintf("expected else, got %s", p.curToken.Type)
-		p.newError(msg)
+		p.newError(diagnostics.ExpectedElse, msg)
+		return nil
+	} else if !p.curTokenIs(token.IDENT) && !p.curTokenIs(token.NUMBER) && !p.curTokenIs(token.GOTO) {
+		msg := fmt.Sprintf("expected else or a label, got %s", p.curToken.Type)
+		p.newError(diagnostics.ExpectedElse, msg)
 		return nil
 	}
-	p.nextToken()
 
 	// Skip over goto, if it is there
 	if p.curTokenIs(token.GOTO) {
@@ -481,6 +651,16 @@ func (p *Parser) ParseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
+// ParseExpressionOnly parses input that holds one expression, such as a
+// watch or a program argument, and reports anything left after it.
+func (p *Parser) ParseExpressionOnly() ast.Expression {
+	exp := p.ParseExpression(LOWEST)
+	if exp != nil && !p.peakTokenIs(token.EOF) {
+		p.peakError(token.EOF)
+	}
+	return exp
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -491,9 +671,22 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseNotExpression() ast.Expression {
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+	p.nextToken()
+	expression.Right = p.ParseExpression(NOT)
+	return expression
+}
+
 func (p *Parser) parsePrimitiveCall(primitive ast.Expression) ast.Expression {
 	exp := &ast.PrimitiveCall{Token: p.curToken, Primitive: primitive}
 	exp.Arguments = p.parseCallArguments()
+	if p.curTokenIs(token.RPAREN) {
+		exp.Rparen = p.curToken
+	}
 	return exp
 }
 
@@ -541,15 +734,26 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{}
+	program := &ast.Program{Dialect: p.dialect}
 	program.Statements = []*ast.LabelStatement{}
-	program.Name, program.Variables = p.parseFunctionHeader()
+	if p.isReadHeader() {
+		program.Leading = p.takeComments()
+		program.Variables = p.parseReadHeader()
+	} else {
+		if p.peakTokenIs(token.LPAREN) {
+			program.Leading = p.takeComments()
+		}
+		program.Name, program.Variables = p.parseFunctionHeader()
+	}
 
 	for p.curToken.Type != token.EOF {
 		stmt := p.parseLabelStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
+		} else {
+			p.synchronize(true)
 		}
 	}
+	program.Trailing = p.takeComments()
 	return program
 }
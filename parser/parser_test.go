@@ -2,7 +2,9 @@ package parser
 
 import (
 	"cogen/ast"
+	"cogen/diagnostics"
 	"cogen/lexer"
+	"cogen/token"
 	"errors"
 	"fmt"
 	"os"
@@ -172,6 +174,88 @@ func TestIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteral(t *testing.T) {
+	tests := []struct {
+		input string
+		small bool
+	}{
+		{"9223372036854775807", true},
+		{"9223372036854775808", false},
+		{"123456789012345678901234567890", false},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New("1: " + tt.input + ";"))
+		program := p.ParseProgram()
+		if err := checkParserErrors(p); err != nil {
+			t.Fatal(err)
+		}
+		stmt := program.Statements[0].Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("%s: not an ast.IntegerLiteral, got %T", tt.input, stmt.Expression)
+		}
+		if (literal.Big == nil) != tt.small {
+			t.Errorf("%s: Big is %v", tt.input, literal.Big)
+		}
+		got := fmt.Sprint(literal.Value)
+		if literal.Big != nil {
+			got = literal.Big.String()
+		}
+		if got != tt.input || literal.String() != tt.input {
+			t.Errorf("%s: parsed as %s, printed as %s", tt.input, got, literal)
+		}
+	}
+}
+
+func TestStringExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		value    string
+		expected string
+	}{
+		{`1: "a, b";`, "a, b", "1: \"a, b\";\n"},
+		{`1: "x := 1";`, "x := 1", "1: \"x := 1\";\n"},
+		{`1: "tab\there \"q\"\n";`, "tab\there \"q\"\n", "1: \"tab\\there \\\"q\\\"\\n\";\n"},
+		{`1: "";`, "", "1: \"\";\n"},
+	}
+	for _, tt := range tests {
+		program := New(lexer.New(tt.input)).ParseProgram()
+		stmt := testLabelStatement(t, program.Statements[0], "1", 1)[0]
+		literal, ok := stmt.(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("expression is not ast.StringLiteral, got %T", stmt.(*ast.ExpressionStatement).Expression)
+		}
+		if literal.Value != tt.value {
+			t.Errorf("expected value %q, got %q", tt.value, literal.Value)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"1: \"open;\n2: 1;", "unterminated string literal"},
+		{`1: "ends in \";`, "unterminated string literal"},
+		{`1: "bad \q";`, `invalid escape in string literal "bad \q"`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Fatalf("expected an error for %q", tt.input)
+		}
+		if errs[0].Code != diagnostics.InvalidString || errs[0].Message != tt.msg {
+			t.Errorf("expected %s %q, got %s %q", diagnostics.InvalidString, tt.msg, errs[0].Code, errs[0].Message)
+		}
+	}
+}
+
 func TestOperatorPrecedenceParsing(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -230,6 +314,30 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"1: 3 + 4 * 5 = 3 * 1 + 4 * 5;",
 			"1: ((3 + (4 * 5)) = ((3 * 1) + (4 * 5)));\n",
 		},
+		{
+			"1: a <= b = c >= d;",
+			"1: ((a <= b) = (c >= d));\n",
+		},
+		{
+			"1: a + b % c * d;",
+			"1: (a + ((b % c) * d));\n",
+		},
+		{
+			"1: a < b and c or d;",
+			"1: (((a < b) and c) or d);\n",
+		},
+		{
+			"1: a or b and c;",
+			"1: (a or (b and c));\n",
+		},
+		{
+			"1: not a = b and c;",
+			"1: ((not (a = b)) and c);\n",
+		},
+		{
+			"1: not not a or b;",
+			"1: ((not (not a)) or b);\n",
+		},
 	}
 	for i, tt := range tests {
 		l := lexer.New(tt.input)
@@ -345,6 +453,172 @@ func TestConstantHard(t *testing.T) {
 	testAssignmentStatement(t, "y", stmt, "(3 + 1)")
 }
 
+func TestConstantDatum(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1: '-1;", "1: '-1;\n"},
+		{"1: '(-1 2);", "1: '(-1 2);\n"},
+		{"1: '(true false);", "1: '(true false);\n"},
+		{`1: '("a, b" c);`, "1: '(\"a, b\" c);\n"},
+		{"1: '(a 'b '(c));", "1: '(a 'b '(c));\n"},
+		{"1: ''a;", "1: ''a;\n"},
+		{"1: '( );", "1: '();\n"},
+		{"1: '(\n\n);", "1: '();\n"},
+		{"1: '( /* nothing */ );", "1: '(); /* nothing */\n"},
+		{"1: '(() (()));", "1: '(() (()));\n"},
+	}
+	for i, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if err := checkParserErrors(p); err != nil {
+			t.Fatalf("error in tests[%d]: %v", i, err)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	// Atoms keep their types inside lists.
+	program := New(lexer.New(`1: '(-1 true "s" x 'y);`)).ParseProgram()
+	stmt := program.Statements[0].Statements[0].(*ast.ExpressionStatement)
+	list := stmt.Expression.(*ast.Constant).Value.(*ast.List)
+	types := []string{"*ast.IntegerLiteral", "*ast.BooleanLiteral", "*ast.StringLiteral", "*ast.SymbolExpression", "*ast.Constant"}
+	for i, want := range types {
+		if got := fmt.Sprintf("%T", list.Value[i]); got != want {
+			t.Errorf("element %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestConstantErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  diagnostics.Code
+		msg   string
+	}{
+		{"1: x := ';", diagnostics.InvalidConstant, "constant: expected quoted data after ', got ;"},
+		{"1: x := '(a, b);", diagnostics.InvalidList, "list: could not parse , of type ILLEGAL"},
+		{"1: x := '(a b", diagnostics.InvalidList, "list: unexpected end of input"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Fatalf("expected an error for %q", tt.input)
+		}
+		if errs[0].Code != tt.code || errs[0].Message != tt.msg {
+			t.Errorf("expected %s %q, got %s %q", tt.code, tt.msg, errs[0].Code, errs[0].Message)
+		}
+	}
+}
+
+func TestBookDialect(t *testing.T) {
+	input := `read m, n;
+1-init: result := 1;
+        goto test?;
+test?: if n < 1 goto end else loop-body;
+loop-body: result := result * m;
+        n := n - 1;
+        if n < 1 end goto test?;
+end: return result;
+`
+	p := New(lexer.New(input, token.BookDialect))
+	program := p.ParseProgram()
+	if err := checkParserErrors(p); err != nil {
+		t.Fatal(err)
+	}
+	if program.Name != "" || len(program.Variables) != 2 {
+		t.Fatalf("expected a nameless program reading 2 variables, got %q with %d", program.Name, len(program.Variables))
+	}
+	testIdentifier(t, program.Variables[1].Ident, "n")
+
+	book := `read m, n;
+1-init: result := 1;
+	goto test?;
+test?: if (n < 1) goto end else loop-body;
+loop-body: result := (result * m);
+	n := (n - 1);
+	if (n < 1) goto end else test?;
+end: return result;
+`
+	if program.String() != book {
+		t.Fatalf("book dialect printed wrong.\nExpected:\n%s\nGot:\n%s", book, program.String())
+	}
+
+	program.SetDialect(token.DefaultDialect)
+	def := `main(m, n):
+1_init: result := 1;
+	goto test_p;
+test_p: if (n < 1) end else loop_body;
+loop_body: result := (result * m);
+	n := (n - 1);
+	if (n < 1) end else test_p;
+end: return result;
+`
+	if program.String() != def {
+		t.Fatalf("default dialect printed wrong.\nExpected:\n%s\nGot:\n%s", def, program.String())
+	}
+
+	// The default rendering parses back as the same program.
+	p = New(lexer.New(def))
+	again := p.ParseProgram()
+	if err := checkParserErrors(p); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != def {
+		t.Fatalf("default rendering does not round-trip, got:\n%s", again.String())
+	}
+
+	// And back to the book dialect.
+	again.SetDialect(token.BookDialect)
+	p = New(lexer.New(again.String(), token.BookDialect))
+	if p.ParseProgram(); len(p.Errors()) != 0 {
+		t.Fatalf("book rendering does not parse:\n%s", p.GetErrorMessage())
+	}
+}
+
+// TestBookDialectCollisions checks that book names spelled alike in the
+// default dialect stay apart.
+func TestBookDialectCollisions(t *testing.T) {
+	input := `read a-b, a_b;
+done?: done_p := a-b;
+  goto done_p;
+done_p: return list(done_p, a_b);
+`
+	p := New(lexer.New(input, token.BookDialect))
+	program := p.ParseProgram()
+	if err := checkParserErrors(p); err != nil {
+		t.Fatal(err)
+	}
+	program.SetDialect(token.DefaultDialect)
+	def := `main(a_b_2, a_b):
+done_p_2: done_p := a_b_2;
+	goto done_p;
+done_p: return list(done_p, a_b);
+`
+	if program.String() != def {
+		t.Fatalf("default dialect printed wrong.\nExpected:\n%s\nGot:\n%s", def, program.String())
+	}
+}
+
+func TestBookDialectErrors(t *testing.T) {
+	// Only the book dialect may leave out else.
+	p := New(lexer.New("1: if x goto a b;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0].Code != diagnostics.ExpectedElse {
+		t.Fatalf("expected %s in the default dialect, got %v", diagnostics.ExpectedElse, p.Errors())
+	}
+
+	p = New(lexer.New("read m n;\n1: return m;", token.BookDialect))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0].Message != "expected next token to be ;, got IDENT" {
+		t.Fatalf("expected a missing ; in the read header, got %v", p.Errors())
+	}
+}
+
 func TestAckermannFunc(t *testing.T) {
 	input := `
 		ack (m, n);
@@ -428,6 +702,139 @@ func TestTuring(t *testing.T) {
 
 }
 
+func TestCommentTrivia(t *testing.T) {
+	input := `// Computes m^n
+pow(m, n);
+// setup
+init: result := 1; // start at one
+	goto test;
+test: // guard
+	if (n < 1) end else loop;
+loop: result := (result * m);
+	/* decrement */
+	n := (n - 1);
+	goto test;
+end: return result;
+// end of file
+`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	if err := checkParserErrors(p); err != nil {
+		t.Fatal(err)
+	}
+
+	init := program.Statements[0]
+	if len(init.Leading) != 1 || init.Leading[0].Literal != "// setup" {
+		t.Fatalf("expected leading comment on init, got %v", init.Leading)
+	}
+	assign := init.Statements[0].(*ast.AssignmentStatement)
+	if len(assign.Trailing) != 1 || assign.Trailing[0].Literal != "// start at one" {
+		t.Fatalf("expected trailing comment on assignment, got %v", assign.Trailing)
+	}
+	if len(program.Statements[1].Trailing) != 1 {
+		t.Fatalf("expected trailing comment on label test, got %v", program.Statements[1].Trailing)
+	}
+	n := program.Statements[2].Statements[1].(*ast.AssignmentStatement)
+	if len(n.Leading) != 1 || n.Leading[0].Literal != "/* decrement */" {
+		t.Fatalf("expected leading comment on assignment, got %v", n.Leading)
+	}
+
+	expected := strings.Replace(input, "pow(m, n);", "pow(m, n):", 1)
+	if program.String() != expected {
+		t.Fatalf("comments not preserved.\nExpected:\n%s\nGot:\n%s", expected, program.String())
+	}
+}
+func TestErrorRecovery(t *testing.T) {
+	input := `pow(m, n);
+init: result := ;
+      goto test;
+test: if n < 1 goto end loop;
+loop: result := result * m
+      n := n - 1;
+      goto test;
+end: return result;
+`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []struct {
+		line int
+		code diagnostics.Code
+		msg  string
+	}{
+		{2, diagnostics.NoPrefixParse, "no prefix parse function for ; found"},
+		{4, diagnostics.ExpectedElse, "expected else, got IDENT"},
+		{6, diagnostics.ExpectedSemicolon, "expected ; after statement, got IDENT"},
+	}
+	errs := p.Errors()
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d:\n%s", len(expected), len(errs), p.GetErrorMessage())
+	}
+	for i, tt := range expected {
+		if errs[i].Range.Start.Line != tt.line || errs[i].Code != tt.code || errs[i].Message != tt.msg {
+			t.Errorf("errors[%d]: expected %s %q at line %d, got %s %q at line %d",
+				i, tt.code, tt.msg, tt.line, errs[i].Code, errs[i].Message, errs[i].Range.Start.Line)
+		}
+	}
+
+	// Every label is still found after recovering.
+	if len(program.Statements) != 4 {
+		t.Fatalf("expected 4 label statements, got %d", len(program.Statements))
+	}
+	testGotoStatement(t, program.Statements[0].Statements[0], "test")
+
+	msg := p.GetErrorMessage()
+	if !strings.Contains(msg, "test: if n < 1 goto end loop;\n                        ~~~~\n") {
+		t.Errorf("expected underlined excerpt for each error, got:\n%s", msg)
+	}
+	if !strings.HasSuffix(msg, "Found 3 errors.") {
+		t.Errorf("expected error count at the end, got:\n%s", msg)
+	}
+}
+func TestNodeSpans(t *testing.T) {
+	input := `f(x):
+init: y := cons(x, '(1 2));
+      if y = '() goto done else init;
+done: return -y;`
+	l := lexer.NewFile("f.fcl", input)
+	p := New(l)
+	program := p.ParseProgram()
+	if err := checkParserErrors(p); err != nil {
+		t.Fatal(err)
+	}
+
+	assign := program.Statements[0].Statements[0].(*ast.AssignmentStatement)
+	call := assign.Right.(*ast.PrimitiveCall)
+	ifStmt := program.Statements[0].Statements[1].(*ast.IfStatement)
+	ret := program.Statements[1].Statements[0].(*ast.ReturnStatement)
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{assign, "y := cons(x, '(1 2))"},
+		{call, "cons(x, '(1 2))"},
+		{call.Arguments[1], "'(1 2)"},
+		{ifStmt, "if y = '() goto done else init"},
+		{ifStmt.Cond, "y = '()"},
+		{ret.ReturnValue, "-y"},
+		{program.Statements[1], "done: return -y"},
+	}
+	for _, tt := range tests {
+		span := tt.node.Span()
+		if span.File != "f.fcl" {
+			t.Errorf("%s: expected file f.fcl, got %q", tt.expected, span.File)
+		}
+		if got := input[span.Start.Offset:span.End.Offset]; got != tt.expected {
+			t.Errorf("expected span to cover %q, got %q", tt.expected, got)
+		}
+	}
+
+	if span := call.Span(); span.Start.Line != 2 || span.Start.Column != 11 || span.End.Column != 26 {
+		t.Errorf("wrong line and column for call, got %s", span)
+	}
+}
 
 func checkParserErrors(p *Parser) error {
 	if len(p.Errors()) == 0 {
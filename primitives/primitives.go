@@ -0,0 +1,173 @@
+// Package primitives describes the primitives FCL programs call, such as
+// hd and cons: the inputs each takes, what it computes and how the
+// generator treats a call to it. The evaluator, the VM, the code converter
+// and the generator all look primitives up in a Registry, so a host
+// program can add its own or allow only some of them.
+package primitives
+
+import (
+	"cogen/diagnostics"
+	"cogen/object"
+	"fmt"
+	"sort"
+)
+
+// A Func computes a primitive from its inputs, which the Registry has
+// already counted. It returns an *object.Error if it fails. r is the
+// registry the call went through, for primitives, like cleanOutput, that
+// read code calling other primitives.
+type Func func(r *Registry, args []object.Object) object.Object
+
+// BindingTime says when a generating extension runs a call to a
+// primitive whose inputs are all static.
+type BindingTime int
+
+const (
+	// Static calls run while specializing, when their inputs are known.
+	Static BindingTime = iota
+	// Dynamic calls are always left in the residual program, as Gen is.
+	Dynamic
+)
+
+func (bt BindingTime) String() string {
+	if bt == Static {
+		return "static"
+	}
+	return "dynamic"
+}
+
+// A Primitive is a function built into the language.
+type Primitive struct {
+	Name     string
+	Arity    int  // inputs taken, or the fewest taken if Variadic
+	Variadic bool // takes Arity or more inputs
+	// Pure primitives give the same result for the same inputs and change
+	// nothing else. The generator never runs an impure one early.
+	Pure        bool
+	BindingTime BindingTime
+	Func        Func
+}
+
+// Residual reports whether the generator leaves every call to p in the
+// residual program.
+func (p *Primitive) Residual() bool {
+	return !p.Pure || p.BindingTime == Dynamic
+}
+
+// A Registry is a set of primitives by name. Its zero value is empty and
+// ready to use.
+type Registry struct {
+	prims map[string]*Primitive
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{}
+}
+
+// Register adds p. It fails if p has no name or function, or if a
+// primitive of that name is already registered.
+func (r *Registry) Register(p Primitive) error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("primitive has no name")
+	case p.Func == nil:
+		return fmt.Errorf("primitive %s has no function", p.Name)
+	case p.Arity < 0:
+		return fmt.Errorf("primitive %s takes %d inputs", p.Name, p.Arity)
+	}
+	if _, ok := r.prims[p.Name]; ok {
+		return fmt.Errorf("primitive %s is already registered", p.Name)
+	}
+	if r.prims == nil {
+		r.prims = map[string]*Primitive{}
+	}
+	r.prims[p.Name] = &p
+	return nil
+}
+
+// MustRegister is like Register but panics if p cannot be added.
+func (r *Registry) MustRegister(p Primitive) {
+	if err := r.Register(p); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the primitive called name.
+func (r *Registry) Lookup(name string) (*Primitive, bool) {
+	p, ok := r.prims[name]
+	return p, ok
+}
+
+// Names returns the names of the primitives in r, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.prims))
+	for name := range r.prims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a registry with the primitives of r, to which more can
+// be added without changing r.
+func (r *Registry) Clone() *Registry {
+	c := &Registry{prims: make(map[string]*Primitive, len(r.prims))}
+	for name, p := range r.prims {
+		c.prims[name] = p
+	}
+	return c
+}
+
+// Restrict returns a registry with only the named primitives of r. It
+// fails if r has no primitive of one of the names.
+func (r *Registry) Restrict(names ...string) (*Registry, error) {
+	c := &Registry{prims: make(map[string]*Primitive, len(names))}
+	for _, name := range names {
+		p, ok := r.prims[name]
+		if !ok {
+			return nil, fmt.Errorf("undefined primitive %s", name)
+		}
+		c.prims[name] = p
+	}
+	return c, nil
+}
+
+// Call runs the primitive called name on args. An unknown name or the
+// wrong number of inputs gives an *object.Error.
+func (r *Registry) Call(name string, args []object.Object) object.Object {
+	p, ok := r.Lookup(name)
+	if !ok {
+		return &object.Error{Code: diagnostics.UndefinedPrimitive, Message: fmt.Sprintf("undefined primitive %s", name)}
+	}
+	if len(args) < p.Arity || !p.Variadic && len(args) > p.Arity {
+		return &object.Error{Code: diagnostics.PrimitiveArity, Message: fmt.Sprintf("%s takes %s, got %d", name, p.inputs(), len(args))}
+	}
+	return p.Func(r, args)
+}
+
+// inputs describes the number of inputs p takes.
+func (p *Primitive) inputs() string {
+	if p.Variadic {
+		if p.Arity == 1 {
+			return "at least 1 input"
+		}
+		return fmt.Sprintf("at least %d inputs", p.Arity)
+	}
+	switch p.Arity {
+	case 0:
+		return "no inputs"
+	case 1:
+		return "one input"
+	case 2:
+		return "two inputs"
+	case 3:
+		return "three inputs"
+	}
+	return fmt.Sprintf("%d inputs", p.Arity)
+}
+
+// Errorf returns the error a primitive fails with.
+func Errorf(format string, a ...any) *object.Error {
+	return &object.Error{Code: diagnostics.RuntimeError, Message: fmt.Sprintf(format, a...)}
+}
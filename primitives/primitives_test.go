@@ -0,0 +1,119 @@
+package primitives_test
+
+import (
+	"cogen/diagnostics"
+	"cogen/object"
+	"cogen/primitives"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func identity(_ *primitives.Registry, args []object.Object) object.Object {
+	return &object.List{Value: args}
+}
+
+func TestRegister(t *testing.T) {
+	var r primitives.Registry
+	if err := r.Register(primitives.Primitive{Name: "id", Arity: 1, Pure: true, Func: identity}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		prim primitives.Primitive
+		want string
+	}{
+		{"no name", primitives.Primitive{Func: identity}, "no name"},
+		{"no function", primitives.Primitive{Name: "f"}, "has no function"},
+		{"negative arity", primitives.Primitive{Name: "f", Arity: -1, Func: identity}, "takes -1 inputs"},
+		{"duplicate", primitives.Primitive{Name: "id", Func: identity}, "already registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Register(tt.prim)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if got := r.Names(); !reflect.DeepEqual(got, []string{"id"}) {
+		t.Errorf("got names %v", got)
+	}
+}
+
+func TestCall(t *testing.T) {
+	r := primitives.New()
+	r.MustRegister(primitives.Primitive{Name: "one", Arity: 1, Func: identity})
+	r.MustRegister(primitives.Primitive{Name: "three", Arity: 3, Func: identity})
+	r.MustRegister(primitives.Primitive{Name: "some", Arity: 2, Variadic: true, Func: identity})
+	one := &object.Integer{Value: 1}
+	tests := []struct {
+		name string
+		args int
+		want string
+		code diagnostics.Code
+	}{
+		{"one", 1, "'(1)", ""},
+		{"one", 2, "ERROR: one takes one input, got 2", diagnostics.PrimitiveArity},
+		{"three", 1, "ERROR: three takes three inputs, got 1", diagnostics.PrimitiveArity},
+		{"some", 4, "'(1 1 1 1)", ""},
+		{"some", 1, "ERROR: some takes at least 2 inputs, got 1", diagnostics.PrimitiveArity},
+		{"none", 0, "ERROR: undefined primitive none", diagnostics.UndefinedPrimitive},
+	}
+	for _, tt := range tests {
+		args := make([]object.Object, tt.args)
+		for i := range args {
+			args[i] = one
+		}
+		got := r.Call(tt.name, args)
+		if got.String() != tt.want {
+			t.Errorf("%s with %d inputs: got %s, want %s", tt.name, tt.args, got, tt.want)
+		}
+		if err, ok := got.(*object.Error); ok && err.Code != tt.code {
+			t.Errorf("%s with %d inputs: got code %s, want %s", tt.name, tt.args, err.Code, tt.code)
+		}
+	}
+}
+
+func TestCloneRestrict(t *testing.T) {
+	r := primitives.New()
+	for _, name := range []string{"a", "b", "c"} {
+		r.MustRegister(primitives.Primitive{Name: name, Pure: true, Func: identity})
+	}
+
+	c := r.Clone()
+	c.MustRegister(primitives.Primitive{Name: "d", Func: identity})
+	if got := r.Names(); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("registering in a clone changed the original: %v", got)
+	}
+
+	only, err := c.Restrict("d", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := only.Names(); !reflect.DeepEqual(got, []string{"a", "d"}) {
+		t.Errorf("got names %v", got)
+	}
+	if got := only.Call("b", nil); got.String() != "ERROR: undefined primitive b" {
+		t.Errorf("restricted registry called b: %s", got)
+	}
+	if _, err := r.Restrict("a", "d"); err == nil || err.Error() != "undefined primitive d" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestResidual(t *testing.T) {
+	tests := []struct {
+		prim primitives.Primitive
+		want bool
+	}{
+		{primitives.Primitive{Pure: true}, false},
+		{primitives.Primitive{Pure: true, BindingTime: primitives.Dynamic}, true},
+		{primitives.Primitive{}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.prim.Residual(); got != tt.want {
+			t.Errorf("pure=%v %s: got %v, want %v", tt.prim.Pure, tt.prim.BindingTime, got, tt.want)
+		}
+	}
+}
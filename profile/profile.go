@@ -0,0 +1,252 @@
+// Package profile counts what an FCL program does as it runs: how often
+// each label is entered, the statements and time spent in it, the
+// primitives called and the labels called with call. A profile is written
+// as a table for people or as folded stacks for flame graph tools, so a
+// program can be compared with its residual program.
+package profile
+
+import (
+	"cogen/evaluator"
+	"cogen/object"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Profile is what one run of a program did.
+type Profile struct {
+	Program    string            // the name of the program
+	Entry      string            // the label the program started at
+	Labels     map[string]*Label // by label
+	Primitives map[string]int    // calls by primitive name
+	Calls      map[string]int    // calls by called label
+	Jumps      map[Jump]int      // jumps, by goto or if, between labels
+	Stacks     map[string]int    // statements by call stack: the program, then the labels of its frames, joined by ;
+	Steps      int               // statements run
+	Time       time.Duration     // time spent running statements
+}
+
+// A Label is what the program did in one block.
+type Label struct {
+	Name    string
+	Entries int           // times the block was started
+	Steps   int           // statements of the block run
+	Time    time.Duration // time spent running them, without the calls they make
+}
+
+// A Jump is a goto or branch from one label to another.
+type Jump struct {
+	From, To string
+}
+
+// profiler fills in a profile from the hooks of the machine.
+type profiler struct {
+	evaluator.BaseObserver
+	p    *Profile
+	last map[*evaluator.Frame]string // the block each active frame is in
+}
+
+func (pr *profiler) label(name string) *Label {
+	l, ok := pr.p.Labels[name]
+	if !ok {
+		l = &Label{Name: name}
+		pr.p.Labels[name] = l
+	}
+	return l
+}
+
+func (pr *profiler) EnterLabel(f *evaluator.Frame) {
+	name := f.Block.Label.Value
+	if pr.p.Entry == "" {
+		pr.p.Entry = name
+	}
+	pr.label(name).Entries++
+	if from, ok := pr.last[f]; ok {
+		pr.p.Jumps[Jump{From: from, To: name}]++
+	}
+	pr.last[f] = name
+}
+
+func (pr *profiler) CallEnter(caller, callee *evaluator.Frame) {
+	pr.p.Calls[callee.Block.Label.Value]++
+}
+
+func (pr *profiler) CallExit(callee *evaluator.Frame, result object.Object) {
+	delete(pr.last, callee)
+}
+
+func (pr *profiler) Primitive(name string, args []object.Object, result object.Object) {
+	pr.p.Primitives[name]++
+}
+
+// Run runs the program of e with the variables in env and returns its
+// profile and result.
+func Run(ctx context.Context, e *evaluator.Evaluator, env *object.Environment) (*Profile, object.Object) {
+	pr := &profiler{
+		p: &Profile{
+			Labels:     map[string]*Label{},
+			Primitives: map[string]int{},
+			Calls:      map[string]int{},
+			Jumps:      map[Jump]int{},
+			Stacks:     map[string]int{},
+		},
+		last: map[*evaluator.Frame]string{},
+	}
+	if e.Program != nil {
+		pr.p.Program = e.Program.Name
+	}
+	e.Observer = pr
+	defer func() { e.Observer = nil }()
+
+	m := e.StartContext(ctx, env)
+	var stack []string
+	for !m.Done() {
+		frames := m.Frames()
+		stack = append(stack[:0], pr.p.Program)
+		for _, f := range frames {
+			stack = append(stack, f.Block.Label.Value)
+		}
+		l := pr.label(stack[len(stack)-1])
+
+		start := time.Now()
+		m.Step()
+		elapsed := time.Since(start)
+
+		l.Steps++
+		l.Time += elapsed
+		pr.p.Steps++
+		pr.p.Time += elapsed
+		pr.p.Stacks[strings.Join(stack, ";")]++
+	}
+	return pr.p, m.Result()
+}
+
+// Sorted returns the labels run, the most statements first.
+func (p *Profile) Sorted() []*Label {
+	out := make([]*Label, 0, len(p.Labels))
+	for _, l := range p.Labels {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Steps != out[j].Steps {
+			return out[i].Steps > out[j].Steps
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// HotPath follows the most taken jump from the entry label until it
+// reaches a label without jumps or one already on the path, which is
+// then the head of the hottest loop.
+func (p *Profile) HotPath() []string {
+	if p.Entry == "" {
+		return nil
+	}
+	path := []string{p.Entry}
+	seen := map[string]bool{p.Entry: true}
+	for cur := p.Entry; ; {
+		next, most := "", 0
+		for j, n := range p.Jumps {
+			if j.From == cur && (n > most || n == most && j.To < next) {
+				next, most = j.To, n
+			}
+		}
+		if next == "" {
+			return path
+		}
+		path = append(path, next)
+		if seen[next] {
+			return path
+		}
+		seen[next] = true
+		cur = next
+	}
+}
+
+// WriteTable writes the profile as tables: the labels, the most
+// statements first, then the primitives and calls, the most frequent
+// first, and the hot path.
+func (p *Profile) WriteTable(w io.Writer) error {
+	labels := p.Sorted()
+	width := len("label")
+	for _, l := range labels {
+		width = max(width, len(l.Name))
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "%-*s %8s %8s %7s %12s\n", width, "label", "entries", "steps", "%steps", "time")
+	for _, l := range labels {
+		fmt.Fprintf(&out, "%-*s %8d %8d %6.1f%% %12s\n", width, l.Name, l.Entries, l.Steps, percent(l.Steps, p.Steps), l.Time)
+	}
+	fmt.Fprintf(&out, "%-*s %8s %8d %7s %12s\n", width, "total", "", p.Steps, "", p.Time)
+
+	for _, section := range []struct {
+		title  string
+		counts map[string]int
+	}{{"primitive", p.Primitives}, {"call", p.Calls}} {
+		if len(section.counts) == 0 {
+			continue
+		}
+		names := byCount(section.counts)
+		width := len(section.title)
+		for _, name := range names {
+			width = max(width, len(name))
+		}
+		fmt.Fprintf(&out, "\n%-*s %8s\n", width, section.title, "count")
+		for _, name := range names {
+			fmt.Fprintf(&out, "%-*s %8d\n", width, name, section.counts[name])
+		}
+	}
+
+	if path := p.HotPath(); len(path) > 1 {
+		fmt.Fprintf(&out, "\nhot path: %s\n", strings.Join(path, " -> "))
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// WriteFolded writes the profile as folded stacks, one line per call
+// stack with the statements run in it:
+//
+//	ackerman;ack1;ack2;ack 12
+//
+// Flame graph tools such as flamegraph.pl, inferno and speedscope read
+// this format.
+func (p *Profile) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.Stacks))
+	for s := range p.Stacks {
+		stacks = append(stacks, s)
+	}
+	sort.Strings(stacks)
+	for _, s := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", s, p.Stacks[s]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// byCount returns the names in counts, the largest count first.
+func byCount(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,127 @@
+package profile_test
+
+import (
+	"bytes"
+	"cogen/ast"
+	"cogen/evaluator"
+	"cogen/generator"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"cogen/profile"
+	"context"
+	"strings"
+	"testing"
+)
+
+const pow = `pow(m, n);
+init: result := 1;
+      goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m;
+      n := n - 1;
+      goto test;
+end: return result;`
+
+const calls = `f(n);
+a: x := call b; if x > 2 goto c else a;
+b: y := n + 1; return y;
+c: return cons(x, '());`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	return program
+}
+
+func run(t *testing.T, program *ast.Program, vars map[string]int64) (*profile.Profile, object.Object) {
+	t.Helper()
+	env := object.NewEnvironment()
+	for name, v := range vars {
+		env.Set(name, &object.Integer{Value: v})
+	}
+	return profile.Run(context.Background(), evaluator.New(program), env)
+}
+
+func TestCounts(t *testing.T) {
+	p, result := run(t, parse(t, pow), map[string]int64{"m": 2, "n": 3})
+	if result.String() != "8" {
+		t.Fatalf("wrong result, got %s", result)
+	}
+
+	want := map[string][2]int{ // entries, steps
+		"init": {1, 2},
+		"test": {4, 4},
+		"loop": {3, 9},
+		"end":  {1, 1},
+	}
+	for name, w := range want {
+		l := p.Labels[name]
+		if l == nil || l.Entries != w[0] || l.Steps != w[1] {
+			t.Errorf("%s: got %+v, want %d entries and %d steps", name, l, w[0], w[1])
+		}
+	}
+	if p.Steps != 16 {
+		t.Errorf("got %d steps, want 16", p.Steps)
+	}
+	if p.Jumps[profile.Jump{From: "loop", To: "test"}] != 3 {
+		t.Errorf("wrong jumps %v", p.Jumps)
+	}
+	if got := strings.Join(p.HotPath(), " "); got != "init test loop test" {
+		t.Errorf("wrong hot path %s", got)
+	}
+}
+
+func TestCallsAndPrimitives(t *testing.T) {
+	p, _ := run(t, parse(t, calls), map[string]int64{"n": 2})
+	if p.Calls["b"] != 1 || len(p.Calls) != 1 {
+		t.Errorf("wrong calls %v", p.Calls)
+	}
+	if p.Primitives["cons"] != 1 || len(p.Primitives) != 1 {
+		t.Errorf("wrong primitives %v", p.Primitives)
+	}
+
+	var out bytes.Buffer
+	if err := p.WriteFolded(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := "f;a 2\nf;a;b 2\nf;c 1\n"
+	if out.String() != want {
+		t.Errorf("wrong folded stacks.\nwant:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	out.Reset()
+	if err := p.WriteTable(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"label  entries", "b            1        2", "call    count", "cons             1"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("table lacks %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestResidual(t *testing.T) {
+	c := generator.New(parser.New(lexer.New(pow)))
+	genext, err := c.Gen([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: 5})
+	code := evaluator.New(genext).Eval(genext, env)
+	residual := parse(t, code.String())
+
+	orig, want := run(t, parse(t, pow), map[string]int64{"m": 2, "n": 5})
+	spec, got := run(t, residual, map[string]int64{"m": 2})
+	if got.String() != want.String() {
+		t.Fatalf("residual gave %s, original gave %s", got, want)
+	}
+	if spec.Steps >= orig.Steps || len(spec.Jumps) != 0 {
+		t.Errorf("residual ran %d steps and jumped %v, original ran %d steps", spec.Steps, spec.Jumps, orig.Steps)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"cogen/ast"
+	"cogen/diagnostics"
 	"cogen/evaluator"
 	"cogen/lexer"
 	"cogen/object"
@@ -15,9 +16,9 @@ import (
 
 const PROMPT = ">> "
 
-func printParserErrors(out io.Writer, errors []parser.ParserError) {
+func printParserErrors(out io.Writer, errors []diagnostics.Diagnostic) {
 	for _, err := range errors {
-		io.WriteString(out, "\t"+err.Msg+"\n")
+		io.WriteString(out, "\t"+err.Message+"\n")
 	}
 }
 func isDuplicate(a, b *ast.LabelStatement) bool {
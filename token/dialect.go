@@ -0,0 +1,39 @@
+package token
+
+import "fmt"
+
+// Dialect is the concrete syntax a program is written in.
+type Dialect int
+
+const (
+	// DefaultDialect is this repository's syntax: name(m, n); headers and
+	// names made of letters, digits and underscores.
+	DefaultDialect Dialect = iota
+	// BookDialect is the flowchart syntax of Jones, Gomard and Sestoft:
+	// read m, n; headers, names such as 1-init-m or done?, and the else of
+	// an if may be left out. Subtraction needs spaces, as n-1 is a name.
+	BookDialect
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DefaultDialect:
+		return "default"
+	case BookDialect:
+		return "book"
+	default:
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+}
+
+// ParseDialect returns the dialect with the given name.
+func ParseDialect(name string) (Dialect, error) {
+	switch name {
+	case "default":
+		return DefaultDialect, nil
+	case "book":
+		return BookDialect, nil
+	default:
+		return DefaultDialect, fmt.Errorf("unknown dialect %q, expected default or book", name)
+	}
+}
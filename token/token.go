@@ -7,6 +7,41 @@ type Token struct {
 	Literal string
 	Line    int
 	Column  int
+	Offset  int    // byte offset of the first character
+	File    string // optional, empty if the source has no name
+}
+
+// Pos is a point in a source text. Lines start at 1, columns and offsets at
+// 0. The zero Pos means "no position".
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+// Pos returns the position of the token's first character.
+func (t Token) Pos() Pos {
+	return Pos{Offset: t.Offset, Line: t.Line, Column: t.Column}
+}
+
+// End returns the position just after the token's last character.
+func (t Token) End() Pos {
+	end := t.Pos()
+	if !end.IsValid() {
+		return end
+	}
+	for i := 0; i < len(t.Literal); i++ {
+		end.Offset++
+		if t.Literal[i] == '\n' {
+			end.Line++
+			end.Column = 0
+		} else {
+			end.Column++
+		}
+	}
+	return end
 }
 
 var keywords = map[string]TokenType{
@@ -17,12 +52,16 @@ var keywords = map[string]TokenType{
 	"call":   CALL,
 	"true":   TRUE,
 	"false":  FALSE,
+	"and":    AND,
+	"or":     OR,
+	"not":    NOT,
 }
 
 const (
 	// special
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	// call
 	CALL = "call"
@@ -30,6 +69,9 @@ const (
 	// int
 	NUMBER = "NUMBER"
 
+	// string, the literal keeps the quotes and escapes as written
+	STRING = "STRING"
+
 	// assignment
 	ASSIGN = ":="
 
@@ -56,22 +98,27 @@ const (
 	NOT_EQUAL   = "!="
 	LESSTHAN    = "<"
 	GREATERTHAN = ">"
+	LESSEQUAL   = "<="
+	GREATEREQ   = ">="
 	SUB         = "-"
 	ADD         = "+"
 	ASTERISK    = "*"
 	SLASH       = "/"
+	PERCENT     = "%"
 	BANG        = "!"
+	AND         = "and"
+	OR          = "or"
+	NOT         = "not"
 
 	// Parenthesis
 	LPAREN = "("
 	RPAREN = ")"
 
 	// Delimeters
-	SEMICOLON   = ";"
-	COLON       = ":"
-	COMMA       = ","
-	QUOTE       = "'"
-	DOUBLEQUOTE = "\""
+	SEMICOLON = ";"
+	COLON     = ":"
+	COMMA     = ","
+	QUOTE     = "'"
 )
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,173 @@
+// Package trace records what an FCL program does, one step per statement,
+// through the Observer hooks of the evaluator. Steps are written as text
+// for people or as JSON lines for tools.
+package trace
+
+import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/evaluator"
+	"cogen/object"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Step is one statement run and what it changed.
+type Step struct {
+	N       int      `json:"step"`
+	Depth   int      `json:"depth"` // calls active, 0 for the program
+	Label   string   `json:"label"`
+	Line    int      `json:"line,omitempty"`
+	Stmt    string   `json:"stmt"`
+	Changed []Change `json:"changed,omitempty"`
+	Prims   []Prim   `json:"primitives,omitempty"`
+	Branch  string   `json:"branch,omitempty"` // the label an if jumped to
+	Call    string   `json:"call,omitempty"`   // the label a call entered
+	Return  string   `json:"return,omitempty"` // the value a return gave back
+	Error   string   `json:"error,omitempty"`  // the error the step failed with
+}
+
+// A Change is a variable set by a step. Setting a variable to the value it
+// had is a change too.
+type Change struct {
+	Var   string `json:"var"`
+	Value string `json:"value"`
+}
+
+// A Prim is a call to a primitive made by a step.
+type Prim struct {
+	Name   string   `json:"name"`
+	Args   []string `json:"args"`
+	Result string   `json:"result"` // the value or the error it gave
+}
+
+// tracer builds the step being run from the hooks of the machine.
+type tracer struct {
+	evaluator.BaseObserver
+	cur  *Step
+	stmt ast.Statement
+}
+
+func (t *tracer) Statement(f *evaluator.Frame, stmt ast.Statement) {
+	t.stmt = stmt
+	t.cur = &Step{
+		Depth: f.Depth,
+		Label: f.Block.Label.Value,
+		Line:  line(stmt),
+		Stmt:  stmt.String(),
+	}
+}
+
+func (t *tracer) Assign(f *evaluator.Frame, name string, value object.Object) {
+	t.cur.Changed = append(t.cur.Changed, Change{Var: name, Value: show(value)})
+}
+
+func (t *tracer) Primitive(name string, args []object.Object, result object.Object) {
+	prim := Prim{Name: name, Args: make([]string, len(args)), Result: show(result)}
+	for i, arg := range args {
+		prim.Args[i] = show(arg)
+	}
+	t.cur.Prims = append(t.cur.Prims, prim)
+}
+
+func (t *tracer) Branch(f *evaluator.Frame, stmt *ast.IfStatement, taken *ast.Label) {
+	t.cur.Branch = taken.Value
+}
+
+func (t *tracer) CallEnter(caller, callee *evaluator.Frame) {
+	t.cur.Call = callee.Block.Label.Value
+}
+
+func (t *tracer) CallExit(callee *evaluator.Frame, result object.Object) {
+	if t.cur.Return == "" {
+		t.cur.Return = show(result)
+	}
+}
+
+// line returns the line stmt starts on, or 0 if it has no position.
+func line(stmt ast.Statement) int {
+	r := diagnostics.FromNode(stmt)
+	if r.IsZero() {
+		return 0
+	}
+	return r.Start.Line
+}
+
+func show(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return obj.String()
+}
+
+// Run runs the program of e with the variables in env, passing each step
+// to emit once it is done. It stops early if emit fails, and returns the
+// result of the program.
+func Run(ctx context.Context, e *evaluator.Evaluator, env *object.Environment, emit func(*Step) error) (object.Object, error) {
+	t := &tracer{}
+	e.Observer = t
+	defer func() { e.Observer = nil }()
+
+	m := e.StartContext(ctx, env)
+	for n := 1; !m.Done(); n++ {
+		t.cur = nil
+		m.Step()
+		if t.cur == nil {
+			// The machine stopped at a limit before running anything.
+			break
+		}
+		t.cur.N = n
+		if m.Done() {
+			if err, ok := m.Result().(*object.Error); ok {
+				t.cur.Error = err.Message
+			} else if _, ok := t.stmt.(*ast.ReturnStatement); ok && t.cur.Return == "" {
+				t.cur.Return = show(m.Result())
+			}
+		}
+		if err := emit(t.cur); err != nil {
+			return nil, err
+		}
+	}
+	return m.Result(), nil
+}
+
+// WriteText returns an emit function writing steps to w, one per line and
+// indented by call depth.
+func WriteText(w io.Writer) func(*Step) error {
+	return func(s *Step) error {
+		var out strings.Builder
+		fmt.Fprintf(&out, "%5d %s%s: %s", s.N, strings.Repeat("  ", s.Depth), s.Label, s.Stmt)
+		for _, p := range s.Prims {
+			fmt.Fprintf(&out, "  %s(%s) => %s", p.Name, strings.Join(p.Args, ", "), p.Result)
+		}
+		if s.Return != "" {
+			fmt.Fprintf(&out, "  <- %s", s.Return)
+		}
+		for _, c := range s.Changed {
+			fmt.Fprintf(&out, "  %s = %s", c.Var, c.Value)
+		}
+		if s.Branch != "" {
+			fmt.Fprintf(&out, "  -> %s", s.Branch)
+		}
+		if s.Call != "" {
+			fmt.Fprintf(&out, "  -> call %s", s.Call)
+		}
+		if s.Error != "" {
+			fmt.Fprintf(&out, "  error: %s", s.Error)
+		}
+		out.WriteString("\n")
+		_, err := io.WriteString(w, out.String())
+		return err
+	}
+}
+
+// WriteJSON returns an emit function writing steps to w as JSON lines.
+func WriteJSON(w io.Writer) func(*Step) error {
+	enc := json.NewEncoder(w)
+	return func(s *Step) error {
+		return enc.Encode(s)
+	}
+}
@@ -0,0 +1,104 @@
+package trace_test
+
+import (
+	"bytes"
+	"cogen/evaluator"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"cogen/trace"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const input = `f(n);
+a: x := call b; if x > 2 goto c else a;
+b: y := n + 1; return y;
+c: return cons(x, '());`
+
+func run(t *testing.T, n int64, opts evaluator.Options, emit func(*trace.Step) error) (object.Object, error) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	env := object.NewEnvironment()
+	env.Set("n", &object.Integer{Value: n})
+	e := evaluator.New(program)
+	e.Options = opts
+	return trace.Run(context.Background(), e, env, emit)
+}
+
+func TestText(t *testing.T) {
+	var out bytes.Buffer
+	result, err := run(t, 2, evaluator.Options{}, trace.WriteText(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `    1 a: x := call b  -> call b
+    2   b: y := (n + 1)  y = 3
+    3   b: return y  <- 3  x = 3
+    4 a: if (x > 2) c else a  -> c
+    5 c: return cons(x, '())  cons(3, '()) => '(3)  <- '(3)
+`
+	if out.String() != want {
+		t.Errorf("wrong trace.\nwant:\n%s\ngot:\n%s", want, out.String())
+	}
+	if result.String() != "'(3)" {
+		t.Errorf("wrong result, got %s", result)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := run(t, 2, evaluator.Options{}, trace.WriteJSON(&out)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d:\n%s", len(lines), out.String())
+	}
+	var step trace.Step
+	if err := json.Unmarshal([]byte(lines[2]), &step); err != nil {
+		t.Fatal(err)
+	}
+	if step.N != 3 || step.Depth != 1 || step.Label != "b" || step.Line != 3 || step.Return != "3" ||
+		len(step.Changed) != 1 || step.Changed[0] != (trace.Change{Var: "x", Value: "3"}) {
+		t.Errorf("wrong step 3, got %+v", step)
+	}
+	step = trace.Step{}
+	if err := json.Unmarshal([]byte(lines[4]), &step); err != nil {
+		t.Fatal(err)
+	}
+	if len(step.Prims) != 1 || step.Prims[0].Name != "cons" || strings.Join(step.Prims[0].Args, " ") != "3 '()" || step.Prims[0].Result != "'(3)" {
+		t.Errorf("wrong primitives in step 5, got %+v", step.Prims)
+	}
+}
+
+func TestStops(t *testing.T) {
+	var steps []*trace.Step
+	result, err := run(t, 0, evaluator.Options{MaxSteps: 6}, func(s *trace.Step) error {
+		steps = append(steps, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 6 || !evaluator.LimitExceeded(result) {
+		t.Errorf("expected 6 steps and a limit error, got %d and %v", len(steps), result)
+	}
+
+	stop := errors.New("stop")
+	_, err = run(t, 2, evaluator.Options{}, func(s *trace.Step) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected the error of emit, got %v", err)
+	}
+}
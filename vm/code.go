@@ -0,0 +1,201 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Opcode is the first byte of an instruction. Its operands follow, big
+// endian, with the widths given by its definition.
+type Opcode byte
+
+const (
+	OpConst  Opcode = iota // push constant c
+	OpGet                  // push variable slot; an error at node n if unset
+	OpSet                  // pop into variable slot of the running frame
+	OpLast                 // pop into the value of the running block
+	OpInfix                // pop right and left, push left op right; errors at node n
+	OpPrefix               // pop right, push op right; errors at node n
+	OpAnd                  // if the top is not true, replace it by false and jump to a
+	OpOr                   // if the top is true, replace it by true and jump to a
+	OpBool                 // replace the top by true or false
+	OpList                 // pop n values, push a list of them
+	OpPrim                 // pop argc arguments, push primitive p of them; errors at node n
+	OpStmt                 // start statement s: count a step and check the limits
+	OpGoto                 // jump to the block at a
+	OpBranch               // pop a condition, jump to the block at t if true, f if not
+	OpCall                 // call the block at a, its result going to slot; call node n
+	OpReturn               // pop the result of the running call
+	OpEnd                  // return the value of the running block, which has run off its end
+	OpFail                 // fail with error e
+)
+
+// A Definition names an opcode and gives the widths of its operands.
+type Definition struct {
+	Name   string
+	Widths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConst:  {"CONST", []int{4}},
+	OpGet:    {"GET", []int{2, 4}},
+	OpSet:    {"SET", []int{2}},
+	OpLast:   {"LAST", nil},
+	OpInfix:  {"INFIX", []int{1, 4}},
+	OpPrefix: {"PREFIX", []int{1, 4}},
+	OpAnd:    {"AND", []int{4}},
+	OpOr:     {"OR", []int{4}},
+	OpBool:   {"BOOL", nil},
+	OpList:   {"LIST", []int{2}},
+	OpPrim:   {"PRIM", []int{2, 1, 4}},
+	OpStmt:   {"STMT", []int{4}},
+	OpGoto:   {"GOTO", []int{4}},
+	OpBranch: {"BRANCH", []int{4, 4}},
+	OpCall:   {"CALL", []int{4, 2, 4}},
+	OpReturn: {"RETURN", nil},
+	OpEnd:    {"END", nil},
+	OpFail:   {"FAIL", []int{2}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return nil
+	}
+	length := 1
+	for _, w := range def.Widths {
+		length += w
+	}
+	ins := make([]byte, length)
+	ins[0] = byte(op)
+	offset := 1
+	for i, o := range operands {
+		switch w := def.Widths[i]; w {
+		case 1:
+			ins[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(ins[offset:], uint32(o))
+		}
+		offset += def.Widths[i]
+	}
+	return ins
+}
+
+// ReadOperands decodes the operands of an instruction of def from ins,
+// which starts after the opcode, and returns them and the bytes they took.
+func ReadOperands(def *Definition, ins []byte) ([]int, int) {
+	operands := make([]int, len(def.Widths))
+	offset := 0
+	for i, w := range def.Widths {
+		operands[i] = readOperand(ins[offset:], w)
+		offset += w
+	}
+	return operands, offset
+}
+
+func readOperand(ins []byte, width int) int {
+	switch width {
+	case 1:
+		return int(ins[0])
+	case 2:
+		return int(binary.BigEndian.Uint16(ins))
+	case 4:
+		return int(binary.BigEndian.Uint32(ins))
+	}
+	return 0
+}
+
+// Disassemble lists the instructions of p, one per line with its address,
+// and the labels of the blocks they start:
+//
+//	init:
+//	0000 STMT 0                 ; result := 1
+//	0005 CONST 0                ; 1
+//	0010 SET 0                  ; result
+func (p *Program) Disassemble() string {
+	labels := map[int][]string{}
+	for name, addr := range p.Labels {
+		labels[addr] = append(labels[addr], name)
+	}
+	var out strings.Builder
+	for ip := 0; ip < len(p.Instructions); {
+		names := labels[ip]
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&out, "%s:\n", name)
+		}
+		op := Opcode(p.Instructions[ip])
+		def, err := Lookup(op)
+		if err != nil {
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", ip, err)
+			ip++
+			continue
+		}
+		operands, read := ReadOperands(def, p.Instructions[ip+1:])
+		text := def.Name
+		for _, o := range operands {
+			text += fmt.Sprintf(" %d", o)
+		}
+		if note := p.note(op, operands); note != "" {
+			text = fmt.Sprintf("%-24s ; %s", text, note)
+		}
+		fmt.Fprintf(&out, "%04d %s\n", ip, text)
+		ip += 1 + read
+	}
+	return out.String()
+}
+
+// note explains the operands of an instruction.
+func (p *Program) note(op Opcode, operands []int) string {
+	switch op {
+	case OpConst:
+		return p.Constants[operands[0]].String()
+	case OpGet, OpSet:
+		return p.Names[operands[0]]
+	case OpInfix, OpPrefix:
+		return p.Operators[operands[0]]
+	case OpPrim:
+		return p.Primitives[operands[0]]
+	case OpStmt:
+		return p.Statements[operands[0]].Stmt.String()
+	case OpGoto:
+		return p.label(operands[0])
+	case OpBranch:
+		return p.label(operands[0]) + " else " + p.label(operands[1])
+	case OpCall:
+		return p.Names[operands[1]] + " := call " + p.label(operands[0])
+	case OpFail:
+		return p.Errors[operands[0]].Message
+	}
+	return ""
+}
+
+// label names the block at addr, or the instruction there if no block
+// starts at it.
+func (p *Program) label(addr int) string {
+	var names []string
+	for name, a := range p.Labels {
+		if a == addr {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%04d", addr)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
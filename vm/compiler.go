@@ -0,0 +1,293 @@
+// Package vm compiles FCL programs to bytecode and runs them on a stack
+// machine, with the same results as the evaluator but without walking the
+// syntax tree: labels are resolved to addresses and variables to slots
+// when the program is compiled.
+package vm
+
+import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/evaluator"
+	"cogen/object"
+	"fmt"
+)
+
+// A Program is compiled bytecode and the tables its operands index.
+type Program struct {
+	Instructions []byte
+	Constants    []object.Object
+	Names        []string // variables, by slot
+	Operators    []string
+	Primitives   []string
+	Labels       map[string]int  // the address of each block
+	Statements   []Statement     // by operand of OpStmt
+	Nodes        []ast.Node      // the nodes errors point at
+	Errors       []*object.Error // by operand of OpFail
+}
+
+// A Statement is a statement of the source and the label of its block.
+type Statement struct {
+	Label string
+	Stmt  ast.Statement
+}
+
+type compiler struct {
+	p       *Program
+	slots   map[string]int
+	ops     map[string]int
+	prims   map[string]int
+	fixups  []fixup // jumps to labels not compiled yet
+	missing map[string]int
+}
+
+// fixup is an address operand at offset waiting for the block of label.
+type fixup struct {
+	offset int
+	label  *ast.Label
+}
+
+// Compile compiles program. It fails on statements or expressions the
+// parser does not produce, such as a call outside an assignment.
+func Compile(program *ast.Program) (*Program, error) {
+	c := &compiler{
+		p:       &Program{Labels: map[string]int{}},
+		slots:   map[string]int{},
+		ops:     map[string]int{},
+		prims:   map[string]int{},
+		missing: map[string]int{},
+	}
+	for _, v := range program.Variables {
+		c.slot(v.Ident.Value)
+	}
+	defined := map[string]bool{}
+	for _, block := range program.Statements {
+		defined[block.Label.Value] = true
+	}
+
+	for _, block := range program.Statements {
+		if _, ok := c.p.Labels[block.Label.Value]; ok {
+			// Jumps go to the first block of a label; later ones are dead.
+			continue
+		}
+		c.p.Labels[block.Label.Value] = len(c.p.Instructions)
+		if err := c.block(block, defined); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range c.fixups {
+		addr, ok := c.p.Labels[f.label.Value]
+		if !ok {
+			addr = c.failStub(f.label)
+		}
+		copy(c.p.Instructions[f.offset:], Make(OpGoto, addr)[1:])
+	}
+	return c.p, nil
+}
+
+func (c *compiler) emit(op Opcode, operands ...int) int {
+	pos := len(c.p.Instructions)
+	c.p.Instructions = append(c.p.Instructions, Make(op, operands...)...)
+	return pos
+}
+
+func (c *compiler) slot(name string) int {
+	s, ok := c.slots[name]
+	if !ok {
+		s = len(c.p.Names)
+		c.slots[name] = s
+		c.p.Names = append(c.p.Names, name)
+	}
+	return s
+}
+
+func (c *compiler) constant(obj object.Object) int {
+	c.p.Constants = append(c.p.Constants, obj)
+	return len(c.p.Constants) - 1
+}
+
+func (c *compiler) node(n ast.Node) int {
+	c.p.Nodes = append(c.p.Nodes, n)
+	return len(c.p.Nodes) - 1
+}
+
+func intern(table map[string]int, list *[]string, name string) int {
+	i, ok := table[name]
+	if !ok {
+		i = len(*list)
+		table[name] = i
+		*list = append(*list, name)
+	}
+	return i
+}
+
+// failStub returns the address of an instruction failing with "label not
+// found" for a jump to label, as the evaluator does when it takes it.
+func (c *compiler) failStub(label *ast.Label) int {
+	if addr, ok := c.missing[label.Value]; ok {
+		return addr
+	}
+	err := &object.Error{Code: diagnostics.LabelNotFound, Message: "label not found: " + label.Value, Range: diagnostics.FromNode(label)}
+	c.p.Errors = append(c.p.Errors, err)
+	addr := c.emit(OpFail, len(c.p.Errors)-1)
+	c.missing[label.Value] = addr
+	return addr
+}
+
+// jump emits op with its address operands to be filled in for labels.
+func (c *compiler) jump(op Opcode, labels ...*ast.Label) {
+	pos := c.emit(op, make([]int, len(labels))...)
+	for i, l := range labels {
+		c.fixups = append(c.fixups, fixup{offset: pos + 1 + 4*i, label: l})
+	}
+}
+
+func (c *compiler) block(block *ast.LabelStatement, defined map[string]bool) error {
+	for _, stmt := range block.Statements {
+		c.p.Statements = append(c.p.Statements, Statement{Label: block.Label.Value, Stmt: stmt})
+		c.emit(OpStmt, len(c.p.Statements)-1)
+
+		switch stmt := stmt.(type) {
+		case *ast.GotoStatement:
+			c.jump(OpGoto, &stmt.Label)
+		case *ast.IfStatement:
+			if err := c.expression(stmt.Cond); err != nil {
+				return err
+			}
+			c.jump(OpBranch, &stmt.LabelTrue, &stmt.LabelFalse)
+		case *ast.ReturnStatement:
+			if err := c.expression(stmt.ReturnValue); err != nil {
+				return err
+			}
+			c.emit(OpReturn)
+		case *ast.AssignmentStatement:
+			if call, ok := stmt.Right.(*ast.CallExpression); ok {
+				if !defined[call.Label.Value] {
+					err := &object.Error{
+						Code:    diagnostics.LabelNotFound,
+						Message: "LabelStatement not found in call expression: " + call.Label.Value,
+						Range:   diagnostics.FromNode(call),
+					}
+					c.p.Errors = append(c.p.Errors, err)
+					c.emit(OpFail, len(c.p.Errors)-1)
+					break
+				}
+				pos := c.emit(OpCall, 0, c.slot(stmt.Left.Value), c.node(call))
+				c.fixups = append(c.fixups, fixup{offset: pos + 1, label: &call.Label})
+				break
+			}
+			if err := c.expression(stmt.Right); err != nil {
+				return err
+			}
+			c.emit(OpSet, c.slot(stmt.Left.Value))
+		case *ast.ExpressionStatement:
+			if err := c.expression(stmt.Expression); err != nil {
+				return err
+			}
+			c.emit(OpLast)
+		default:
+			return fmt.Errorf("cannot compile statement %s", stmt)
+		}
+	}
+
+	if n := len(block.Statements); n > 0 {
+		switch block.Statements[n-1].(type) {
+		case *ast.GotoStatement, *ast.IfStatement, *ast.ReturnStatement:
+			return nil
+		}
+	}
+	c.emit(OpEnd)
+	return nil
+}
+
+func (c *compiler) expression(exp ast.Expression) error {
+	switch exp := exp.(type) {
+	case nil:
+		c.emit(OpConst, c.constant(evaluator.NULL))
+	case *ast.IntegerLiteral:
+		c.emit(OpConst, c.constant(&object.Integer{Value: exp.Value, Big: exp.Big}))
+	case *ast.BooleanLiteral:
+		obj := evaluator.FALSE
+		if exp.Value {
+			obj = evaluator.TRUE
+		}
+		c.emit(OpConst, c.constant(obj))
+	case *ast.StringLiteral:
+		c.emit(OpConst, c.constant(&object.String{Value: exp.Value}))
+	case *ast.SymbolExpression:
+		c.emit(OpConst, c.constant(&object.Symbol{Value: exp.Value}))
+	case *ast.Identifier:
+		c.emit(OpGet, c.slot(exp.Value), c.node(exp))
+	case *ast.Constant:
+		return c.datum(exp.Value)
+	case *ast.List:
+		for _, elem := range exp.Value {
+			if err := c.expression(elem); err != nil {
+				return err
+			}
+		}
+		c.emit(OpList, len(exp.Value))
+	case *ast.PrefixExpression:
+		if err := c.expression(exp.Right); err != nil {
+			return err
+		}
+		c.emit(OpPrefix, intern(c.ops, &c.p.Operators, exp.Operator), c.node(exp))
+	case *ast.InfixExpression:
+		if err := c.expression(exp.Left); err != nil {
+			return err
+		}
+		if exp.Operator == "and" || exp.Operator == "or" {
+			op := OpAnd
+			if exp.Operator == "or" {
+				op = OpOr
+			}
+			pos := c.emit(op, 0)
+			if err := c.expression(exp.Right); err != nil {
+				return err
+			}
+			c.emit(OpBool)
+			copy(c.p.Instructions[pos+1:], Make(op, len(c.p.Instructions))[1:])
+			return nil
+		}
+		if err := c.expression(exp.Right); err != nil {
+			return err
+		}
+		c.emit(OpInfix, intern(c.ops, &c.p.Operators, exp.Operator), c.node(exp))
+	case *ast.PrimitiveCall:
+		if len(exp.Arguments) > 255 {
+			return fmt.Errorf("%s has more than 255 arguments", exp.Primitive)
+		}
+		for _, arg := range exp.Arguments {
+			if err := c.expression(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(OpPrim, intern(c.prims, &c.p.Primitives, exp.Primitive.String()), len(exp.Arguments), c.node(exp))
+	default:
+		return fmt.Errorf("cannot compile expression %s", exp)
+	}
+	return nil
+}
+
+// datum compiles quoted data. Lists are built anew each time, as code
+// building primitives change the lists they are given.
+func (c *compiler) datum(exp ast.Expression) error {
+	switch exp := exp.(type) {
+	case *ast.List:
+		for _, elem := range exp.Value {
+			if err := c.datum(elem); err != nil {
+				return err
+			}
+		}
+		c.emit(OpList, len(exp.Value))
+	case *ast.Constant:
+		c.emit(OpConst, c.constant(&object.Symbol{Value: "quote"}))
+		if err := c.datum(exp.Value); err != nil {
+			return err
+		}
+		c.emit(OpList, 2)
+	default:
+		return c.expression(exp)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package vm
+
+import (
+	"cogen/ast"
+	"cogen/diagnostics"
+	"cogen/evaluator"
+	"cogen/object"
+	"cogen/primitives"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// frame is a call being run. Its variables are the slots of the VM's
+// vars from base, one per name of the program; an unset slot is nil and
+// reads through to the caller's.
+type frame struct {
+	base int
+	ret  int           // the address the call returns to
+	dest int           // the caller's slot that gets the result
+	stmt int           // the statement running, by index in Statements
+	last object.Object // value of the last statement, if the block ends without a jump
+}
+
+type machine struct {
+	p      *Program
+	opts   evaluator.Options
+	prims  *primitives.Registry
+	ctx    context.Context
+	frames []frame
+	vars   []object.Object
+	stack  []object.Object
+	steps  int
+}
+
+// Run runs p with the variables in env, within the bounds of opts and
+// until ctx is done, and returns what evaluator.Eval returns for the
+// program p was compiled from.
+func Run(ctx context.Context, p *Program, env *object.Environment, opts evaluator.Options) object.Object {
+	if len(p.Labels) == 0 {
+		return &object.Error{Code: diagnostics.RuntimeError, Message: "program has no labels"}
+	}
+	if ctx != nil && opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	m := &machine{
+		p:      p,
+		opts:   opts,
+		prims:  opts.Registry(),
+		ctx:    ctx,
+		frames: []frame{{}},
+		vars:   make([]object.Object, len(p.Names)),
+	}
+	for i, name := range p.Names {
+		if val, ok := env.Get(name); ok {
+			m.vars[i] = val
+		}
+	}
+	return m.run()
+}
+
+func (m *machine) run() object.Object {
+	ins := m.p.Instructions
+	n := len(m.p.Names)
+	f := &m.frames[0]
+	ip := 0
+	for {
+		op := Opcode(ins[ip])
+		switch op {
+		case OpConst:
+			m.push(m.p.Constants[readOperand(ins[ip+1:], 4)])
+			ip += 5
+
+		case OpGet:
+			slot := readOperand(ins[ip+1:], 2)
+			var val object.Object
+			for i := len(m.frames) - 1; i >= 0 && val == nil; i-- {
+				val = m.vars[m.frames[i].base+slot]
+			}
+			if val == nil {
+				ident := m.p.Nodes[readOperand(ins[ip+3:], 4)].(*ast.Identifier)
+				err := &object.Error{
+					Code:    diagnostics.IdentifierNotFound,
+					Message: fmt.Sprintf("identifier not found: %s at %d:%d", ident.Value, ident.Token.Line, ident.Token.Column),
+					Range:   diagnostics.FromNode(ident),
+				}
+				return m.fail(err)
+			}
+			m.push(val)
+			ip += 7
+
+		case OpSet:
+			m.vars[f.base+readOperand(ins[ip+1:], 2)] = m.pop()
+			f.last = nil
+			ip += 3
+
+		case OpLast:
+			f.last = m.pop()
+			ip++
+
+		case OpInfix:
+			right := m.pop()
+			left := m.pop()
+			val := evaluator.Infix(m.p.Operators[ins[ip+1]], left, right)
+			if err, ok := val.(*object.Error); ok {
+				return m.failAt(err, readOperand(ins[ip+2:], 4))
+			}
+			m.push(val)
+			ip += 6
+
+		case OpPrefix:
+			val := evaluator.Prefix(m.p.Operators[ins[ip+1]], m.pop())
+			if err, ok := val.(*object.Error); ok {
+				return m.failAt(err, readOperand(ins[ip+2:], 4))
+			}
+			m.push(val)
+			ip += 6
+
+		case OpAnd, OpOr:
+			top := len(m.stack) - 1
+			if evaluator.IsTruthy(m.stack[top]) == (op == OpOr) {
+				m.stack[top] = evaluator.FALSE
+				if op == OpOr {
+					m.stack[top] = evaluator.TRUE
+				}
+				ip = readOperand(ins[ip+1:], 4)
+				break
+			}
+			m.stack = m.stack[:top]
+			ip += 5
+
+		case OpBool:
+			top := len(m.stack) - 1
+			if evaluator.IsTruthy(m.stack[top]) {
+				m.stack[top] = evaluator.TRUE
+			} else {
+				m.stack[top] = evaluator.FALSE
+			}
+			ip++
+
+		case OpList:
+			count := readOperand(ins[ip+1:], 2)
+			values := make([]object.Object, count)
+			copy(values, m.stack[len(m.stack)-count:])
+			m.stack = m.stack[:len(m.stack)-count]
+			m.push(&object.List{Value: values})
+			ip += 3
+
+		case OpPrim:
+			argc := int(ins[ip+3])
+			args := make([]object.Object, argc)
+			copy(args, m.stack[len(m.stack)-argc:])
+			m.stack = m.stack[:len(m.stack)-argc]
+			val := m.prims.Call(m.p.Primitives[readOperand(ins[ip+1:], 2)], args)
+			if list, ok := val.(*object.List); ok && m.opts.MaxListLength > 0 && len(list.Value) > m.opts.MaxListLength {
+				val = &object.Error{Code: diagnostics.LimitExceeded, Message: fmt.Sprintf("list length limit of %d exceeded", m.opts.MaxListLength)}
+			}
+			if err, ok := val.(*object.Error); ok {
+				return m.failAt(err, readOperand(ins[ip+4:], 4))
+			}
+			m.push(val)
+			ip += 8
+
+		case OpStmt:
+			f.stmt = readOperand(ins[ip+1:], 4)
+			if err := m.checkLimits(); err != nil {
+				return m.fail(err)
+			}
+			m.steps++
+			ip += 5
+
+		case OpGoto:
+			f.last = nil
+			ip = readOperand(ins[ip+1:], 4)
+
+		case OpBranch:
+			f.last = nil
+			if evaluator.IsTruthy(m.pop()) {
+				ip = readOperand(ins[ip+1:], 4)
+			} else {
+				ip = readOperand(ins[ip+5:], 4)
+			}
+
+		case OpCall:
+			if limit := m.opts.MaxCallDepth; limit > 0 && len(m.frames)-1 >= limit {
+				err := &object.Error{Code: diagnostics.LimitExceeded, Message: fmt.Sprintf("call depth limit of %d exceeded", limit)}
+				return m.failAt(err, readOperand(ins[ip+7:], 4))
+			}
+			base := len(m.frames) * n
+			if need := base + n; need > len(m.vars) {
+				m.vars = append(m.vars, make([]object.Object, need-len(m.vars))...)
+			}
+			clear(m.vars[base : base+n])
+			m.frames = append(m.frames, frame{base: base, ret: ip + 11, dest: readOperand(ins[ip+5:], 2)})
+			f = &m.frames[len(m.frames)-1]
+			ip = readOperand(ins[ip+1:], 4)
+
+		case OpReturn, OpEnd:
+			val := f.last
+			if op == OpReturn {
+				val = m.pop()
+			}
+			if len(m.frames) == 1 {
+				return val
+			}
+			ret, dest := f.ret, f.dest
+			m.frames = m.frames[:len(m.frames)-1]
+			f = &m.frames[len(m.frames)-1]
+			m.vars[f.base+dest] = val
+			f.last = nil
+			ip = ret
+
+		case OpFail:
+			err := *m.p.Errors[readOperand(ins[ip+1:], 2)]
+			return m.fail(&err)
+
+		default:
+			return m.fail(&object.Error{Code: diagnostics.RuntimeError, Message: fmt.Sprintf("opcode %d undefined", op)})
+		}
+	}
+}
+
+func (m *machine) push(obj object.Object) { m.stack = append(m.stack, obj) }
+
+func (m *machine) pop() object.Object {
+	obj := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return obj
+}
+
+// checkLimits returns the error stopping the program before the running
+// statement, if a bound is passed. The context is checked every 1024
+// steps, as asking it costs more than a statement.
+func (m *machine) checkLimits() *object.Error {
+	if limit := m.opts.MaxSteps; limit > 0 && m.steps >= limit {
+		return &object.Error{Code: diagnostics.LimitExceeded, Message: fmt.Sprintf("step limit of %d exceeded", limit)}
+	}
+	if m.ctx != nil && m.steps%1024 == 0 {
+		if err := m.ctx.Err(); err != nil {
+			msg := "evaluation canceled"
+			if errors.Is(err, context.DeadlineExceeded) {
+				msg = "evaluation deadline exceeded"
+			}
+			return &object.Error{Code: diagnostics.LimitExceeded, Message: fmt.Sprintf("%s after %d steps", msg, m.steps)}
+		}
+	}
+	return nil
+}
+
+// failAt fails with err, pointing it at node n unless it already points
+// somewhere.
+func (m *machine) failAt(err *object.Error, n int) object.Object {
+	if err.Range.IsZero() {
+		err.Range = diagnostics.FromNode(m.p.Nodes[n])
+	}
+	return m.fail(err)
+}
+
+// fail records in err the statement that failed, unless err already
+// points at a node within it, and the active calls, as the evaluator does.
+func (m *machine) fail(err *object.Error) object.Object {
+	if err.Stack != nil {
+		return err
+	}
+	top := m.p.Statements[m.frames[len(m.frames)-1].stmt]
+	if err.Range.IsZero() {
+		err.Range = diagnostics.FromNode(top.Stmt)
+	}
+	err.Stack = make([]object.CallFrame, 0, len(m.frames))
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		s := m.p.Statements[m.frames[i].stmt]
+		r := err.Range
+		if i < len(m.frames)-1 {
+			r = diagnostics.FromNode(s.Stmt)
+		}
+		err.Stack = append(err.Stack, object.CallFrame{Label: s.Label, Range: r})
+	}
+	err.Label = err.Stack[0].Label
+	return err
+}
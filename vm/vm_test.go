@@ -0,0 +1,269 @@
+package vm_test
+
+import (
+	"cogen/ast"
+	"cogen/evaluator"
+	"cogen/generator"
+	"cogen/lexer"
+	"cogen/object"
+	"cogen/parser"
+	"cogen/primitives"
+	"cogen/vm"
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const pow = `pow(m, n);
+init: result := 1;
+      goto test;
+test: if n < 1 goto end else loop;
+loop: result := result * m;
+      n := n - 1;
+      goto test;
+end: return result;`
+
+const ackermann = `ack(m, n);
+ack: if m = 0 goto done else next;
+next: if n = 0 goto ack0 else ack1;
+done: return n + 1;
+ack0: n := 1;
+      goto ack2;
+ack1: n := n - 1;
+      n := call ack;
+      goto ack2;
+ack2: m := m - 1;
+      n := call ack;
+      return n;`
+
+func parse(t testing.TB, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors:\n%s", p.GetErrorMessage())
+	}
+	return program
+}
+
+// bind parses args as the evaluator's command line does.
+func bind(t testing.TB, program *ast.Program, args ...string) *object.Environment {
+	t.Helper()
+	env, err := evaluator.BindArguments(program, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func readFile(t testing.TB, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// compare runs program on the evaluator and the VM, which must agree.
+func compare(t *testing.T, program *ast.Program, opts evaluator.Options, args ...string) object.Object {
+	t.Helper()
+	want := evaluator.Eval(context.Background(), program, bind(t, program, args...), opts)
+	code, err := vm.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := vm.Run(context.Background(), code, bind(t, program, args...), opts)
+	if got.String() != want.String() {
+		t.Fatalf("vm gave %s, evaluator gave %s", got, want)
+	}
+	if wantErr, ok := want.(*object.Error); ok {
+		gotErr := got.(*object.Error)
+		if gotErr.Code != wantErr.Code || gotErr.Range != wantErr.Range || gotErr.Label != wantErr.Label {
+			t.Fatalf("vm gave %s at %v in %s, evaluator %s at %v in %s",
+				gotErr.Code, gotErr.Range, gotErr.Label, wantErr.Code, wantErr.Range, wantErr.Label)
+		}
+		if !reflect.DeepEqual(gotErr.Stack, wantErr.Stack) {
+			t.Fatalf("vm gave stack %v, evaluator %v", gotErr.Stack, wantErr.Stack)
+		}
+	}
+	return got
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		args    []string
+		want    string
+	}{
+		{"pow", pow, []string{"2", "10"}, "1024"},
+		{"big pow", pow, []string{"3", "50"}, "717897987691852588770249"},
+		{"ackermann", ackermann, []string{"2", "3"}, "9"},
+		{"last value", "f(x);\na: x + 1;\n   x * 2;", []string{"4"}, "8"},
+		{"logic", "f(x);\na: return list(x and false, x or hd('()), !x, not ('a = 'b));", []string{"true"},
+			"'(false true false true)"},
+		{"short circuit", "f(x);\na: return x or hd(x);", []string{"true"}, "true"},
+		{"quoted", "f();\na: y := '(a ('b) \"s\" 1);\n   return cons(y, y);", nil, `'((a ((quote b)) "s" 1) a ((quote b)) "s" 1)`},
+		{"callee scope", "f(x);\na: y := call b;\n   return list(x, y);\nb: x := x + 1;\n   return x;", []string{"1"}, "'(1 2)"},
+		{"callee falls off", "f(x);\na: y := call b;\n   return y;\nb: x * 3;", []string{"2"}, "6"},
+		{"duplicate label", "f();\na: goto b;\nb: return 1;\nb: return 2;", nil, "1"},
+		{"strings", "f(s);\na: return concat(s, \"!\", symbol->string('x));", []string{`"hi"`}, `"hi!x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parse(t, tt.program)
+			got := compare(t, program, evaluator.Options{}, tt.args...)
+			if tt.want != "" && got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	tests := []struct {
+		file string
+		args []string
+	}{
+		{"../turing_machine.fcl", []string{"'((0 if 0 goto 3) (1 right) (2 goto 0) (3 write 1))", "'(1 1 0 1 0)"}},
+		{"../ackermann.fcl", []string{"2", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			program := parse(t, readFile(t, tt.file))
+			compare(t, program, evaluator.Options{}, tt.args...)
+		})
+	}
+}
+
+// TestGeneratingExtension runs a generating extension, which builds code
+// with the primitives changing lists in place, and the program it makes.
+func TestGeneratingExtension(t *testing.T) {
+	genext, err := generator.New(parser.New(lexer.New(pow))).Gen([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := compare(t, genext, evaluator.Options{}, "5")
+	residual := parse(t, code.String())
+	if got := compare(t, residual, evaluator.Options{}, "3"); got.String() != "243" {
+		t.Errorf("residual program gave %s", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		opts    evaluator.Options
+		args    []string
+		want    string
+	}{
+		{"division", "f(x);\na: y := call b;\n   return y;\nb: return x / 0;", evaluator.Options{}, []string{"1"}, "division by zero: 1 / 0"},
+		{"identifier", "f(x);\na: return z;", evaluator.Options{}, []string{"1"}, "identifier not found: z at 2:10"},
+		{"primitive", "f(x);\na: y := call b;\n   return y;\nb: return hd(x);", evaluator.Options{}, []string{"1"}, "hd"},
+		{"goto", "f(x);\na: goto c;", evaluator.Options{}, []string{"1"}, "label not found: c"},
+		{"call", "f(x);\na: y := call c;", evaluator.Options{}, []string{"1"}, "LabelStatement not found in call expression: c"},
+		{"steps", pow, evaluator.Options{MaxSteps: 7}, []string{"2", "5"}, "step limit of 7 exceeded"},
+		{"depth", ackermann, evaluator.Options{MaxCallDepth: 3}, []string{"2", "3"}, "call depth limit of 3 exceeded"},
+		{"list", "f(x);\na: y := cons(x, '(1 2));\n   return y;", evaluator.Options{MaxListLength: 2}, []string{"1"}, "list length limit of 2 exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parse(t, tt.program)
+			got := compare(t, program, tt.opts, tt.args...)
+			err, ok := got.(*object.Error)
+			if !ok {
+				t.Fatalf("expected an error, got %s", got)
+			}
+			if !strings.Contains(err.Message, tt.want) {
+				t.Errorf("got %q, want %q in it", err.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrimitives(t *testing.T) {
+	prims := evaluator.StandardPrimitives()
+	prims.MustRegister(primitives.Primitive{Name: "twice", Arity: 1, Pure: true,
+		Func: func(_ *primitives.Registry, args []object.Object) object.Object {
+			return evaluator.Infix("+", args[0], args[0])
+		}})
+	restricted, err := prims.Restrict("twice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := parse(t, "f(x);\na: return twice(twice(x));")
+	if got := compare(t, program, evaluator.Options{Primitives: prims}, "5"); got.String() != "20" {
+		t.Errorf("got %s", got)
+	}
+	program = parse(t, "f(x);\na: return hd(twice(x));")
+	if got := compare(t, program, evaluator.Options{Primitives: restricted}, "5"); got.String() != "ERROR: undefined primitive hd" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	program := parse(t, "f();\na: goto a;")
+	code, err := vm.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got := vm.Run(ctx, code, object.NewEnvironment(), evaluator.Options{})
+	if !evaluator.LimitExceeded(got) || got.String() != "ERROR: evaluation canceled after 0 steps" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	code, err := vm.Compile(parse(t, "f(n);\na: if n < 1 goto b else c;\nb: return 0;\nc: m := call b;\n   m or n;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `a:
+0000 STMT 0                   ; if (n < 1) b else c
+0005 GET 0 0                  ; n
+0012 CONST 0                  ; 1
+0017 INFIX 0 1                ; <
+0023 BRANCH 32 43             ; b else c
+b:
+0032 STMT 1                   ; return 0
+0037 CONST 1                  ; 0
+0042 RETURN
+c:
+0043 STMT 2                   ; m := call b
+0048 CALL 32 1 2              ; m := call b
+0059 STMT 3                   ; (m or n)
+0064 GET 1 3                  ; m
+0071 OR 84
+0076 GET 0 4                  ; n
+0083 BOOL
+0084 LAST
+0085 END
+`
+	if got := code.Disassemble(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func BenchmarkEvaluator(b *testing.B) {
+	program := parse(b, ackermann)
+	for b.Loop() {
+		evaluator.Eval(context.Background(), program, bind(b, program, "2", "9"), evaluator.Options{})
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	program := parse(b, ackermann)
+	code, err := vm.Compile(program)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		vm.Run(context.Background(), code, bind(b, program, "2", "9"), evaluator.Options{})
+	}
+}
@@ -1,17 +1,31 @@
 package main
 
 import (
+	"cogen/ast"
+	"cogen/diagnostics"
 	"cogen/evaluator"
 	"cogen/generator"
 	"cogen/lexer"
 	"cogen/object"
 	"cogen/parser"
+	"cogen/token"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
+// evalLimits keeps a program posted to /api/evaluate from running the
+// server out of time or memory.
+var evalLimits = evaluator.Options{
+	MaxSteps:      10_000_000,
+	MaxCallDepth:  10_000,
+	MaxListLength: 1_000_000,
+	Timeout:       5 * time.Second,
+}
+
 type GenerateRequest struct {
 	Program string `json:"program"`
 	Delta   []int  `json:"delta"`
@@ -22,9 +36,16 @@ type EvaluateRequest struct {
 	Args    []string `json:"args"`
 }
 
+type ParseRequest struct {
+	Program string `json:"program"`
+	Dialect string `json:"dialect"`
+}
+
 type Response struct {
-	Result string `json:"result,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Result      string                   `json:"result,omitempty"`
+	AST         *ast.Program             `json:"ast,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+	Diagnostics []diagnostics.Diagnostic `json:"diagnostics,omitempty"`
 }
 
 func generateHandler(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +76,11 @@ func generateHandler(w http.ResponseWriter, r *http.Request) {
 	c := generator.New(p)
 	generated, err := c.Gen(req.Delta)
 	if err != nil {
+		var list *diagnostics.List
+		if errors.As(err, &list) {
+			sendDiagnostics(w, fmt.Sprintf("Generation error: %v", err), list.Diagnostics)
+			return
+		}
 		sendError(w, fmt.Sprintf("Generation error: %v", err))
 		return
 	}
@@ -62,6 +88,50 @@ func generateHandler(w http.ResponseWriter, r *http.Request) {
 	sendResult(w, generated.String())
 }
 
+func parseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Failed to read body: %v", err))
+		return
+	}
+
+	var req ParseRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+
+	if req.Program == "" {
+		sendError(w, "Program is required")
+		return
+	}
+
+	dialect := token.DefaultDialect
+	if req.Dialect != "" {
+		if dialect, err = token.ParseDialect(req.Dialect); err != nil {
+			sendError(w, err.Error())
+			return
+		}
+	}
+
+	l := lexer.New(req.Program, dialect)
+	p := parser.New(l)
+	parsedProgram := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		sendDiagnostics(w, p.GetErrorMessage(), p.Errors())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := Response{AST: parsedProgram}
+	json.NewEncoder(w).Encode(resp)
+}
+
 func evaluateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -87,48 +157,36 @@ func evaluateHandler(w http.ResponseWriter, r *http.Request) {
 
 	l := lexer.New(req.Program)
 	p := parser.New(l)
-	env := object.NewEnvironment()
 
 	parsedProgram := p.ParseProgram()
 	if len(p.Errors()) != 0 {
-		sendError(w, p.GetErrorMessage())
+		sendDiagnostics(w, p.GetErrorMessage(), p.Errors())
 		return
 	}
 
-	if len(parsedProgram.Variables) > 0 {
-		expectedArgs := len(parsedProgram.Variables)
-		if len(req.Args) != expectedArgs {
-			sendError(w, fmt.Sprintf("Program expects %d arguments, got %d", expectedArgs, len(req.Args)))
-			return
-		}
-
-		for i, input := range parsedProgram.Variables {
-			val := parseArgument(req.Args[i])
-			env.Set(input.Ident.Value, val)
-		}
+	env, err := evaluator.BindArguments(parsedProgram, req.Args)
+	if err != nil {
+		sendError(w, err.Error())
+		return
 	}
 
-	e := evaluator.New(parsedProgram)
-	evaluated := e.Eval(parsedProgram, env)
-	if evaluated != nil {
+	evaluated := evaluator.Eval(r.Context(), parsedProgram, env, evalLimits)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		sendDiagnostics(w, errObj.Message, []diagnostics.Diagnostic{errObj.Diagnostic()})
+	} else if evaluated != nil {
 		sendResult(w, evaluated.String())
 	} else {
 		sendResult(w, "nil")
 	}
 }
 
-func parseArgument(arg string) object.Object {
-	l := lexer.New(arg)
-	p := parser.New(l)
-	parseResult := p.ParseExpression(parser.LOWEST)
-	env := object.NewEnvironment()
-	e := evaluator.Evaluator{Program: nil}
-	return e.Eval(parseResult, env)
+func sendError(w http.ResponseWriter, errMsg string) {
+	sendDiagnostics(w, errMsg, nil)
 }
 
-func sendError(w http.ResponseWriter, errMsg string) {
+func sendDiagnostics(w http.ResponseWriter, errMsg string, diags []diagnostics.Diagnostic) {
 	w.Header().Set("Content-Type", "application/json")
-	resp := Response{Error: errMsg}
+	resp := Response{Error: errMsg, Diagnostics: diags}
 	json.NewEncoder(w).Encode(resp)
 }
 
@@ -159,6 +217,7 @@ func main() {
 
 	mux.HandleFunc("/api/generate", generateHandler)
 	mux.HandleFunc("/api/evaluate", evaluateHandler)
+	mux.HandleFunc("/api/parse", parseHandler)
 
 	mux.Handle("/", http.FileServer(http.Dir("static")))
 	mux.Handle("/static/", staticFiles())